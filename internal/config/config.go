@@ -0,0 +1,420 @@
+// Package config loads the bot configuration. Values start from Default, are
+// overridden by an optional YAML file and then by environment variables, and
+// are validated as a whole so every problem is reported at startup at once.
+package config
+
+import (
+	"awesomeProject/internal/models"
+	"awesomeProject/internal/service"
+	"awesomeProject/internal/webhook"
+	"bytes"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultDatabaseURL points at a local development database
+const DefaultDatabaseURL = "host=localhost port=5432 user=postgres password=123 dbname=goalsbot sslmode=disable"
+
+// Update modes
+const (
+	ModePolling = "polling"
+	ModeWebhook = "webhook"
+)
+
+// Reminder targets
+const (
+	TargetChat = "chat" // the goal's chat
+	TargetDM   = "dm"   // the author's private chat
+)
+
+// Config is the complete bot configuration
+type Config struct {
+	Telegram        Telegram      `yaml:"telegram"`
+	Database        Database      `yaml:"database"`
+	Rules           Rules         `yaml:"rules"`
+	Scheduler       Scheduler     `yaml:"scheduler"`
+	Log             Log           `yaml:"log"`
+	Metrics         Metrics       `yaml:"metrics"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"` // Wait for queued work on SIGINT/SIGTERM before aborting it
+}
+
+// Telegram configures the Bot API connection and update processing
+type Telegram struct {
+	Token       string        `yaml:"token"`
+	UpdateMode  string        `yaml:"update_mode"`  // ModePolling or ModeWebhook
+	PollTimeout time.Duration `yaml:"poll_timeout"` // Long polling timeout, whole seconds
+	Workers     int           `yaml:"workers"`      // Parallel update workers
+	QueueSize   int           `yaml:"queue_size"`   // Queued updates per worker
+	Webhook     Webhook       `yaml:"webhook"`
+}
+
+// Webhook configures receiving updates in ModeWebhook
+type Webhook struct {
+	URL    string `yaml:"url"`    // Public HTTPS URL registered with Telegram
+	Secret string `yaml:"secret"` // Token Telegram sends in the secret header
+	Listen string `yaml:"listen"` // Local address the HTTP server listens on
+	Path   string `yaml:"path"`   // Local path updates are posted to, defaults to the path of URL
+}
+
+// Database configures PostgreSQL access
+type Database struct {
+	URL          string        `yaml:"url"`
+	QueryTimeout time.Duration `yaml:"query_timeout"` // Limit for a single repository call
+	AutoMigrate  bool          `yaml:"auto_migrate"`  // Apply pending migrations on startup
+}
+
+// Rules are the business rules of goals, bets and voting. Bet limits,
+// approval percent, voting window, penalty mode, language and goal change
+// terms are defaults that chat admins can change with /settings.
+type Rules struct {
+	StartingBalance  int           `yaml:"starting_balance"`  // Stars a new user starts with
+	MinBet           int           `yaml:"min_bet"`           // Smallest bet allowed
+	MaxBet           int           `yaml:"max_bet"`           // Largest bet allowed, 0 for no limit
+	ApprovalPercent  int           `yaml:"approval_percent"`  // Share of eligible voters that must vote yes
+	VotingWindow     time.Duration `yaml:"voting_window"`     // 0 keeps voting open until decided
+	VotingResolution string        `yaml:"voting_resolution"` // service.ResolveAbstainYes or service.ResolveCastMajority
+	PenaltyMode      string        `yaml:"penalty_mode"`      // One of models.PenaltyModes
+	CharityAccount   int64         `yaml:"charity_account"`   // Telegram ID receiving charity penalties, 0 disables that mode
+	Language         string        `yaml:"language"`          // models.LanguageRussian or models.LanguageEnglish
+	ChangeFee        int           `yaml:"change_fee"`        // Percent of the bet charged to extend a deadline or cancel a goal
+	ChangeWindow     int           `yaml:"change_window"`     // Percent of a goal's time during which it may be extended or cancelled
+	ConversationTTL  time.Duration `yaml:"conversation_ttl"`  // How long an unfinished dialog is kept
+}
+
+// Scheduler configures background jobs
+type Scheduler struct {
+	Interval        time.Duration   `yaml:"interval"`
+	ReminderOffsets []time.Duration `yaml:"reminder_offsets"` // How long before a deadline to remind, default for chats
+	ReminderTargets []string        `yaml:"reminder_targets"` // TargetChat and/or TargetDM
+}
+
+// Log configures logging
+type Log struct {
+	Level  string `yaml:"level"`  // debug, info, warn or error
+	Format string `yaml:"format"` // text or json
+}
+
+// Metrics configures the Prometheus endpoint
+type Metrics struct {
+	Listen string `yaml:"listen"`
+}
+
+// Default returns the configuration used when nothing is overridden
+func Default() Config {
+	return Config{
+		Telegram: Telegram{
+			UpdateMode:  ModePolling,
+			PollTimeout: 60 * time.Second,
+			Workers:     8,
+			QueueSize:   100,
+			Webhook:     Webhook{Listen: ":8080"},
+		},
+		Database: Database{
+			URL:          DefaultDatabaseURL,
+			QueryTimeout: 5 * time.Second,
+			AutoMigrate:  true,
+		},
+		Rules: Rules{
+			StartingBalance:  100,
+			MinBet:           1,
+			ApprovalPercent:  50,
+			VotingWindow:     48 * time.Hour,
+			VotingResolution: service.ResolveAbstainYes,
+			PenaltyMode:      models.PenaltyMembers,
+			Language:         models.LanguageRussian,
+			ChangeFee:        10,
+			ChangeWindow:     50,
+			ConversationTTL:  24 * time.Hour,
+		},
+		Scheduler: Scheduler{
+			Interval:        time.Minute,
+			ReminderOffsets: []time.Duration{72 * time.Hour, 24 * time.Hour, 3 * time.Hour},
+			ReminderTargets: []string{TargetChat, TargetDM},
+		},
+		Log:             Log{Level: "info", Format: "text"},
+		Metrics:         Metrics{Listen: ":9090"},
+		ShutdownTimeout: 30 * time.Second,
+	}
+}
+
+// Load builds the configuration from the defaults, the YAML file at path
+// (skipped if path is empty) and the environment, and validates it
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return cfg, err
+		}
+	}
+
+	envErr := cfg.loadEnv(os.Getenv)
+
+	if cfg.Telegram.Webhook.Path == "" {
+		if public, err := url.Parse(cfg.Telegram.Webhook.URL); err == nil {
+			cfg.Telegram.Webhook.Path = public.Path
+		}
+	}
+	if !strings.HasPrefix(cfg.Telegram.Webhook.Path, "/") {
+		cfg.Telegram.Webhook.Path = "/" + cfg.Telegram.Webhook.Path
+	}
+
+	return cfg, errors.Join(envErr, cfg.Validate())
+}
+
+// loadFile overrides values set in the YAML file. Unknown keys are errors,
+// so a typo does not silently leave the default in place.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadEnv overrides values with the environment variables that are set
+func (c *Config) loadEnv(getenv func(string) string) error {
+	env := envReader{getenv: getenv}
+
+	env.string("TELEGRAM_TOKEN", &c.Telegram.Token)
+	env.string("UPDATE_MODE", &c.Telegram.UpdateMode)
+	env.duration("POLL_TIMEOUT", &c.Telegram.PollTimeout)
+	env.int("UPDATE_WORKERS", &c.Telegram.Workers)
+	env.int("UPDATE_QUEUE_SIZE", &c.Telegram.QueueSize)
+	env.string("WEBHOOK_URL", &c.Telegram.Webhook.URL)
+	env.string("WEBHOOK_SECRET", &c.Telegram.Webhook.Secret)
+	env.string("WEBHOOK_LISTEN", &c.Telegram.Webhook.Listen)
+	env.string("WEBHOOK_PATH", &c.Telegram.Webhook.Path)
+
+	env.string("DATABASE_URL", &c.Database.URL)
+	env.duration("QUERY_TIMEOUT", &c.Database.QueryTimeout)
+	env.bool("AUTO_MIGRATE", &c.Database.AutoMigrate)
+
+	env.int("STARTING_BALANCE", &c.Rules.StartingBalance)
+	env.int("MIN_BET", &c.Rules.MinBet)
+	env.int("MAX_BET", &c.Rules.MaxBet)
+	env.int("APPROVAL_PERCENT", &c.Rules.ApprovalPercent)
+	env.duration("VOTING_WINDOW", &c.Rules.VotingWindow)
+	env.string("VOTING_RESOLUTION", &c.Rules.VotingResolution)
+	env.string("PENALTY_MODE", &c.Rules.PenaltyMode)
+	env.int64("CHARITY_ACCOUNT", &c.Rules.CharityAccount)
+	env.string("LANGUAGE", &c.Rules.Language)
+	env.int("CHANGE_FEE", &c.Rules.ChangeFee)
+	env.int("CHANGE_WINDOW", &c.Rules.ChangeWindow)
+	env.duration("CONVERSATION_TTL", &c.Rules.ConversationTTL)
+
+	env.duration("SCHEDULER_INTERVAL", &c.Scheduler.Interval)
+	env.durations("REMINDER_OFFSETS", &c.Scheduler.ReminderOffsets)
+	env.strings("REMINDER_TARGETS", &c.Scheduler.ReminderTargets)
+
+	env.string("LOG_LEVEL", &c.Log.Level)
+	env.string("LOG_FORMAT", &c.Log.Format)
+	env.string("METRICS_LISTEN", &c.Metrics.Listen)
+	env.duration("SHUTDOWN_TIMEOUT", &c.ShutdownTimeout)
+
+	return errors.Join(env.errs...)
+}
+
+// Validate reports every invalid setting. The Telegram token is not checked
+// here because schema management commands run without it.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	tg := c.Telegram
+	check(tg.UpdateMode == ModePolling || tg.UpdateMode == ModeWebhook,
+		"telegram.update_mode must be %q or %q, got %q", ModePolling, ModeWebhook, tg.UpdateMode)
+	check(tg.PollTimeout >= time.Second && tg.PollTimeout%time.Second == 0,
+		"telegram.poll_timeout must be a positive whole number of seconds, got %s", tg.PollTimeout)
+	check(tg.Workers > 0, "telegram.workers must be positive, got %d", tg.Workers)
+	check(tg.QueueSize > 0, "telegram.queue_size must be positive, got %d", tg.QueueSize)
+
+	if tg.UpdateMode == ModeWebhook {
+		public, err := url.Parse(tg.Webhook.URL)
+		check(err == nil && public.Scheme == "https" && public.Host != "",
+			"telegram.webhook.url must be a public https URL, got %q", tg.Webhook.URL)
+		if err := webhook.ValidateSecret(tg.Webhook.Secret); err != nil {
+			errs = append(errs, fmt.Errorf("telegram.webhook.secret: %w", err))
+		}
+		check(tg.Webhook.Listen != "", "telegram.webhook.listen must be set")
+	}
+
+	db := c.Database
+	check(db.URL != "", "database.url must be set")
+	check(db.QueryTimeout > 0, "database.query_timeout must be positive, got %s", db.QueryTimeout)
+
+	rules := c.Rules
+	check(rules.StartingBalance >= 0, "rules.starting_balance must not be negative, got %d", rules.StartingBalance)
+	check(rules.MinBet >= 1, "rules.min_bet must be at least 1, got %d", rules.MinBet)
+	check(rules.MaxBet == 0 || rules.MaxBet >= rules.MinBet,
+		"rules.max_bet must be 0 or at least rules.min_bet, got %d", rules.MaxBet)
+	check(rules.ApprovalPercent >= 1 && rules.ApprovalPercent <= 100,
+		"rules.approval_percent must be between 1 and 100, got %d", rules.ApprovalPercent)
+	check(rules.VotingWindow >= 0, "rules.voting_window must not be negative, got %s", rules.VotingWindow)
+	check(rules.VotingResolution == service.ResolveAbstainYes || rules.VotingResolution == service.ResolveCastMajority,
+		"rules.voting_resolution must be %q or %q, got %q", service.ResolveAbstainYes, service.ResolveCastMajority, rules.VotingResolution)
+	check(containsString(models.PenaltyModes, rules.PenaltyMode),
+		"rules.penalty_mode must be one of %s, got %q", strings.Join(models.PenaltyModes, ", "), rules.PenaltyMode)
+	check(rules.PenaltyMode != models.PenaltyCharity || rules.CharityAccount != 0,
+		"rules.penalty_mode %q needs rules.charity_account", models.PenaltyCharity)
+	check(rules.CharityAccount >= 0, "rules.charity_account must be a Telegram user ID, got %d", rules.CharityAccount)
+	check(rules.Language == models.LanguageRussian || rules.Language == models.LanguageEnglish,
+		"rules.language must be %q or %q, got %q", models.LanguageRussian, models.LanguageEnglish, rules.Language)
+	check(rules.ChangeFee >= 0 && rules.ChangeFee <= 100,
+		"rules.change_fee must be between 0 and 100, got %d", rules.ChangeFee)
+	check(rules.ChangeWindow >= 0 && rules.ChangeWindow <= 100,
+		"rules.change_window must be between 0 and 100, got %d", rules.ChangeWindow)
+	check(rules.ConversationTTL > 0, "rules.conversation_ttl must be positive, got %s", rules.ConversationTTL)
+
+	sched := c.Scheduler
+	check(sched.Interval > 0, "scheduler.interval must be positive, got %s", sched.Interval)
+	for _, offset := range sched.ReminderOffsets {
+		check(offset > 0 && offset <= service.MaxReminderOffset,
+			"scheduler.reminder_offsets must be positive and at most %s, got %s", service.MaxReminderOffset, offset)
+	}
+	for _, target := range sched.ReminderTargets {
+		check(target == TargetChat || target == TargetDM,
+			"scheduler.reminder_targets entries must be %q or %q, got %q", TargetChat, TargetDM, target)
+	}
+
+	check(c.Log.Level == "debug" || c.Log.Level == "info" || c.Log.Level == "warn" || c.Log.Level == "error",
+		"log.level must be debug, info, warn or error, got %q", c.Log.Level)
+	check(c.Log.Format == "text" || c.Log.Format == "json", "log.format must be text or json, got %q", c.Log.Format)
+	check(c.Metrics.Listen != "", "metrics.listen must be set")
+	check(c.ShutdownTimeout > 0, "shutdown_timeout must be positive, got %s", c.ShutdownTimeout)
+
+	return errors.Join(errs...)
+}
+
+// RemindInChat reports whether reminders go to the goal's chat
+func (s Scheduler) RemindInChat() bool {
+	return s.hasTarget(TargetChat)
+}
+
+// RemindAuthor reports whether reminders go to the author's private chat
+func (s Scheduler) RemindAuthor() bool {
+	return s.hasTarget(TargetDM)
+}
+
+func (s Scheduler) hasTarget(target string) bool {
+	return containsString(s.ReminderTargets, target)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// envReader parses environment overrides, collecting errors for variables
+// that are set but malformed
+type envReader struct {
+	getenv func(string) string
+	errs   []error
+}
+
+func (e *envReader) fail(name, raw, want string) {
+	e.errs = append(e.errs, fmt.Errorf("%s must be %s, got %q", name, want, raw))
+}
+
+func (e *envReader) string(name string, dst *string) {
+	if raw := e.getenv(name); raw != "" {
+		*dst = raw
+	}
+}
+
+func (e *envReader) int(name string, dst *int) {
+	if raw := e.getenv(name); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			e.fail(name, raw, "an integer")
+			return
+		}
+		*dst = n
+	}
+}
+
+func (e *envReader) int64(name string, dst *int64) {
+	if raw := e.getenv(name); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			e.fail(name, raw, "an integer")
+			return
+		}
+		*dst = n
+	}
+}
+
+func (e *envReader) bool(name string, dst *bool) {
+	if raw := e.getenv(name); raw != "" {
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			e.fail(name, raw, "true or false")
+			return
+		}
+		*dst = b
+	}
+}
+
+func (e *envReader) duration(name string, dst *time.Duration) {
+	if raw := e.getenv(name); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			e.fail(name, raw, "a duration such as 30s or 48h")
+			return
+		}
+		*dst = d
+	}
+}
+
+// durations reads a comma-separated list of durations
+func (e *envReader) durations(name string, dst *[]time.Duration) {
+	raw := e.getenv(name)
+	if raw == "" {
+		return
+	}
+
+	var list []time.Duration
+	for _, part := range strings.Split(raw, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(part))
+		if err != nil {
+			e.fail(name, raw, "a comma-separated list of durations")
+			return
+		}
+		list = append(list, d)
+	}
+	*dst = list
+}
+
+// strings reads a comma-separated list
+func (e *envReader) strings(name string, dst *[]string) {
+	raw := e.getenv(name)
+	if raw == "" {
+		return
+	}
+
+	var list []string
+	for _, part := range strings.Split(raw, ",") {
+		list = append(list, strings.TrimSpace(part))
+	}
+	*dst = list
+}
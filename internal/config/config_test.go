@@ -0,0 +1,208 @@
+package config
+
+import (
+	"awesomeProject/internal/models"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearEnv unsets every variable loadEnv reads, so the test does not depend
+// on the environment it runs in (LANGUAGE, for one, is often set by the OS)
+func clearEnv(t *testing.T) {
+	t.Helper()
+
+	cfg := Default()
+	cfg.loadEnv(func(name string) string {
+		t.Setenv(name, "")
+		return ""
+	})
+}
+
+// writeFile stores a YAML config in a temporary directory and returns its path
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	clearEnv(t)
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Default()
+	want.Telegram.Webhook.Path = "/"
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("expected the defaults, got %+v", cfg)
+	}
+}
+
+func TestLoadFileThenEnvironment(t *testing.T) {
+	clearEnv(t)
+	path := writeFile(t, `
+telegram:
+  workers: 4
+rules:
+  min_bet: 5
+  max_bet: 500
+  penalty_mode: burn
+scheduler:
+  reminder_offsets: [12h]
+`)
+	t.Setenv("MIN_BET", "10")
+	t.Setenv("REMINDER_OFFSETS", "48h, 2h")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The file overrides the defaults and the environment overrides the file,
+	// while settings neither of them mention keep their defaults
+	if cfg.Telegram.Workers != 4 || cfg.Rules.MaxBet != 500 || cfg.Rules.PenaltyMode != models.PenaltyBurn {
+		t.Errorf("expected the file values, got workers %d, max bet %d and penalty mode %q",
+			cfg.Telegram.Workers, cfg.Rules.MaxBet, cfg.Rules.PenaltyMode)
+	}
+	if cfg.Rules.MinBet != 10 {
+		t.Errorf("expected MIN_BET to override the file, got %d", cfg.Rules.MinBet)
+	}
+	if want := []time.Duration{48 * time.Hour, 2 * time.Hour}; !reflect.DeepEqual(cfg.Scheduler.ReminderOffsets, want) {
+		t.Errorf("expected reminder offsets %v, got %v", want, cfg.Scheduler.ReminderOffsets)
+	}
+	if cfg.Telegram.QueueSize != Default().Telegram.QueueSize || cfg.Rules.ApprovalPercent != Default().Rules.ApprovalPercent {
+		t.Errorf("expected untouched settings to keep their defaults, got queue size %d and approval %d%%",
+			cfg.Telegram.QueueSize, cfg.Rules.ApprovalPercent)
+	}
+}
+
+func TestLoadWebhookPathFromURL(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("UPDATE_MODE", ModeWebhook)
+	t.Setenv("WEBHOOK_URL", "https://bot.example.com/tg/updates")
+	t.Setenv("WEBHOOK_SECRET", "secret")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Telegram.Webhook.Path != "/tg/updates" {
+		t.Errorf("expected the path of the webhook URL, got %q", cfg.Telegram.Webhook.Path)
+	}
+}
+
+func TestLoadRejectsUnknownKey(t *testing.T) {
+	clearEnv(t)
+	path := writeFile(t, `
+rules:
+  min_bett: 5
+`)
+
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), "min_bett") {
+		t.Errorf("expected the misspelled key to be reported, got %v", err)
+	}
+}
+
+func TestLoadRejectsMalformedEnvironment(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("MIN_BET", "ten")
+	t.Setenv("VOTING_WINDOW", "2 days")
+	t.Setenv("AUTO_MIGRATE", "maybe")
+
+	_, err := Load("")
+	if err == nil {
+		t.Fatal("expected malformed variables to be rejected")
+	}
+	for _, name := range []string{"MIN_BET", "VOTING_WINDOW", "AUTO_MIGRATE"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("expected %s to be reported, got %v", name, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   string // Expected part of the error, empty if valid
+	}{
+		{"defaults", func(c *Config) {}, ""},
+		{"webhook", func(c *Config) {
+			c.Telegram.UpdateMode = ModeWebhook
+			c.Telegram.Webhook.URL = "https://bot.example.com/hook"
+			c.Telegram.Webhook.Secret = "secret"
+		}, ""},
+		{"charity with account", func(c *Config) {
+			c.Rules.PenaltyMode = models.PenaltyCharity
+			c.Rules.CharityAccount = 42
+		}, ""},
+		{"unknown update mode", func(c *Config) { c.Telegram.UpdateMode = "push" }, "telegram.update_mode"},
+		{"fractional poll timeout", func(c *Config) { c.Telegram.PollTimeout = 1500 * time.Millisecond }, "telegram.poll_timeout"},
+		{"no workers", func(c *Config) { c.Telegram.Workers = 0 }, "telegram.workers"},
+		{"http webhook", func(c *Config) {
+			c.Telegram.UpdateMode = ModeWebhook
+			c.Telegram.Webhook.URL = "http://bot.example.com/hook"
+			c.Telegram.Webhook.Secret = "secret"
+		}, "telegram.webhook.url"},
+		{"webhook without host", func(c *Config) {
+			c.Telegram.UpdateMode = ModeWebhook
+			c.Telegram.Webhook.URL = "https:///hook"
+			c.Telegram.Webhook.Secret = "secret"
+		}, "telegram.webhook.url"},
+		{"webhook secret", func(c *Config) {
+			c.Telegram.UpdateMode = ModeWebhook
+			c.Telegram.Webhook.URL = "https://bot.example.com/hook"
+			c.Telegram.Webhook.Secret = "not allowed!"
+		}, "telegram.webhook.secret"},
+		{"max bet below min bet", func(c *Config) { c.Rules.MinBet, c.Rules.MaxBet = 10, 5 }, "rules.max_bet"},
+		{"approval over 100", func(c *Config) { c.Rules.ApprovalPercent = 101 }, "rules.approval_percent"},
+		{"unknown voting resolution", func(c *Config) { c.Rules.VotingResolution = "coin" }, "rules.voting_resolution"},
+		{"unknown penalty mode", func(c *Config) { c.Rules.PenaltyMode = "lottery" }, "rules.penalty_mode"},
+		{"charity without account", func(c *Config) { c.Rules.PenaltyMode = models.PenaltyCharity }, "rules.charity_account"},
+		{"unknown language", func(c *Config) { c.Rules.Language = "de" }, "rules.language"},
+		{"change fee over 100", func(c *Config) { c.Rules.ChangeFee = 150 }, "rules.change_fee"},
+		{"reminder too early", func(c *Config) { c.Scheduler.ReminderOffsets = []time.Duration{365 * 24 * time.Hour} }, "scheduler.reminder_offsets"},
+		{"unknown reminder target", func(c *Config) { c.Scheduler.ReminderTargets = []string{"email"} }, "scheduler.reminder_targets"},
+		{"unknown log level", func(c *Config) { c.Log.Level = "trace" }, "log.level"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.modify(&cfg)
+
+			err := cfg.Validate()
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("expected a valid config, got %v", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("expected an error about %s, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := Default()
+	cfg.Telegram.Workers = 0
+	cfg.Rules.MinBet = 0
+	cfg.Log.Format = "xml"
+
+	err := cfg.Validate()
+	for _, field := range []string{"telegram.workers", "rules.min_bet", "log.format"} {
+		if err == nil || !strings.Contains(err.Error(), field) {
+			t.Errorf("expected an error about %s, got %v", field, err)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package dispatcher
+
+import (
+	"awesomeProject/internal/logging"
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+)
+
+// Handler processes a single update
+type Handler interface {
+	HandleUpdate(ctx context.Context, update tgbotapi.Update)
+}
+
+// Dispatcher processes updates on a fixed pool of workers. Every update is
+// routed to a worker by its chat (or user, if it has no chat), so updates
+// from one chat are handled in the order they arrived while different chats
+// proceed in parallel. Each worker has a bounded queue; when it is full
+// Dispatch blocks, which in turn stops the bot from fetching more updates.
+type Dispatcher struct {
+	ctx     context.Context // Passed to every HandleUpdate call
+	handler Handler
+	queues  []chan tgbotapi.Update
+	wg      sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewDispatcher starts the workers. Updates are handled with ctx, so
+// cancelling it aborts the work of updates still being handled or queued.
+func NewDispatcher(ctx context.Context, handler Handler, workers, queueSize int) *Dispatcher {
+	if workers < 1 {
+		workers = 1
+	}
+
+	d := &Dispatcher{
+		ctx:     ctx,
+		handler: handler,
+		queues:  make([]chan tgbotapi.Update, workers),
+	}
+
+	for i := range d.queues {
+		d.queues[i] = make(chan tgbotapi.Update, queueSize)
+		d.wg.Add(1)
+		go d.work(d.queues[i])
+	}
+
+	return d
+}
+
+// Run dispatches updates until the channel is closed, then drains the workers
+func (d *Dispatcher) Run(updates <-chan tgbotapi.Update) {
+	for update := range updates {
+		d.Dispatch(update)
+	}
+	d.Close()
+}
+
+// Dispatch queues an update on its worker, blocking while that queue is full.
+// It reports false if the dispatcher is already closed.
+func (d *Dispatcher) Dispatch(update tgbotapi.Update) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.closed {
+		return false
+	}
+
+	d.queues[d.workerFor(update)] <- update
+	return true
+}
+
+// Close stops accepting updates and waits until every queued update has been
+// handled. It is safe to call more than once.
+func (d *Dispatcher) Close() {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		for _, queue := range d.queues {
+			close(queue)
+		}
+	}
+	d.mu.Unlock()
+
+	d.wg.Wait()
+}
+
+func (d *Dispatcher) work(queue <-chan tgbotapi.Update) {
+	defer d.wg.Done()
+	for update := range queue {
+		d.handle(update)
+	}
+}
+
+// handle runs the handler, keeping the worker alive if it panics
+func (d *Dispatcher) handle(update tgbotapi.Update) {
+	defer func() {
+		if p := recover(); p != nil {
+			slog.ErrorContext(d.ctx, "Panic while handling update", logging.UpdateID, update.UpdateID,
+				"panic", p, "stack", string(debug.Stack()))
+		}
+	}()
+
+	d.handler.HandleUpdate(d.ctx, update)
+}
+
+func (d *Dispatcher) workerFor(update tgbotapi.Update) int {
+	key := orderingKey(update)
+	if key < 0 {
+		key = -key
+	}
+	return int(key % int64(len(d.queues)))
+}
+
+// orderingKey identifies the stream an update must stay ordered within:
+// its chat when there is one, otherwise the user who sent it
+func orderingKey(update tgbotapi.Update) int64 {
+	if chat := update.FromChat(); chat != nil {
+		return chat.ID
+	}
+	if user := update.SentFrom(); user != nil {
+		return user.ID
+	}
+	return int64(update.UpdateID)
+}
@@ -0,0 +1,178 @@
+package dispatcher
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"sync"
+	"testing"
+	"time"
+)
+
+// handlerFunc adapts a function to the Handler interface
+type handlerFunc func(ctx context.Context, update tgbotapi.Update)
+
+func (f handlerFunc) HandleUpdate(ctx context.Context, update tgbotapi.Update) {
+	f(ctx, update)
+}
+
+func chatUpdate(id int, chatID int64) tgbotapi.Update {
+	return tgbotapi.Update{
+		UpdateID: id,
+		Message:  &tgbotapi.Message{MessageID: id, Chat: &tgbotapi.Chat{ID: chatID}},
+	}
+}
+
+// waitFor fails the test if ch does not deliver within a second
+func waitFor[T any](t *testing.T, ch <-chan T, what string) T {
+	t.Helper()
+
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+		var zero T
+		return zero
+	}
+}
+
+func TestUpdatesOfOneChatStayInOrder(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		handled = map[int64][]int{}
+	)
+	d := NewDispatcher(context.Background(), handlerFunc(func(_ context.Context, update tgbotapi.Update) {
+		mu.Lock()
+		defer mu.Unlock()
+		chatID := update.FromChat().ID
+		handled[chatID] = append(handled[chatID], update.UpdateID)
+	}), 4, 8)
+
+	const perChat = 100
+	for i := 0; i < perChat; i++ {
+		for chatID := int64(-3); chatID <= 3; chatID++ {
+			d.Dispatch(chatUpdate(i, chatID))
+		}
+	}
+	d.Close()
+
+	for chatID := int64(-3); chatID <= 3; chatID++ {
+		ids := handled[chatID]
+		if len(ids) != perChat {
+			t.Fatalf("chat %d: expected %d updates, got %d", chatID, perChat, len(ids))
+		}
+		for i, id := range ids {
+			if id != i {
+				t.Fatalf("chat %d: update %d handled at position %d", chatID, id, i)
+			}
+		}
+	}
+}
+
+func TestDifferentChatsRunConcurrently(t *testing.T) {
+	started := make(chan int64, 2)
+	release := make(chan struct{})
+	d := NewDispatcher(context.Background(), handlerFunc(func(_ context.Context, update tgbotapi.Update) {
+		started <- update.FromChat().ID
+		<-release
+	}), 2, 1)
+	defer d.Close()
+
+	// Chats 0 and 1 land on different workers, so the second one starts
+	// while the first is still being handled
+	d.Dispatch(chatUpdate(1, 0))
+	d.Dispatch(chatUpdate(2, 1))
+
+	waitFor(t, started, "the first chat")
+	waitFor(t, started, "the second chat")
+	close(release)
+}
+
+func TestFullQueueBlocksDispatch(t *testing.T) {
+	started := make(chan struct{}, 3)
+	release := make(chan struct{})
+	d := NewDispatcher(context.Background(), handlerFunc(func(context.Context, tgbotapi.Update) {
+		started <- struct{}{}
+		<-release
+	}), 1, 1)
+	defer d.Close()
+
+	// The first update occupies the worker and the second fills its queue
+	d.Dispatch(chatUpdate(1, 1))
+	waitFor(t, started, "the first update")
+	d.Dispatch(chatUpdate(2, 1))
+
+	dispatched := make(chan bool)
+	go func() { dispatched <- d.Dispatch(chatUpdate(3, 1)) }()
+
+	select {
+	case <-dispatched:
+		t.Fatal("expected Dispatch to block while the queue is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if !waitFor(t, dispatched, "Dispatch to return") {
+		t.Error("expected the update to be accepted once the queue has room")
+	}
+}
+
+func TestCloseDrainsQueuesAndRejectsUpdates(t *testing.T) {
+	release := make(chan struct{})
+	var (
+		mu      sync.Mutex
+		handled int
+	)
+	d := NewDispatcher(context.Background(), handlerFunc(func(context.Context, tgbotapi.Update) {
+		<-release
+		mu.Lock()
+		defer mu.Unlock()
+		handled++
+	}), 2, 10)
+
+	for i := 0; i < 10; i++ {
+		d.Dispatch(chatUpdate(i, int64(i)))
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		d.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+		t.Fatal("expected Close to wait for the queued updates")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	waitFor(t, closed, "Close to return")
+	if handled != 10 {
+		t.Errorf("expected all 10 queued updates to be handled, got %d", handled)
+	}
+
+	if d.Dispatch(chatUpdate(10, 1)) {
+		t.Error("expected a closed dispatcher to reject updates")
+	}
+	// Closing again is harmless
+	d.Close()
+}
+
+func TestPanickingHandlerKeepsWorkerAlive(t *testing.T) {
+	handled := make(chan int, 1)
+	d := NewDispatcher(context.Background(), handlerFunc(func(_ context.Context, update tgbotapi.Update) {
+		if update.UpdateID == 1 {
+			panic("boom")
+		}
+		handled <- update.UpdateID
+	}), 1, 2)
+	defer d.Close()
+
+	d.Dispatch(chatUpdate(1, 1))
+	d.Dispatch(chatUpdate(2, 1))
+
+	if id := waitFor(t, handled, "the update after the panic"); id != 2 {
+		t.Errorf("expected update 2 to be handled, got %d", id)
+	}
+}
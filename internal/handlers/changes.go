@@ -0,0 +1,350 @@
+package handlers
+
+import (
+	"awesomeProject/internal/logging"
+	"awesomeProject/internal/models"
+	"awesomeProject/internal/service"
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// Conversation steps waiting for a new value of a goal, by the field part of
+// edit_<goalID>_<field> callback data
+var editSteps = map[string]string{
+	"title":    "editing_title",
+	"desc":     "editing_description",
+	"deadline": "editing_deadline",
+}
+
+func (h *BotHandler) handleEditGoal(ctx context.Context, message *tgbotapi.Message, user *models.User) {
+	h.chooseGoal(ctx, message, user, "edit", localeFrom(ctx).t("✏️ Какую цель изменить?"))
+}
+
+func (h *BotHandler) handleCancelGoal(ctx context.Context, message *tgbotapi.Message, user *models.User) {
+	h.chooseGoal(ctx, message, user, "cancelgoal", localeFrom(ctx).t("🚫 Какую цель отменить?"))
+}
+
+// chooseGoal lists the user's goals that can still be changed as buttons
+// with the callback data <action>_<goalID>
+func (h *BotHandler) chooseGoal(ctx context.Context, message *tgbotapi.Message, user *models.User, action, prompt string) {
+	l := localeFrom(ctx)
+
+	goals, err := h.service.GetUserActiveGoals(ctx, user.ID)
+	if err != nil {
+		h.send(ctx, tgbotapi.NewMessage(message.Chat.ID, l.errorText("❌ Ошибка: %v", err)))
+		return
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, goal := range goals {
+		if goal.Status == "active" {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(goal.Title, fmt.Sprintf("%s_%d", action, goal.ID)),
+			))
+		}
+	}
+
+	if len(rows) == 0 {
+		h.send(ctx, tgbotapi.NewMessage(message.Chat.ID, l.t("У вас нет целей, которые можно изменить. Цели с отправленным доказательством не меняются.")))
+		return
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, prompt)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	h.send(ctx, msg)
+}
+
+// handleEditCallback handles edit_<goalID>, which shows what can be changed,
+// and edit_<goalID>_<field>, which asks for the new value; parts is the split
+// callback data without the leading "edit"
+func (h *BotHandler) handleEditCallback(ctx context.Context, query *tgbotapi.CallbackQuery, user *models.User, parts []string) {
+	goalID, _ := strconv.Atoi(parts[0])
+	ctx = logging.With(ctx, logging.GoalID, goalID)
+	l := localeFrom(ctx)
+
+	goal, ok := h.authorGoal(ctx, query, user, goalID)
+	if !ok {
+		return
+	}
+
+	terms, err := h.service.GoalChangeTerms(ctx, goal)
+	if err != nil {
+		h.answerCallback(ctx, query, l.errorText("❌ %v", err))
+		return
+	}
+
+	if len(parts) < 2 {
+		text, keyboard, err := h.renderGoalEditor(ctx, goal, terms)
+		if err != nil {
+			h.answerCallback(ctx, query, l.errorText("❌ %v", err))
+			return
+		}
+
+		msg := tgbotapi.NewMessage(query.Message.Chat.ID, text)
+		msg.ReplyMarkup = keyboard
+		h.send(ctx, msg)
+		h.answerCallback(ctx, query, "")
+		return
+	}
+
+	step, ok := editSteps[parts[1]]
+	if !ok {
+		return
+	}
+	if step == "editing_deadline" && !terms.Allowed {
+		h.answerCallback(ctx, query, "❌ "+changeTermsText(l, goal, terms))
+		return
+	}
+
+	h.saveState(ctx, query.Message.Chat.ID, query.From.ID, &models.ConversationState{Step: step, GoalID: goal.ID})
+
+	prompt := l.t("📝 Введите новое название цели:")
+	switch step {
+	case "editing_description":
+		prompt = l.t("📄 Введите новое описание цели:")
+	case "editing_deadline":
+		prompt = l.f("📅 Введите новый срок (формат: 2024-12-31 или количество дней, например: 7). Комиссия за продление: %d звезд", terms.Fee)
+	}
+	h.send(ctx, tgbotapi.NewMessage(query.Message.Chat.ID, prompt))
+	h.answerCallback(ctx, query, "")
+}
+
+// renderGoalEditor builds the summary of a goal with its change terms and
+// audit trail, and the buttons for the allowed changes
+func (h *BotHandler) renderGoalEditor(ctx context.Context, goal *models.Goal, terms service.ChangeTerms) (string, tgbotapi.InlineKeyboardMarkup, error) {
+	l := localeFrom(ctx)
+
+	changes, err := h.service.GetGoalChanges(ctx, goal.ID)
+	if err != nil {
+		return "", tgbotapi.InlineKeyboardMarkup{}, err
+	}
+
+	text := l.f(`✏️ Изменение цели
+
+🎯 %s
+📄 %s
+📅 Срок: %s
+⭐ Ставка: %d звезд
+
+Название и описание можно менять бесплатно.
+📅 Продление и отмена: %s
+`,
+		goal.Title,
+		goal.Description,
+		goal.Deadline.Format("02.01.2006"),
+		goal.Bet,
+		changeTermsText(l, goal, terms),
+	)
+
+	if len(changes) > 0 {
+		text += l.t("\n📜 История изменений:\n")
+		for _, change := range changes {
+			text += fmt.Sprintf("• %s — %s\n", change.CreatedAt.Format("02.01.2006 15:04"), goalChangeText(l, change))
+		}
+	}
+
+	rows := [][]tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(l.t("📝 Название"), fmt.Sprintf("edit_%d_title", goal.ID)),
+			tgbotapi.NewInlineKeyboardButtonData(l.t("📄 Описание"), fmt.Sprintf("edit_%d_desc", goal.ID)),
+		),
+	}
+	if terms.Allowed {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(l.t("📅 Продлить срок"), fmt.Sprintf("edit_%d_deadline", goal.ID)),
+			tgbotapi.NewInlineKeyboardButtonData(l.t("🚫 Отменить цель"), fmt.Sprintf("cancelgoal_%d", goal.ID)),
+		))
+	}
+	return text, tgbotapi.NewInlineKeyboardMarkup(rows...), nil
+}
+
+// handleCancelGoalCallback handles cancelgoal_<goalID>, which asks for
+// confirmation, and cancelgoal_<goalID>_ok, which cancels the goal; parts is
+// the split callback data without the leading "cancelgoal"
+func (h *BotHandler) handleCancelGoalCallback(ctx context.Context, query *tgbotapi.CallbackQuery, user *models.User, parts []string) {
+	goalID, _ := strconv.Atoi(parts[0])
+	ctx = logging.With(ctx, logging.GoalID, goalID)
+	l := localeFrom(ctx)
+
+	goal, ok := h.authorGoal(ctx, query, user, goalID)
+	if !ok {
+		return
+	}
+
+	if len(parts) < 2 || parts[1] != "ok" {
+		terms, err := h.service.GoalChangeTerms(ctx, goal)
+		if err != nil {
+			h.answerCallback(ctx, query, l.errorText("❌ %v", err))
+			return
+		}
+		if !terms.Allowed {
+			h.answerCallback(ctx, query, "❌ "+changeTermsText(l, goal, terms))
+			return
+		}
+
+		text := l.f(`🚫 Отменить цель?
+
+🎯 %s
+⭐ Ставка: %d звезд
+💸 Комиссия: %d звезд
+↩️ Вернется: %d звезд`,
+			goal.Title,
+			goal.Bet,
+			terms.Fee,
+			goal.Bet-terms.Fee,
+		)
+
+		msg := tgbotapi.NewMessage(query.Message.Chat.ID, text)
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(l.t("✅ Да, отменить"), fmt.Sprintf("cancelgoal_%d_ok", goal.ID)),
+		))
+		h.send(ctx, msg)
+		h.answerCallback(ctx, query, "")
+		return
+	}
+
+	result, err := h.service.CancelGoal(ctx, goal.ID, user.ID)
+	if err != nil {
+		h.answerCallback(ctx, query, l.errorText("❌ %v", err))
+		return
+	}
+
+	h.announceGoalChange(ctx, result, user)
+	h.answerCallback(ctx, query, l.t("✅ Цель отменена"))
+}
+
+// handleEditInput applies the value the author typed after choosing what to
+// change in a goal
+func (h *BotHandler) handleEditInput(ctx context.Context, message *tgbotapi.Message, state *models.ConversationState, user *models.User) {
+	ctx = logging.With(ctx, logging.GoalID, state.GoalID)
+	l := localeFrom(ctx)
+
+	var result *service.GoalChangeResult
+	var err error
+	switch state.Step {
+	case "editing_title":
+		result, err = h.service.EditGoalText(ctx, state.GoalID, user.ID, models.GoalChangeTitle, message.Text)
+	case "editing_description":
+		result, err = h.service.EditGoalText(ctx, state.GoalID, user.ID, models.GoalChangeDescription, message.Text)
+	case "editing_deadline":
+		deadline, parseErr := h.parseDeadline(message.Text)
+		if parseErr != nil {
+			msg := tgbotapi.NewMessage(message.Chat.ID, l.t("❌ Неверный формат даты. Используйте формат YYYY-MM-DD или количество дней (например: 7)"))
+			h.send(ctx, msg)
+			return
+		}
+		result, err = h.service.ExtendDeadline(ctx, state.GoalID, user.ID, deadline)
+	}
+
+	if service.IsTimeout(err) {
+		// Keep the state so the value can simply be sent again
+		h.send(ctx, tgbotapi.NewMessage(message.Chat.ID, l.t(retryText)))
+		return
+	}
+	h.clearState(ctx, message.Chat.ID, message.From.ID)
+	if err != nil {
+		h.send(ctx, tgbotapi.NewMessage(message.Chat.ID, l.errorText("❌ Не удалось изменить цель: %v", err)))
+		return
+	}
+
+	h.announceGoalChange(ctx, result, user)
+}
+
+// authorGoal loads the goal a button is about and checks that the user
+// pressing it is its author and may still change it. It answers the query
+// and returns false otherwise.
+func (h *BotHandler) authorGoal(ctx context.Context, query *tgbotapi.CallbackQuery, user *models.User, goalID int) (*models.Goal, bool) {
+	l := localeFrom(ctx)
+
+	goal, err := h.service.GetGoal(ctx, goalID)
+	if service.IsTimeout(err) {
+		h.answerCallback(ctx, query, l.t(retryText))
+		return nil, false
+	}
+	if err != nil {
+		h.answerCallback(ctx, query, l.t("❌ Цель не найдена"))
+		return nil, false
+	}
+	if goal.UserID != user.ID {
+		h.answerCallback(ctx, query, l.t("❌ Изменять цель может только ее автор"))
+		return nil, false
+	}
+	if goal.Status != "active" {
+		h.answerCallback(ctx, query, l.t("❌ Изменить можно только активную цель, по которой еще не отправлено доказательство"))
+		return nil, false
+	}
+	return goal, true
+}
+
+// announceGoalChange tells the goal's chat what its author changed
+func (h *BotHandler) announceGoalChange(ctx context.Context, result *service.GoalChangeResult, author *models.User) {
+	goal := result.Goal
+	change := result.Change
+	l := h.chatLocale(ctx, goal.ChatID)
+
+	var text string
+	switch change.Kind {
+	case models.GoalChangeTitle:
+		text = l.f("✏️ @%s изменяет название цели\n\nБыло: %s\nСтало: %s", author.Username, change.OldValue, change.NewValue)
+	case models.GoalChangeDescription:
+		text = l.f("✏️ @%s изменяет описание цели\n\n🎯 %s\n📄 %s", author.Username, goal.Title, change.NewValue)
+	case models.GoalChangeDeadline:
+		text = l.f("📅 @%s продлевает срок цели\n\n🎯 %s\n📅 Было: %s\n📅 Стало: %s",
+			author.Username, goal.Title, changeDeadlineText(change.OldValue), goal.Deadline.Format("02.01.2006"))
+	case models.GoalChangeCancel:
+		text = l.f("🚫 @%s отменяет цель\n\n🎯 %s\n↩️ Возвращено: %d звезд", author.Username, goal.Title, goal.Bet-change.Fee)
+	}
+	if change.Fee > 0 {
+		text += l.f("\n💸 Комиссия %d звезд %s.", change.Fee, penaltyOutcomeText(l, result.PenaltyMode, &goal))
+	}
+
+	if _, err := h.bot.Send(tgbotapi.NewMessage(goal.ChatID, text)); err != nil {
+		slog.ErrorContext(ctx, "Error announcing goal change", "error", err)
+	}
+}
+
+// changeTermsText describes whether and at what cost a goal can still be
+// extended or cancelled
+func changeTermsText(l *locale, goal *models.Goal, terms service.ChangeTerms) string {
+	if terms.Allowed {
+		return l.f("комиссия %d звезд, доступны до %s", terms.Fee, terms.Until.Format("02.01.2006 15:04"))
+	}
+	if terms.Until.After(goal.CreatedAt) {
+		return l.f("были доступны до %s", terms.Until.Format("02.01.2006 15:04"))
+	}
+	return l.t("запрещены в этой беседе")
+}
+
+// goalChangeText describes an audit trail entry
+func goalChangeText(l *locale, change models.GoalChange) string {
+	var text string
+	switch change.Kind {
+	case models.GoalChangeTitle:
+		text = l.f("название: «%s» → «%s»", change.OldValue, change.NewValue)
+	case models.GoalChangeDescription:
+		text = l.t("описание")
+	case models.GoalChangeDeadline:
+		text = l.f("срок: %s → %s", changeDeadlineText(change.OldValue), changeDeadlineText(change.NewValue))
+	case models.GoalChangeCancel:
+		text = l.t("отмена")
+	default:
+		text = change.Kind
+	}
+	if change.Fee > 0 {
+		text += l.f(" (комиссия %d ⭐)", change.Fee)
+	}
+	return text
+}
+
+// changeDeadlineText formats a deadline stored in the audit trail
+func changeDeadlineText(value string) string {
+	deadline, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return value
+	}
+	return deadline.Format("02.01.2006")
+}
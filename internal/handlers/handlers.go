@@ -1,211 +1,310 @@
 package handlers
 
 import (
+	"awesomeProject/internal/logging"
+	"awesomeProject/internal/metrics"
 	"awesomeProject/internal/models"
 	"awesomeProject/internal/service"
+	"context"
+	"encoding/binary"
 	"fmt"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	"log"
+	"hash/fnv"
+	"log/slog"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
-type BotHandler struct {
-	bot        *tgbotapi.BotAPI
-	service    *service.Service
-	userStates map[int64]*UserState
+// conversationLockStripes is the number of mutexes updates are spread over;
+// updates from the same user in the same chat always share a mutex
+const conversationLockStripes = 64
+
+// Sender is the part of the Telegram Bot API used by BotHandler.
+// *tgbotapi.BotAPI implements it.
+type Sender interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+	Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error)
+}
+
+// Config holds the settings BotHandler shows to users
+type Config struct {
+	StartingBalance int // Stars a new user starts with
 }
 
-type UserState struct {
-	Step        string
-	GoalData    *models.Goal
-	Title       string
-	Description string
-	Deadline    time.Time
-	Bet         int
+type BotHandler struct {
+	bot     Sender
+	service *service.Service
+	config  Config
+
+	// locks serializes updates per (chat, user) so a conversation's state is
+	// never read and written by two updates at once
+	locks [conversationLockStripes]sync.Mutex
 }
 
-func NewBotHandler(bot *tgbotapi.BotAPI, service *service.Service) *BotHandler {
+func NewBotHandler(bot Sender, service *service.Service, config Config) *BotHandler {
 	return &BotHandler{
-		bot:        bot,
-		service:    service,
-		userStates: make(map[int64]*UserState),
+		bot:     countingSender{bot},
+		service: service,
+		config:  config,
+	}
+}
+
+// countingSender counts failed Telegram API calls in metrics.TelegramErrors
+type countingSender struct {
+	Sender
+}
+
+func (s countingSender) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	message, err := s.Sender.Send(c)
+	if err != nil {
+		metrics.TelegramErrors.WithLabelValues(requestType(c)).Inc()
+	}
+	return message, err
+}
+
+func (s countingSender) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	resp, err := s.Sender.Request(c)
+	if err != nil {
+		metrics.TelegramErrors.WithLabelValues(requestType(c)).Inc()
 	}
+	return resp, err
 }
 
-func (h *BotHandler) HandleUpdate(update tgbotapi.Update) {
+// requestType names a request by its config type, e.g. "MessageConfig"
+func requestType(c tgbotapi.Chattable) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", c), "tgbotapi.")
+}
+
+// updateType names the kind of update for metrics
+func updateType(update tgbotapi.Update) string {
+	switch {
+	case update.Message != nil:
+		return "message"
+	case update.CallbackQuery != nil:
+		return "callback_query"
+	default:
+		return "other"
+	}
+}
+
+// HandleUpdate processes a single update. It is safe for concurrent use.
+// Cancelling ctx aborts the storage calls the update is still waiting on.
+func (h *BotHandler) HandleUpdate(ctx context.Context, update tgbotapi.Update) {
+	kind := updateType(update)
+	metrics.Updates.WithLabelValues(kind).Inc()
+	defer func(start time.Time) {
+		metrics.HandlerDuration.WithLabelValues(kind).Observe(time.Since(start).Seconds())
+	}(time.Now())
+
+	ctx = logging.With(ctx, logging.UpdateID, update.UpdateID)
+	slog.DebugContext(ctx, "Handling update", "type", kind)
+
 	// Handle messages
-	if update.Message != nil {
-		h.handleMessage(update.Message)
+	if update.Message != nil && update.Message.From != nil {
+		mu := h.conversationLock(update.Message.Chat.ID, update.Message.From.ID)
+		mu.Lock()
+		h.handleMessage(ctx, update.Message)
+		mu.Unlock()
 	}
 
 	// Handle callback queries (buttons)
-	if update.CallbackQuery != nil {
-		h.handleCallbackQuery(update.CallbackQuery)
+	if update.CallbackQuery != nil && update.CallbackQuery.Message != nil {
+		mu := h.conversationLock(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.From.ID)
+		mu.Lock()
+		h.handleCallbackQuery(ctx, update.CallbackQuery)
+		mu.Unlock()
 	}
 }
 
-func (h *BotHandler) handleMessage(message *tgbotapi.Message) {
+// conversationLock returns the mutex guarding a user's conversation in a chat
+func (h *BotHandler) conversationLock(chatID, userID int64) *sync.Mutex {
+	hash := fnv.New32a()
+	_ = binary.Write(hash, binary.LittleEndian, [2]int64{chatID, userID})
+	return &h.locks[hash.Sum32()%conversationLockStripes]
+}
+
+func (h *BotHandler) handleMessage(ctx context.Context, message *tgbotapi.Message) {
+	ctx = logging.With(ctx, logging.ChatID, message.Chat.ID, logging.UserID, message.From.ID)
+
 	// Register user
 	username := message.From.UserName
 	if username == "" {
 		username = message.From.FirstName
 	}
 
-	user, err := h.service.RegisterUser(message.From.ID, username, message.Chat.ID)
+	user, err := h.service.RegisterUser(ctx, message.From.ID, username, message.Chat.ID)
 	if err != nil {
-		log.Printf("Error registering user: %v", err)
+		slog.ErrorContext(ctx, "Error registering user", "error", err)
+		h.notifyTimeout(ctx, message.Chat.ID, err)
+		return
 	}
 
 	// Handle commands
 	if message.IsCommand() {
-		switch message.Command() {
+		command := message.Command()
+		ctx = logging.With(ctx, logging.Command, command)
+		ctx = withLocale(ctx, h.chatLocale(ctx, message.Chat.ID))
+
+		switch command {
 		case "start":
-			h.handleStart(message)
+			h.handleStart(ctx, message)
 		case "help":
-			h.handleHelp(message)
+			h.handleHelp(ctx, message)
 		case "newgoal":
-			h.handleNewGoal(message, user)
+			h.handleNewGoal(ctx, message, user)
 		case "mygoals":
-			h.handleMyGoals(message, user)
+			h.handleMyGoals(ctx, message, user)
+		case "editgoal":
+			h.handleEditGoal(ctx, message, user)
+		case "cancelgoal":
+			h.handleCancelGoal(ctx, message, user)
 		case "goals":
-			h.handleChatGoals(message)
+			h.handleChatGoals(ctx, message)
 		case "stats":
-			h.handleStats(message, user)
+			h.handleStats(ctx, message, user)
+		case "history":
+			h.handleHistory(ctx, message, user)
+		case "top":
+			h.handleTop(ctx, message)
 		case "cancel":
-			h.handleCancel(message)
+			h.handleCancel(ctx, message)
+		case "settings":
+			h.handleSettings(ctx, message)
+		case "treasury":
+			h.handleTreasury(ctx, message)
+		case "payout":
+			h.handlePayout(ctx, message)
+		default:
+			// Keep arbitrary user input out of metric labels
+			command = "unknown"
 		}
+		metrics.Commands.WithLabelValues(command).Inc()
 		return
 	}
 
 	// Handle state-based input
-	if state, exists := h.userStates[message.From.ID]; exists {
-		h.handleStateInput(message, state, user)
+	state, err := h.service.GetConversationState(ctx, message.Chat.ID, message.From.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error loading conversation state", "error", err)
+		h.notifyTimeout(ctx, message.Chat.ID, err)
+		return
+	}
+	if state != nil {
+		ctx = withLocale(ctx, h.chatLocale(ctx, message.Chat.ID))
+		h.handleStateInput(ctx, message, state, user)
 	}
 }
 
-func (h *BotHandler) handleStart(message *tgbotapi.Message) {
-	text := `👋 Привет! Я бот для постановки целей с ответственностью.
-
-🎯 Как это работает:
-1. Создай цель с помощью /newgoal
-2. Укажи название, описание, срок и ставку в звездах
-3. После достижения цели отправь доказательство
-4. Участники беседы проголосуют за выполнение
-5. Если цель выполнена - ты сохраняешь звезды
-6. Если нет - звезды распределятся между участниками
-
-📋 Команды:
-/newgoal - Создать новую цель
-/mygoals - Мои активные цели
-/goals - Все цели в беседе
-/stats - Моя статистика
-/help - Помощь`
-
-	msg := tgbotapi.NewMessage(message.Chat.ID, text)
-	h.bot.Send(msg)
+func (h *BotHandler) handleStart(ctx context.Context, message *tgbotapi.Message) {
+	msg := tgbotapi.NewMessage(message.Chat.ID, localeFrom(ctx).start)
+	h.send(ctx, msg)
 }
 
-func (h *BotHandler) handleHelp(message *tgbotapi.Message) {
-	text := `📖 Помощь
-
-📋 Команды:
-/newgoal - Создать новую цель
-/mygoals - Посмотреть свои активные цели
-/goals - Посмотреть все цели в беседе
-/stats - Моя статистика
-/cancel - Отменить текущее действие
-
-💡 Советы:
-• Ставьте реалистичные цели
-• Сохраняйте доказательства выполнения
-• Голосуйте честно за цели других участников
-• Начальный баланс: 100 звезд`
+func (h *BotHandler) handleHelp(ctx context.Context, message *tgbotapi.Message) {
+	text := fmt.Sprintf(localeFrom(ctx).help, h.config.StartingBalance)
 
 	msg := tgbotapi.NewMessage(message.Chat.ID, text)
-	h.bot.Send(msg)
+	h.send(ctx, msg)
 }
 
-func (h *BotHandler) handleNewGoal(message *tgbotapi.Message, _ *models.User) {
-	h.userStates[message.From.ID] = &UserState{
+func (h *BotHandler) handleNewGoal(ctx context.Context, message *tgbotapi.Message, _ *models.User) {
+	h.saveState(ctx, message.Chat.ID, message.From.ID, &models.ConversationState{
 		Step: "awaiting_title",
-	}
+	})
 
-	msg := tgbotapi.NewMessage(message.Chat.ID, "📝 Введите название цели:")
-	_, _ = h.bot.Send(msg)
+	msg := tgbotapi.NewMessage(message.Chat.ID, localeFrom(ctx).t("📝 Введите название цели:"))
+	h.send(ctx, msg)
 }
 
-func (h *BotHandler) handleStateInput(message *tgbotapi.Message, state *UserState, user *models.User) {
+func (h *BotHandler) handleStateInput(ctx context.Context, message *tgbotapi.Message, state *models.ConversationState, user *models.User) {
+	l := localeFrom(ctx)
+
 	switch state.Step {
 	case "awaiting_title":
 		state.Title = message.Text
 		state.Step = "awaiting_description"
-		msg := tgbotapi.NewMessage(message.Chat.ID, "📄 Введите описание цели:")
-		_, _ = h.bot.Send(msg)
+		h.saveState(ctx, message.Chat.ID, message.From.ID, state)
+		msg := tgbotapi.NewMessage(message.Chat.ID, l.t("📄 Введите описание цели:"))
+		h.send(ctx, msg)
 
 	case "awaiting_description":
 		state.Description = message.Text
 		state.Step = "awaiting_deadline"
-		msg := tgbotapi.NewMessage(message.Chat.ID, "📅 Введите срок выполнения (формат: 2024-12-31 или количество дней, например: 7):")
-		_, _ = h.bot.Send(msg)
+		h.saveState(ctx, message.Chat.ID, message.From.ID, state)
+		msg := tgbotapi.NewMessage(message.Chat.ID, l.t("📅 Введите срок выполнения (формат: 2024-12-31 или количество дней, например: 7):"))
+		h.send(ctx, msg)
 
 	case "awaiting_deadline":
 		deadline, err := h.parseDeadline(message.Text)
 		if err != nil {
-			msg := tgbotapi.NewMessage(message.Chat.ID, "❌ Неверный формат даты. Используйте формат YYYY-MM-DD или количество дней (например: 7)")
-			_, _ = h.bot.Send(msg)
+			msg := tgbotapi.NewMessage(message.Chat.ID, l.t("❌ Неверный формат даты. Используйте формат YYYY-MM-DD или количество дней (например: 7)"))
+			h.send(ctx, msg)
 			return
 		}
 		state.Deadline = deadline
 		state.Step = "awaiting_bet"
+		h.saveState(ctx, message.Chat.ID, message.From.ID, state)
 
 		// Get fresh user data to show current balance
-		freshUser, err := h.service.GetOrCreateUser(message.From.ID, message.From.UserName)
+		freshUser, err := h.service.GetOrCreateUser(ctx, message.From.ID, message.From.UserName)
 		if err != nil {
-			log.Printf("Error getting user: %v", err)
-			msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("⭐ Введите ставку в звездах:"))
-			_, _ = h.bot.Send(msg)
+			slog.ErrorContext(ctx, "Error getting user", "error", err)
+			msg := tgbotapi.NewMessage(message.Chat.ID, l.t("⭐ Введите ставку в звездах:"))
+			h.send(ctx, msg)
 		} else {
-			msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("⭐ Введите ставку в звездах (ваш баланс: %d):", freshUser.Balance))
-			_, _ = h.bot.Send(msg)
+			msg := tgbotapi.NewMessage(message.Chat.ID, l.f("⭐ Введите ставку в звездах (ваш баланс: %d):", freshUser.Balance))
+			h.send(ctx, msg)
 		}
 
 	case "awaiting_bet":
 		bet, err := strconv.Atoi(message.Text)
 		if err != nil || bet <= 0 {
-			msg := tgbotapi.NewMessage(message.Chat.ID, "❌ Неверное значение. Введите положительное число:")
-			_, _ = h.bot.Send(msg)
+			msg := tgbotapi.NewMessage(message.Chat.ID, l.t("❌ Неверное значение. Введите положительное число:"))
+			h.send(ctx, msg)
 			return
 		}
 
 		// Get fresh user data to check current balance
-		freshUser, err := h.service.GetOrCreateUser(message.From.ID, message.From.UserName)
+		freshUser, err := h.service.GetOrCreateUser(ctx, message.From.ID, message.From.UserName)
+		if err != nil {
+			msg := tgbotapi.NewMessage(message.Chat.ID, l.errorText("❌ Ошибка получения данных пользователя: %v", err))
+			h.send(ctx, msg)
+			h.clearState(ctx, message.Chat.ID, message.From.ID)
+			return
+		}
+
+		settings, err := h.service.ChatSettings(ctx, message.Chat.ID)
 		if err != nil {
-			msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ Ошибка получения данных пользователя: %v", err))
-			_, _ = h.bot.Send(msg)
-			delete(h.userStates, message.From.ID)
+			msg := tgbotapi.NewMessage(message.Chat.ID, l.errorText("❌ Ошибка получения настроек беседы: %v", err))
+			h.send(ctx, msg)
+			return
+		}
+		if bet < settings.MinBet || (settings.MaxBet > 0 && bet > settings.MaxBet) {
+			msg := tgbotapi.NewMessage(message.Chat.ID, "❌ "+betLimitsText(l, settings))
+			h.send(ctx, msg)
 			return
 		}
 
 		if bet > freshUser.Balance {
-			msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ Недостаточно звезд. У вас: %d", freshUser.Balance))
-			_, _ = h.bot.Send(msg)
+			msg := tgbotapi.NewMessage(message.Chat.ID, l.f("❌ Недостаточно звезд. У вас: %d", freshUser.Balance))
+			h.send(ctx, msg)
 			return
 		}
 
 		state.Bet = bet
 
 		// Create goal - use freshUser.ID
-		goal, err := h.service.CreateGoal(freshUser.ID, message.Chat.ID, state.Title, state.Description, state.Deadline, state.Bet)
+		goal, err := h.service.CreateGoal(ctx, freshUser.ID, message.Chat.ID, state.Title, state.Description, state.Deadline, state.Bet)
 		if err != nil {
-			msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ Ошибка создания цели: %v", err))
-			_, _ = h.bot.Send(msg)
-			delete(h.userStates, message.From.ID)
+			msg := tgbotapi.NewMessage(message.Chat.ID, l.errorText("❌ Ошибка создания цели: %v", err))
+			h.send(ctx, msg)
+			h.clearState(ctx, message.Chat.ID, message.From.ID)
 			return
 		}
 
-		text := fmt.Sprintf(`✅ Цель создана!
+		text := l.f(`✅ Цель создана!
 
 🎯 %s
 📄 %s
@@ -220,72 +319,192 @@ func (h *BotHandler) handleStateInput(message *tgbotapi.Message, state *UserStat
 		)
 
 		msg := tgbotapi.NewMessage(message.Chat.ID, text)
-		_, _ = h.bot.Send(msg)
+		h.send(ctx, msg)
+
+		h.clearState(ctx, message.Chat.ID, message.From.ID)
 
-		delete(h.userStates, message.From.ID)
+	case "editing_title", "editing_description", "editing_deadline":
+		h.handleEditInput(ctx, message, state, user)
 
 	case "awaiting_proof":
 		// Handle proof submission
-		if state.GoalData != nil {
-			err := h.service.SubmitProof(state.GoalData.ID, message.Text)
-			if err != nil {
-				msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ Ошибка: %v", err))
-				_, _ = h.bot.Send(msg)
-				return
-			}
-
-			// Get fresh user data for username
-			freshUser, err := h.service.GetOrCreateUser(message.From.ID, message.From.UserName)
-			if err != nil {
-				freshUser = user // fallback to cached user
-			}
-
-			// Send notification to chat with voting buttons
-			text := fmt.Sprintf(`📢 @%s отправил доказательство выполнения цели:
+		ctx = logging.With(ctx, logging.GoalID, state.GoalID)
+		goal, err := h.service.GetGoal(ctx, state.GoalID)
+		if service.IsTimeout(err) {
+			// Keep the state so the proof can simply be sent again
+			h.send(ctx, tgbotapi.NewMessage(message.Chat.ID, l.t(retryText)))
+			return
+		}
+		if err != nil {
+			msg := tgbotapi.NewMessage(message.Chat.ID, l.t("❌ Цель не найдена"))
+			h.send(ctx, msg)
+			h.clearState(ctx, message.Chat.ID, message.From.ID)
+			return
+		}
+
+		proof, ok := extractProof(message)
+		if !ok {
+			msg := tgbotapi.NewMessage(message.Chat.ID, l.t("❌ Отправьте текст, фото, видео, документ, голосовое сообщение или видеосообщение:"))
+			h.send(ctx, msg)
+			return
+		}
+
+		err = h.service.SubmitProof(ctx, goal.ID, user.ID, message.Chat.ID, proof)
+		if err != nil {
+			msg := tgbotapi.NewMessage(message.Chat.ID, l.errorText("❌ Ошибка: %v", err))
+			h.send(ctx, msg)
+			return
+		}
+
+		// Get fresh user data for username
+		freshUser, err := h.service.GetOrCreateUser(ctx, message.From.ID, message.From.UserName)
+		if err != nil {
+			freshUser = user // fallback to cached user
+		}
+
+		proofText := proof.Caption
+		if proofText == "" {
+			proofText = l.t("см. вложение")
+		}
+
+		votingEnds := ""
+		if updated, err := h.service.GetGoal(ctx, goal.ID); err == nil && updated.VotingEndsAt != nil {
+			votingEnds = l.f("\n⏳ Голосование открыто до %s\n", updated.VotingEndsAt.Format("02.01.2006 15:04"))
+		}
+
+		// Send notification to chat with voting buttons
+		text := l.f(`📢 @%s отправил доказательство выполнения цели:
 
 🎯 %s
 📄 %s
 💬 Доказательство: %s
-
+%s
 Голосуйте за выполнение:`,
-				freshUser.Username,
-				state.GoalData.Title,
-				state.GoalData.Description,
-				message.Text,
-			)
-
-			// Create inline keyboard with voting buttons
-			keyboard := tgbotapi.NewInlineKeyboardMarkup(
-				tgbotapi.NewInlineKeyboardRow(
-					tgbotapi.NewInlineKeyboardButtonData("✅ Выполнено", fmt.Sprintf("vote_yes_%d", state.GoalData.ID)),
-					tgbotapi.NewInlineKeyboardButtonData("❌ Не выполнено", fmt.Sprintf("vote_no_%d", state.GoalData.ID)),
-				),
-			)
+			freshUser.Username,
+			goal.Title,
+			goal.Description,
+			proofText,
+			votingEnds,
+		)
+
+		// Create inline keyboard with voting buttons
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(l.t("✅ Выполнено"), fmt.Sprintf("vote_yes_%d", goal.ID)),
+				tgbotapi.NewInlineKeyboardButtonData(l.t("❌ Не выполнено"), fmt.Sprintf("vote_no_%d", goal.ID)),
+			),
+		)
+
+		h.sendProof(ctx, message.Chat.ID, proof, text, keyboard)
+
+		h.clearState(ctx, message.Chat.ID, message.From.ID)
+	}
+}
+
+// extractProof converts a message of any supported type into a proof
+func extractProof(message *tgbotapi.Message) (models.Proof, bool) {
+	proof := models.Proof{Caption: message.Caption}
+
+	switch {
+	case len(message.Photo) > 0:
+		// Telegram sends several sizes, the last one is the largest
+		proof.Kind = models.ProofPhoto
+		proof.FileID = message.Photo[len(message.Photo)-1].FileID
+	case message.Video != nil:
+		proof.Kind = models.ProofVideo
+		proof.FileID = message.Video.FileID
+	case message.Document != nil:
+		proof.Kind = models.ProofDocument
+		proof.FileID = message.Document.FileID
+	case message.Voice != nil:
+		proof.Kind = models.ProofVoice
+		proof.FileID = message.Voice.FileID
+	case message.VideoNote != nil:
+		proof.Kind = models.ProofVideoNote
+		proof.FileID = message.VideoNote.FileID
+	case message.Text != "":
+		proof.Kind = models.ProofText
+		proof.Caption = message.Text
+	default:
+		return models.Proof{}, false
+	}
+
+	return proof, true
+}
 
-			msg := tgbotapi.NewMessage(message.Chat.ID, text)
-			msg.ReplyMarkup = keyboard
-			_, _ = h.bot.Send(msg)
+// sendProof posts the voting message. Media proofs are re-sent with the
+// voting text as caption so voters see the evidence itself; video notes
+// cannot carry a caption and overly long texts do not fit in one, so in those
+// cases the media and the voting message are sent separately.
+func (h *BotHandler) sendProof(ctx context.Context, chatID int64, proof models.Proof, text string, keyboard tgbotapi.InlineKeyboardMarkup) {
+	const maxCaptionLength = 1024
+
+	var media tgbotapi.Chattable
+	captioned := len([]rune(text)) <= maxCaptionLength
+
+	switch proof.Kind {
+	case models.ProofPhoto:
+		cfg := tgbotapi.NewPhoto(chatID, tgbotapi.FileID(proof.FileID))
+		if captioned {
+			cfg.Caption, cfg.ReplyMarkup = text, keyboard
+		}
+		media = cfg
+	case models.ProofVideo:
+		cfg := tgbotapi.NewVideo(chatID, tgbotapi.FileID(proof.FileID))
+		if captioned {
+			cfg.Caption, cfg.ReplyMarkup = text, keyboard
+		}
+		media = cfg
+	case models.ProofDocument:
+		cfg := tgbotapi.NewDocument(chatID, tgbotapi.FileID(proof.FileID))
+		if captioned {
+			cfg.Caption, cfg.ReplyMarkup = text, keyboard
+		}
+		media = cfg
+	case models.ProofVoice:
+		cfg := tgbotapi.NewVoice(chatID, tgbotapi.FileID(proof.FileID))
+		if captioned {
+			cfg.Caption, cfg.ReplyMarkup = text, keyboard
+		}
+		media = cfg
+	case models.ProofVideoNote:
+		media = tgbotapi.NewVideoNote(chatID, 0, tgbotapi.FileID(proof.FileID))
+		captioned = false
+	default:
+		captioned = false
+	}
 
-			delete(h.userStates, message.From.ID)
+	if media != nil {
+		if !h.send(ctx, media) {
+			captioned = false
+		}
+		if captioned {
+			return
 		}
 	}
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = keyboard
+	h.send(ctx, msg)
 }
 
-func (h *BotHandler) handleMyGoals(message *tgbotapi.Message, user *models.User) {
-	goals, err := h.service.GetUserActiveGoals(user.ID)
+func (h *BotHandler) handleMyGoals(ctx context.Context, message *tgbotapi.Message, user *models.User) {
+	l := localeFrom(ctx)
+
+	goals, err := h.service.GetUserActiveGoals(ctx, user.ID)
 	if err != nil {
-		msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ Ошибка: %v", err))
-		_, _ = h.bot.Send(msg)
+		msg := tgbotapi.NewMessage(message.Chat.ID, l.errorText("❌ Ошибка: %v", err))
+		h.send(ctx, msg)
 		return
 	}
 
 	if len(goals) == 0 {
-		msg := tgbotapi.NewMessage(message.Chat.ID, "У вас нет активных целей. Создайте новую с помощью /newgoal")
-		_, _ = h.bot.Send(msg)
+		msg := tgbotapi.NewMessage(message.Chat.ID, l.t("У вас нет активных целей. Создайте новую с помощью /newgoal"))
+		h.send(ctx, msg)
 		return
 	}
 
-	text := "📋 Ваши активные цели:\n\n"
+	text := l.t("📋 Ваши активные цели:\n\n")
 
 	var buttons [][]tgbotapi.InlineKeyboardButton
 	for i, goal := range goals {
@@ -305,9 +524,12 @@ func (h *BotHandler) handleMyGoals(message *tgbotapi.Message, user *models.User)
 		if goal.Status == "active" {
 			buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
 				tgbotapi.NewInlineKeyboardButtonData(
-					fmt.Sprintf("✅ Отправить доказательство #%d", i+1),
+					l.f("✅ Отправить доказательство #%d", i+1),
 					fmt.Sprintf("proof_%d", goal.ID),
 				),
+			), tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(l.f("✏️ Изменить #%d", i+1), fmt.Sprintf("edit_%d", goal.ID)),
+				tgbotapi.NewInlineKeyboardButtonData(l.f("🚫 Отменить #%d", i+1), fmt.Sprintf("cancelgoal_%d", goal.ID)),
 			))
 		}
 	}
@@ -316,40 +538,44 @@ func (h *BotHandler) handleMyGoals(message *tgbotapi.Message, user *models.User)
 	if len(buttons) > 0 {
 		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(buttons...)
 	}
-	_, _ = h.bot.Send(msg)
+	h.send(ctx, msg)
 }
 
-func (h *BotHandler) handleChatGoals(message *tgbotapi.Message) {
-	goals, err := h.service.GetActiveGoalsByChat(message.Chat.ID)
+func (h *BotHandler) handleChatGoals(ctx context.Context, message *tgbotapi.Message) {
+	l := localeFrom(ctx)
+
+	goals, err := h.service.GetActiveGoalsByChat(ctx, message.Chat.ID)
 	if err != nil {
-		msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ Ошибка: %v", err))
-		_, _ = h.bot.Send(msg)
+		msg := tgbotapi.NewMessage(message.Chat.ID, l.errorText("❌ Ошибка: %v", err))
+		h.send(ctx, msg)
 		return
 	}
 
 	if len(goals) == 0 {
-		msg := tgbotapi.NewMessage(message.Chat.ID, "В этой беседе нет активных целей.")
-		_, _ = h.bot.Send(msg)
+		msg := tgbotapi.NewMessage(message.Chat.ID, l.t("В этой беседе нет активных целей."))
+		h.send(ctx, msg)
 		return
 	}
 
-	text := "📋 Активные цели в беседе:\n\n"
+	text := l.t("📋 Активные цели в беседе:\n\n")
 	for i, goal := range goals {
-		// Get user info
-		user, _ := h.service.GetUserByID(int64(goal.UserID))
+		author := l.t("участник")
+		if user, err := h.service.GetUserByID(ctx, int64(goal.UserID)); err == nil {
+			author = "@" + user.Username
+		}
 
 		statusEmoji := "🔄"
-		statusText := "Активна"
+		statusText := l.t("Активна")
 		if goal.Status == "done_pending" {
 			statusEmoji = "⏳"
-			statusText = "На голосовании"
+			statusText = l.t("На голосовании")
 		}
 
-		text += fmt.Sprintf("%d. %s %s\n   👤 @%s\n   📅 %s | ⭐ %d | %s\n\n",
+		text += fmt.Sprintf("%d. %s %s\n   👤 %s\n   📅 %s | ⭐ %d | %s\n\n",
 			i+1,
 			statusEmoji,
 			goal.Title,
-			user.Username,
+			author,
 			goal.Deadline.Format("02.01.2006"),
 			goal.Bet,
 			statusText,
@@ -357,28 +583,191 @@ func (h *BotHandler) handleChatGoals(message *tgbotapi.Message) {
 	}
 
 	msg := tgbotapi.NewMessage(message.Chat.ID, text)
-	_, _ = h.bot.Send(msg)
+	h.send(ctx, msg)
 }
 
-func (h *BotHandler) handleStats(message *tgbotapi.Message, user *models.User) {
-	stats, err := h.service.GetUserStats(user.ID)
+func (h *BotHandler) handleStats(ctx context.Context, message *tgbotapi.Message, user *models.User) {
+	l := localeFrom(ctx)
+
+	stats, err := h.service.GetUserStats(ctx, user.ID)
 	if err != nil {
-		msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ Ошибка: %v", err))
-		h.bot.Send(msg)
+		msg := tgbotapi.NewMessage(message.Chat.ID, l.errorText("❌ Ошибка: %v", err))
+		h.send(ctx, msg)
 		return
 	}
 
-	msg := tgbotapi.NewMessage(message.Chat.ID, stats)
-	h.bot.Send(msg)
+	text := l.f("👤 Статистика\n⭐ Доступно: %d звезд\n🔒 В ставках: %d звезд\n📋 Активных целей: %d\n",
+		stats.Balance, stats.LockedBalance, stats.ActiveGoals)
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	h.send(ctx, msg)
 }
 
-func (h *BotHandler) handleCancel(message *tgbotapi.Message) {
-	delete(h.userStates, message.From.ID)
-	msg := tgbotapi.NewMessage(message.Chat.ID, "❌ Действие отменено.")
-	h.bot.Send(msg)
+func (h *BotHandler) handleHistory(ctx context.Context, message *tgbotapi.Message, user *models.User) {
+	text, keyboard, err := h.renderHistory(ctx, user, 0)
+	if err != nil {
+		msg := tgbotapi.NewMessage(message.Chat.ID, localeFrom(ctx).errorText("❌ Ошибка: %v", err))
+		h.send(ctx, msg)
+		return
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	if keyboard != nil {
+		msg.ReplyMarkup = *keyboard
+	}
+	h.send(ctx, msg)
 }
 
-func (h *BotHandler) handleCallbackQuery(query *tgbotapi.CallbackQuery) {
+// renderHistory builds the text and pagination buttons for a history page
+func (h *BotHandler) renderHistory(ctx context.Context, user *models.User, page int) (string, *tgbotapi.InlineKeyboardMarkup, error) {
+	l := localeFrom(ctx)
+
+	entries, pages, err := h.service.GetUserHistory(ctx, user.ID, page)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(entries) == 0 {
+		return l.t("📜 У вас пока нет операций со звездами."), nil, nil
+	}
+
+	text := l.f("📜 История операций @%s (стр. %d/%d):\n\n", user.Username, page+1, pages)
+	escrow := false
+	for _, entry := range entries {
+		text += historyEntryText(l, entry)
+		escrow = escrow || entry.Reason == "escrow_lock" || isEscrowReturn(entry.Reason)
+	}
+	if escrow {
+		text += l.t("🔒 и 🔓 — ставка блокируется и возвращается, общий баланс от этого не меняется\n")
+	}
+
+	var row []tgbotapi.InlineKeyboardButton
+	if page > 0 {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(l.t("⬅️ Назад"), fmt.Sprintf("history_%d_%d", user.ID, page-1)))
+	}
+	if page < pages-1 {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(l.t("Вперед ➡️"), fmt.Sprintf("history_%d_%d", user.ID, page+1)))
+	}
+	if len(row) == 0 {
+		return text, nil, nil
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(row)
+	return text, &keyboard, nil
+}
+
+// historyEntryText renders a transaction in /history or the /treasury ledger.
+// Escrow entries only move stars between the user's available and locked
+// balance, so they get their own signs and the ➕ and ➖ entries alone add up
+// to the change of the user's total balance.
+func historyEntryText(l *locale, entry models.HistoryEntry) string {
+	var sign string
+	switch {
+	case entry.Reason == "escrow_lock":
+		sign = "🔒"
+	case isEscrowReturn(entry.Reason):
+		sign = "🔓"
+	case entry.Incoming:
+		sign = "➕"
+	default:
+		sign = "➖"
+	}
+
+	text := fmt.Sprintf("%s %d ⭐ — %s\n", sign, entry.Amount, transactionReasonText(l, entry.Reason))
+	if entry.Counterparty != "" {
+		text += fmt.Sprintf("   👤 @%s\n", entry.Counterparty)
+	}
+	if entry.GoalTitle != "" {
+		text += fmt.Sprintf("   🎯 %s\n", entry.GoalTitle)
+	}
+	text += fmt.Sprintf("   🕒 %s\n\n", entry.CreatedAt.Format("02.01.2006 15:04"))
+	return text
+}
+
+func (h *BotHandler) handleTop(ctx context.Context, message *tgbotapi.Message) {
+	text, keyboard, err := h.renderLeaderboard(ctx, message.Chat.ID, models.LeaderboardBalance)
+	if err != nil {
+		msg := tgbotapi.NewMessage(message.Chat.ID, localeFrom(ctx).errorText("❌ Ошибка: %v", err))
+		h.send(ctx, msg)
+		return
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	msg.ReplyMarkup = keyboard
+	h.send(ctx, msg)
+}
+
+// leaderboardTitles describes each leaderboard metric, in button order; the
+// titles are translated when rendered
+var leaderboardTitles = []struct {
+	metric string
+	title  string
+}{
+	{models.LeaderboardBalance, "⭐ Баланс"},
+	{models.LeaderboardSuccess, "✅ Цели"},
+	{models.LeaderboardRate, "📈 Успешность"},
+	{models.LeaderboardWon, "💰 Выигрыш"},
+}
+
+// renderLeaderboard builds the /top text for a metric and the metric switcher
+func (h *BotHandler) renderLeaderboard(ctx context.Context, chatID int64, metric string) (string, tgbotapi.InlineKeyboardMarkup, error) {
+	l := localeFrom(ctx)
+
+	var row []tgbotapi.InlineKeyboardButton
+	var title string
+	for _, t := range leaderboardTitles {
+		label := l.t(t.title)
+		if t.metric == metric {
+			title = label
+			label = "• " + label + " •"
+		}
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(label, "top_"+t.metric))
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(row)
+
+	entries, err := h.service.GetLeaderboard(ctx, chatID, metric)
+	if err != nil {
+		return "", keyboard, err
+	}
+
+	if len(entries) == 0 {
+		return l.t("🏆 В беседе пока нет участников."), keyboard, nil
+	}
+
+	medals := []string{"🥇", "🥈", "🥉"}
+	text := l.f("🏆 Рейтинг участников: %s\n\n", title)
+	for i, entry := range entries {
+		place := fmt.Sprintf("%d.", i+1)
+		if i < len(medals) {
+			place = medals[i]
+		}
+
+		var value string
+		switch metric {
+		case models.LeaderboardBalance:
+			value = fmt.Sprintf("%d ⭐ (🔒 %d)", entry.User.Balance+entry.User.LockedBalance, entry.User.LockedBalance)
+		case models.LeaderboardSuccess:
+			value = fmt.Sprintf("%d %s", entry.Succeeded, l.plural(entry.Succeeded, "цель", "цели", "целей"))
+		case models.LeaderboardRate:
+			value = l.f("%.0f%% (%d из %d)", entry.SuccessRate*100, entry.Succeeded, entry.Resolved)
+		case models.LeaderboardWon:
+			value = fmt.Sprintf("%d ⭐", entry.StarsWon)
+		}
+
+		text += fmt.Sprintf("%s @%s — %s\n", place, entry.User.Username, value)
+	}
+
+	return text, keyboard, nil
+}
+
+func (h *BotHandler) handleCancel(ctx context.Context, message *tgbotapi.Message) {
+	h.clearState(ctx, message.Chat.ID, message.From.ID)
+	msg := tgbotapi.NewMessage(message.Chat.ID, localeFrom(ctx).t("❌ Действие отменено."))
+	h.send(ctx, msg)
+}
+
+func (h *BotHandler) handleCallbackQuery(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	ctx = logging.With(ctx, logging.ChatID, query.Message.Chat.ID, logging.UserID, query.From.ID)
+
 	parts := strings.Split(query.Data, "_")
 
 	if len(parts) < 2 {
@@ -386,15 +775,20 @@ func (h *BotHandler) handleCallbackQuery(query *tgbotapi.CallbackQuery) {
 	}
 
 	action := parts[0]
+	ctx = withLocale(ctx, h.chatLocale(ctx, query.Message.Chat.ID))
+	l := localeFrom(ctx)
 
 	// Get user
 	username := query.From.UserName
 	if username == "" {
 		username = query.From.FirstName
 	}
-	user, err := h.service.RegisterUser(query.From.ID, username, query.Message.Chat.ID)
+	user, err := h.service.RegisterUser(ctx, query.From.ID, username, query.Message.Chat.ID)
 	if err != nil {
-		log.Printf("Error registering user: %v", err)
+		slog.ErrorContext(ctx, "Error registering user", "error", err)
+		if service.IsTimeout(err) {
+			h.answerCallback(ctx, query, l.t(retryText))
+		}
 		return
 	}
 
@@ -402,20 +796,29 @@ func (h *BotHandler) handleCallbackQuery(query *tgbotapi.CallbackQuery) {
 	case "proof":
 		// User wants to submit proof
 		goalID, _ := strconv.Atoi(parts[1])
-		goal, err := h.service.GetGoal(goalID)
+		ctx = logging.With(ctx, logging.GoalID, goalID)
+		goal, err := h.service.GetGoal(ctx, goalID)
+		if service.IsTimeout(err) {
+			h.answerCallback(ctx, query, l.t(retryText))
+			return
+		}
 		if err != nil {
-			h.answerCallback(query, "❌ Цель не найдена")
+			h.answerCallback(ctx, query, l.t("❌ Цель не найдена"))
 			return
 		}
-
-		h.userStates[query.From.ID] = &UserState{
-			Step:     "awaiting_proof",
-			GoalData: goal,
+		if err := service.CheckProof(goal, user.ID, query.Message.Chat.ID); err != nil {
+			h.answerCallback(ctx, query, l.errorText("❌ %v", err))
+			return
 		}
 
-		msg := tgbotapi.NewMessage(query.Message.Chat.ID, "📝 Отправьте доказательство выполнения цели (текст, фото, ссылка):")
-		_, _ = h.bot.Send(msg)
-		h.answerCallback(query, "")
+		h.saveState(ctx, query.Message.Chat.ID, query.From.ID, &models.ConversationState{
+			Step:   "awaiting_proof",
+			GoalID: goal.ID,
+		})
+
+		msg := tgbotapi.NewMessage(query.Message.Chat.ID, l.t("📝 Отправьте доказательство выполнения цели (текст, ссылка, фото, видео, документ, голосовое или видеосообщение):"))
+		h.send(ctx, msg)
+		h.answerCallback(ctx, query, "")
 
 	case "vote":
 		// User is voting
@@ -425,32 +828,260 @@ func (h *BotHandler) handleCallbackQuery(query *tgbotapi.CallbackQuery) {
 
 		voteType := parts[1] // "yes" or "no"
 		goalID, _ := strconv.Atoi(parts[2])
+		ctx = logging.With(ctx, logging.GoalID, goalID)
 
 		vote := voteType == "yes"
-		err := h.service.VoteOnGoal(goalID, user.ID, vote)
+		err := h.service.VoteOnGoal(ctx, goalID, user.ID, vote)
 		if err != nil {
-			h.answerCallback(query, fmt.Sprintf("❌ %v", err))
+			h.answerCallback(ctx, query, l.errorText("❌ %v", err))
 			return
 		}
 
 		// Check if voting is complete and finalize
-		result, err := h.service.FinalizeGoal(goalID, query.Message.Chat.ID)
+		tally, err := h.service.FinalizeGoal(ctx, goalID, query.Message.Chat.ID)
 		if err != nil {
-			h.answerCallback(query, "✅ Голос учтен")
+			h.answerCallback(ctx, query, l.errorText("❌ %v", err))
 			return
 		}
 
 		// Send result to chat
-		msg := tgbotapi.NewMessage(query.Message.Chat.ID, result)
-		_, _ = h.bot.Send(msg)
+		msg := tgbotapi.NewMessage(query.Message.Chat.ID, voteTallyText(l, tally))
+		h.send(ctx, msg)
+
+		h.answerCallback(ctx, query, l.t("✅ Голос учтен"))
+
+	case "top":
+		// User switched the leaderboard metric
+		text, keyboard, err := h.renderLeaderboard(ctx, query.Message.Chat.ID, parts[1])
+		if err != nil {
+			h.answerCallback(ctx, query, l.errorText("❌ %v", err))
+			return
+		}
+
+		edit := tgbotapi.NewEditMessageTextAndMarkup(query.Message.Chat.ID, query.Message.MessageID, text, keyboard)
+		h.send(ctx, edit)
+		h.answerCallback(ctx, query, "")
+
+	case "set":
+		// Admin is navigating the /settings menu
+		h.handleSettingsCallback(ctx, query, parts[1:])
+
+	case "treasury":
+		// Someone is paging through the treasury ledger
+		page, _ := strconv.Atoi(parts[1])
+		text, keyboard, err := h.renderTreasury(ctx, query.Message.Chat.ID, page)
+		if err != nil {
+			h.answerCallback(ctx, query, l.errorText("❌ %v", err))
+			return
+		}
+
+		edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, text)
+		edit.ReplyMarkup = keyboard
+		h.send(ctx, edit)
+		h.answerCallback(ctx, query, "")
+
+	case "pay":
+		// Admin is paying out the treasury
+		h.handlePayoutCallback(ctx, query, parts[1:])
+
+	case "edit":
+		// Author is editing a goal
+		h.handleEditCallback(ctx, query, user, parts[1:])
+
+	case "cancelgoal":
+		// Author is cancelling a goal
+		h.handleCancelGoalCallback(ctx, query, user, parts[1:])
+
+	case "history":
+		// User is paging through their transaction history
+		if len(parts) < 3 {
+			return
+		}
+
+		ownerID, _ := strconv.Atoi(parts[1])
+		page, _ := strconv.Atoi(parts[2])
+		if ownerID != user.ID {
+			h.answerCallback(ctx, query, l.t("❌ Это не ваша история. Используйте /history"))
+			return
+		}
+
+		text, keyboard, err := h.renderHistory(ctx, user, page)
+		if err != nil {
+			h.answerCallback(ctx, query, l.errorText("❌ %v", err))
+			return
+		}
+
+		edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, text)
+		edit.ReplyMarkup = keyboard
+		h.send(ctx, edit)
+		h.answerCallback(ctx, query, "")
+	}
+}
+
+// NotifyGoalExpired announces in the goal's chat that its deadline passed
+func (h *BotHandler) NotifyGoalExpired(ctx context.Context, expired service.ExpiredGoal) {
+	goal := expired.Goal
+	ctx = logging.With(ctx, logging.ChatID, goal.ChatID, logging.GoalID, goal.ID)
+	l := h.chatLocale(ctx, goal.ChatID)
+
+	author := l.t("участник")
+	if user, err := h.service.GetUserByID(ctx, int64(goal.UserID)); err == nil {
+		author = "@" + user.Username
+	}
+
+	text := l.f(`⌛ Срок цели истек!
+
+🎯 %s
+👤 %s
+📅 Срок: %s
+
+❌ Доказательство не было отправлено вовремя. Ставка %d звезд %s.`,
+		goal.Title,
+		author,
+		goal.Deadline.Format("02.01.2006"),
+		goal.Bet,
+		penaltyOutcomeText(l, expired.PenaltyMode, &goal),
+	)
+
+	msg := tgbotapi.NewMessage(goal.ChatID, text)
+	if _, err := h.bot.Send(msg); err != nil {
+		slog.ErrorContext(ctx, "Error sending expiration notice", "error", err)
+	}
+}
+
+// NotifyDeadlineReminder reminds about an approaching deadline in the goal's
+// chat and/or the author's private chat
+func (h *BotHandler) NotifyDeadlineReminder(ctx context.Context, reminder service.Reminder, inChat, toAuthor bool) {
+	goal := reminder.Goal
+	ctx = logging.With(ctx, logging.ChatID, goal.ChatID, logging.GoalID, goal.ID)
+	l := h.chatLocale(ctx, goal.ChatID)
+	left := l.duration(reminder.TimeLeft)
+
+	if inChat {
+		text := l.f(`⏰ До дедлайна цели @%s осталось %s!
+
+🎯 %s
+📅 Срок: %s
+⭐ Ставка: %d звезд`,
+			reminder.Author.Username,
+			left,
+			goal.Title,
+			goal.Deadline.Format("02.01.2006 15:04"),
+			goal.Bet,
+		)
+
+		msg := tgbotapi.NewMessage(goal.ChatID, text)
+		if _, err := h.bot.Send(msg); err != nil {
+			slog.ErrorContext(ctx, "Error sending reminder to chat", "error", err)
+		}
+	}
+
+	if toAuthor {
+		text := l.f(`⏰ До дедлайна вашей цели осталось %s!
 
-		h.answerCallback(query, "✅ Голос учтен")
+🎯 %s
+⭐ Ставка: %d звезд
+
+Не забудьте отправить доказательство через /mygoals в беседе.`,
+			left,
+			goal.Title,
+			goal.Bet,
+		)
+
+		// Private chats share their ID with the user's Telegram ID; this only
+		// works if the author has started a conversation with the bot
+		msg := tgbotapi.NewMessage(reminder.Author.TgID, text)
+		if _, err := h.bot.Send(msg); err != nil {
+			slog.ErrorContext(ctx, "Error sending reminder to author", logging.UserID, reminder.Author.TgID, "error", err)
+		}
 	}
 }
 
-func (h *BotHandler) answerCallback(query *tgbotapi.CallbackQuery, text string) {
+// NotifyVotingResolved announces a vote that was decided when its window expired
+func (h *BotHandler) NotifyVotingResolved(ctx context.Context, result service.VotingResult) {
+	goal := result.Goal
+	ctx = logging.With(ctx, logging.ChatID, goal.ChatID, logging.GoalID, goal.ID)
+	l := h.chatLocale(ctx, goal.ChatID)
+
+	author := l.t("участник")
+	if user, err := h.service.GetUserByID(ctx, int64(goal.UserID)); err == nil {
+		author = "@" + user.Username
+	}
+
+	outcome := l.f("❌ Цель провалена. Ставка %d звезд %s.", goal.Bet, penaltyOutcomeText(l, result.PenaltyMode, &goal))
+	if result.Succeeded {
+		outcome = l.t("✅ Цель засчитана, ставка возвращена автору.")
+	}
+
+	text := l.f(`⌛ Время голосования истекло!
+
+🎯 %s
+👤 %s
+Голосов ЗА: %d, ПРОТИВ: %d, не проголосовали: %d
+
+%s`,
+		goal.Title,
+		author,
+		result.Yes,
+		result.No,
+		result.Abstained,
+		outcome,
+	)
+
+	msg := tgbotapi.NewMessage(goal.ChatID, text)
+	if _, err := h.bot.Send(msg); err != nil {
+		slog.ErrorContext(ctx, "Error sending voting result", "error", err)
+	}
+}
+
+// betLimitsText describes the bets a chat allows
+func betLimitsText(l *locale, settings models.ChatSettings) string {
+	if settings.MaxBet > 0 {
+		return l.f("Ставка в этой беседе: от %d до %d звезд", settings.MinBet, settings.MaxBet)
+	}
+	return l.f("Минимальная ставка в этой беседе: %d звезд", settings.MinBet)
+}
+
+// saveState persists the user's conversation step in a chat so it survives restarts
+func (h *BotHandler) saveState(ctx context.Context, chatID, userID int64, state *models.ConversationState) {
+	if err := h.service.SaveConversationState(ctx, chatID, userID, state); err != nil {
+		slog.ErrorContext(ctx, "Error saving conversation state", "error", err)
+		h.notifyTimeout(ctx, chatID, err)
+	}
+}
+
+func (h *BotHandler) clearState(ctx context.Context, chatID, userID int64) {
+	if err := h.service.DeleteConversationState(ctx, chatID, userID); err != nil {
+		slog.ErrorContext(ctx, "Error deleting conversation state", "error", err)
+		h.notifyTimeout(ctx, chatID, err)
+	}
+}
+
+// retryText replaces error details when storage did not answer in time
+const retryText = "⏳ Бот сейчас перегружен и не успел ответить. Попробуйте еще раз через минуту."
+
+// notifyTimeout tells the chat to retry if err is a timeout. Other errors on
+// otherwise silent paths are only logged.
+func (h *BotHandler) notifyTimeout(ctx context.Context, chatID int64, err error) {
+	if service.IsTimeout(err) {
+		h.send(ctx, tgbotapi.NewMessage(chatID, localeFrom(ctx).t(retryText)))
+	}
+}
+
+// send delivers c and logs a failure, reporting whether it was sent
+func (h *BotHandler) send(ctx context.Context, c tgbotapi.Chattable) bool {
+	if _, err := h.bot.Send(c); err != nil {
+		slog.ErrorContext(ctx, "Error sending to Telegram", "request", requestType(c), "error", err)
+		return false
+	}
+	return true
+}
+
+func (h *BotHandler) answerCallback(ctx context.Context, query *tgbotapi.CallbackQuery, text string) {
 	callback := tgbotapi.NewCallback(query.ID, text)
-	h.bot.Request(callback)
+	if _, err := h.bot.Request(callback); err != nil {
+		slog.ErrorContext(ctx, "Error answering callback query", "error", err)
+	}
 }
 
 func (h *BotHandler) parseDeadline(input string) (time.Time, error) {
@@ -466,5 +1097,76 @@ func (h *BotHandler) parseDeadline(input string) (time.Time, error) {
 		return time.Now().AddDate(0, 0, days), nil
 	}
 
-	return time.Time{}, fmt.Errorf("неверный формат")
+	return time.Time{}, fmt.Errorf("invalid deadline: %q", input)
+}
+
+// isEscrowReturn reports whether reason moves a bet from escrow back to the
+// available balance
+func isEscrowReturn(reason string) bool {
+	return reason == "escrow_release" || reason == "escrow_refund"
+}
+
+// transactionReasonText describes a transaction reason for users
+func transactionReasonText(l *locale, reason string) string {
+	var text string
+	switch reason {
+	case service.PenaltyReason(models.PenaltyMembers):
+		text = "Штраф за проваленную цель (поровну между участниками)"
+	case service.PenaltyReason(models.PenaltyVoters):
+		text = "Штраф за проваленную цель (поровну между голосовавшими)"
+	case service.PenaltyReason(models.PenaltyWeighted):
+		text = "Штраф за проваленную цель (по числу голосов)"
+	case service.PenaltyReason(models.PenaltyTreasury):
+		text = "Штраф за проваленную цель (в казну беседы)"
+	case service.PenaltyReason(models.PenaltyBurn):
+		text = "Штраф за проваленную цель (сгорел)"
+	case service.PenaltyReason(models.PenaltyCharity):
+		text = "Штраф за проваленную цель (на благотворительность)"
+	case service.PayoutReason(models.PayoutEqual):
+		text = "Выплата из казны беседы поровну"
+	case service.PayoutReason(models.PayoutSeason):
+		text = "Приз победителю сезона из казны беседы"
+	case "escrow_lock":
+		text = "Ставка заблокирована"
+	case "escrow_release":
+		text = "Ставка возвращена"
+	case "escrow_refund":
+		text = "Ставка возвращена при отмене цели"
+	default:
+		return reason
+	}
+	return l.t(text)
+}
+
+// penaltyOutcomeText says what happened to the bet of a goal failed under
+// mode, to follow "Ставка N звезд"
+func penaltyOutcomeText(l *locale, mode string, goal *models.Goal) string {
+	text := "распределена между участниками"
+	switch mode {
+	case models.PenaltyVoters:
+		if goal.ChatMembersCount > 0 {
+			text = "распределена между участниками голосования"
+		}
+	case models.PenaltyWeighted:
+		text = "распределена между участниками пропорционально их голосам"
+	case models.PenaltyTreasury:
+		text = "отправлена в казну беседы"
+	case models.PenaltyBurn:
+		text = "сгорела"
+	case models.PenaltyCharity:
+		text = "отправлена на благотворительность"
+	}
+	return l.t(text)
+}
+
+// voteTallyText announces the state of a vote after a ballot was counted
+func voteTallyText(l *locale, tally *service.VoteTally) string {
+	switch tally.Status {
+	case "success":
+		return l.f("✅ Цель выполнена! Голосов ЗА: %d, ПРОТИВ: %d", tally.Yes, tally.No)
+	case "failed":
+		return l.f("❌ Цель провалена! Голосов ЗА: %d, ПРОТИВ: %d. Ставка %d звезд %s.",
+			tally.Yes, tally.No, tally.Goal.Bet, penaltyOutcomeText(l, tally.PenaltyMode, &tally.Goal))
+	}
+	return l.f("⏳ Ожидаем больше голосов. ЗА: %d, ПРОТИВ: %d (требуется: %d)", tally.Yes, tally.No, tally.Required)
 }
@@ -0,0 +1,252 @@
+package handlers_test
+
+import (
+	"awesomeProject/internal/config"
+	"awesomeProject/internal/handlers"
+	"awesomeProject/internal/models"
+	"awesomeProject/internal/repository"
+	"awesomeProject/internal/service"
+	"awesomeProject/internal/telegramtest"
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newHandler returns a BotHandler with the default rules on a fresh
+// MemoryRepository, recording what it sends
+func newHandler(t *testing.T) (*handlers.BotHandler, *telegramtest.Sender, repository.Store) {
+	t.Helper()
+
+	defaults := config.Default()
+	store := repository.NewMemoryRepository(repository.Config{
+		QueryTimeout:    defaults.Database.QueryTimeout,
+		StartingBalance: defaults.Rules.StartingBalance,
+	})
+	svc := service.NewService(store, service.Config{
+		MinBet:           defaults.Rules.MinBet,
+		MaxBet:           defaults.Rules.MaxBet,
+		ApprovalPercent:  defaults.Rules.ApprovalPercent,
+		VotingWindow:     defaults.Rules.VotingWindow,
+		VotingResolution: defaults.Rules.VotingResolution,
+		PenaltyMode:      defaults.Rules.PenaltyMode,
+		ReminderOffsets:  defaults.Scheduler.ReminderOffsets,
+		Language:         defaults.Rules.Language,
+		ChangeFee:        defaults.Rules.ChangeFee,
+		ChangeWindow:     defaults.Rules.ChangeWindow,
+		ConversationTTL:  defaults.Rules.ConversationTTL,
+	})
+
+	sender := telegramtest.NewSender()
+	return handlers.NewBotHandler(sender, svc, handlers.Config{StartingBalance: defaults.Rules.StartingBalance}), sender, store
+}
+
+// message builds an update with a message from userID in chatID. Text
+// starting with "/" is sent as a bot command.
+func message(chatID, userID int64, text string) tgbotapi.Update {
+	msg := &tgbotapi.Message{
+		From: &tgbotapi.User{ID: userID, UserName: fmt.Sprintf("user%d", userID)},
+		Chat: &tgbotapi.Chat{ID: chatID, Type: "group"},
+		Text: text,
+	}
+	if strings.HasPrefix(text, "/") {
+		msg.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Length: len(text)}}
+	}
+	return tgbotapi.Update{Message: msg}
+}
+
+// press builds an update with a tap by userID on an inline button in chatID
+func press(chatID, userID int64, data string) tgbotapi.Update {
+	return tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:      fmt.Sprintf("callback-%d-%s", userID, data),
+		From:    &tgbotapi.User{ID: userID, UserName: fmt.Sprintf("user%d", userID)},
+		Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: chatID, Type: "group"}},
+		Data:    data,
+	}}
+}
+
+// userGoals returns the active goals of the user with Telegram ID tgID
+func userGoals(t *testing.T, store repository.Store, tgID int64) (*models.User, []models.Goal) {
+	t.Helper()
+
+	user, err := store.GetOrCreateUser(context.Background(), tgID, fmt.Sprintf("user%d", tgID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	goals, err := store.GetUserActiveGoals(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user, goals
+}
+
+func TestHandleUpdateKeepsConversationsApart(t *testing.T) {
+	h, _, store := newHandler(t)
+
+	chats := []int64{-1001, -1002, -1003}
+	users := []int64{1, 2, 3, 4}
+
+	// Every user walks through /newgoal in every chat at the same time, so
+	// their wizards interleave both across chats and across users
+	var wg sync.WaitGroup
+	for _, chatID := range chats {
+		for _, userID := range users {
+			wg.Add(1)
+			go func(chatID, userID int64) {
+				defer wg.Done()
+				steps := []string{"/newgoal", fmt.Sprintf("goal %d %d", chatID, userID), "description", "7", "10"}
+				for _, text := range steps {
+					h.HandleUpdate(context.Background(), message(chatID, userID, text))
+				}
+			}(chatID, userID)
+		}
+	}
+	wg.Wait()
+
+	for _, userID := range users {
+		user, goals := userGoals(t, store, userID)
+		if len(goals) != len(chats) {
+			t.Fatalf("user %d: expected %d goals, got %d", userID, len(chats), len(goals))
+		}
+		for _, goal := range goals {
+			if want := fmt.Sprintf("goal %d %d", goal.ChatID, userID); goal.Title != want {
+				t.Errorf("user %d: goal in chat %d is titled %q, want %q", userID, goal.ChatID, goal.Title, want)
+			}
+		}
+		if user.Balance != 70 || user.LockedBalance != 30 {
+			t.Errorf("user %d: expected 70 available and 30 locked stars, got %d and %d", userID, user.Balance, user.LockedBalance)
+		}
+	}
+}
+
+func TestHandleUpdateFinalizesConcurrentVotesOnce(t *testing.T) {
+	h, sender, store := newHandler(t)
+
+	const chatID, author = -1001, 1
+	voters := []int64{2, 3, 4, 5, 6}
+	for _, userID := range voters {
+		h.HandleUpdate(context.Background(), message(chatID, userID, "/start"))
+	}
+	for _, text := range []string{"/newgoal", "Run", "10 km", "7", "30"} {
+		h.HandleUpdate(context.Background(), message(chatID, author, text))
+	}
+	_, goals := userGoals(t, store, author)
+	if len(goals) != 1 {
+		t.Fatalf("expected 1 goal, got %d", len(goals))
+	}
+	goal := goals[0]
+
+	h.HandleUpdate(context.Background(), press(chatID, author, fmt.Sprintf("proof_%d", goal.ID)))
+	h.HandleUpdate(context.Background(), message(chatID, author, "Done"))
+
+	// All voters reject the goal at once; it must fail exactly once
+	var wg sync.WaitGroup
+	for _, userID := range voters {
+		wg.Add(1)
+		go func(userID int64) {
+			defer wg.Done()
+			h.HandleUpdate(context.Background(), press(chatID, userID, fmt.Sprintf("vote_no_%d", goal.ID)))
+		}(userID)
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, text := range sender.Texts(chatID) {
+		if strings.Contains(text, "Цель провалена") {
+			failed++
+		}
+	}
+	if failed != 1 {
+		t.Fatalf("expected the goal to fail once, got %d announcements", failed)
+	}
+
+	user, _ := userGoals(t, store, author)
+	if user.Balance != 70 || user.LockedBalance != 0 {
+		t.Errorf("author: expected 70 available and 0 locked stars, got %d and %d", user.Balance, user.LockedBalance)
+	}
+	for _, userID := range voters {
+		voter, _ := userGoals(t, store, userID)
+		if voter.Balance != 106 {
+			t.Errorf("voter %d: expected 106 stars, got %d", userID, voter.Balance)
+		}
+	}
+}
+
+func TestGoalFlowMessages(t *testing.T) {
+	h, sender, store := newHandler(t)
+
+	const chatID, author, voter = -1001, 1, 2
+	h.HandleUpdate(context.Background(), message(chatID, voter, "/start"))
+	for _, text := range []string{"/newgoal", "Run", "10 km", "7", "30"} {
+		h.HandleUpdate(context.Background(), message(chatID, author, text))
+	}
+	texts := sender.Texts(chatID)
+	if !strings.Contains(texts[len(texts)-1], "Цель создана") {
+		t.Fatalf("expected the goal to be created, got %q", texts[len(texts)-1])
+	}
+	_, goals := userGoals(t, store, author)
+	goal := goals[0]
+
+	h.HandleUpdate(context.Background(), press(chatID, author, fmt.Sprintf("proof_%d", goal.ID)))
+	h.HandleUpdate(context.Background(), message(chatID, author, "Done"))
+
+	// The voting message carries the vote buttons
+	messages := sender.Messages()
+	voting := messages[len(messages)-1]
+	keyboard, ok := voting.ReplyMarkup.(tgbotapi.InlineKeyboardMarkup)
+	if !ok || len(keyboard.InlineKeyboard) != 1 || *keyboard.InlineKeyboard[0][0].CallbackData != fmt.Sprintf("vote_yes_%d", goal.ID) {
+		t.Fatalf("expected the voting message to offer vote buttons, got %+v", voting.ReplyMarkup)
+	}
+
+	// The author's own vote is turned away in the callback answer
+	sender.Reset()
+	h.HandleUpdate(context.Background(), press(chatID, author, fmt.Sprintf("vote_yes_%d", goal.ID)))
+	requests := sender.Requests()
+	if len(requests) != 1 || !strings.Contains(requests[0].(tgbotapi.CallbackConfig).Text, "свою собственную цель") {
+		t.Fatalf("expected the author's vote to be rejected, got %+v", requests)
+	}
+
+	h.HandleUpdate(context.Background(), press(chatID, voter, fmt.Sprintf("vote_yes_%d", goal.ID)))
+	if texts := sender.Texts(chatID); len(texts) != 1 || !strings.Contains(texts[0], "Цель выполнена") {
+		t.Fatalf("expected the goal to be approved, got %q", texts)
+	}
+
+	user, _ := userGoals(t, store, author)
+	if user.Balance != 100 || user.LockedBalance != 0 {
+		t.Errorf("author: expected the bet back, got %d available and %d locked stars", user.Balance, user.LockedBalance)
+	}
+}
+
+func TestEnglishChatGetsEnglishTexts(t *testing.T) {
+	h, sender, store := newHandler(t)
+
+	// In a private chat the user manages the settings without an admin check
+	const userID = 1
+	private := func(update tgbotapi.Update) tgbotapi.Update {
+		if update.Message != nil {
+			update.Message.Chat.Type = "private"
+		} else {
+			update.CallbackQuery.Message.Chat.Type = "private"
+		}
+		return update
+	}
+	h.HandleUpdate(context.Background(), private(press(userID, userID, "set_lang_en")))
+	for _, text := range []string{"/newgoal", "Run", "10 km", "7", "30"} {
+		h.HandleUpdate(context.Background(), private(message(userID, userID, text)))
+	}
+	texts := sender.Texts(userID)
+	if !strings.Contains(texts[len(texts)-1], "Goal created") {
+		t.Fatalf("expected the goal to be created in English, got %q", texts[len(texts)-1])
+	}
+
+	// Errors from the service are translated too
+	_, goals := userGoals(t, store, userID)
+	sender.Reset()
+	h.HandleUpdate(context.Background(), private(press(userID, userID, fmt.Sprintf("vote_yes_%d", goals[0].ID))))
+	requests := sender.Requests()
+	if len(requests) != 1 || requests[0].(tgbotapi.CallbackConfig).Text != "❌ voting is only open for goals with proof sent" {
+		t.Fatalf("expected an English error, got %+v", requests)
+	}
+}
@@ -0,0 +1,604 @@
+package handlers
+
+import (
+	"awesomeProject/internal/models"
+	"awesomeProject/internal/service"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// locale holds the texts in one of the languages a chat can choose. The long
+// texts and menus have their own fields; shorter texts are written in Russian
+// where they are used and looked up in texts with t and f.
+type locale struct {
+	start string
+	help  string // formatted with the starting balance
+
+	settingsTitle   string
+	settingsAdmins  string
+	settingsSaved   string
+	settingsBack    string
+	settingsFailed  string
+	settingsNoLimit string
+	settingsOff     string
+	settingsFields  map[string]string // field name for buttons and the summary
+	penaltyModes    map[string]string
+	languages       map[string]string
+
+	changeForbidden     string
+	changeUntilDeadline string
+	changeWindow        string // formatted with the percent of a goal's time
+
+	texts    map[string]string // translations keyed by the Russian text, nil for Russian
+	duration func(time.Duration) string
+}
+
+var locales = map[string]*locale{
+	models.LanguageRussian: {
+		start: `👋 Привет! Я бот для постановки целей с ответственностью.
+
+🎯 Как это работает:
+1. Создай цель с помощью /newgoal
+2. Укажи название, описание, срок и ставку в звездах
+3. После достижения цели отправь доказательство
+4. Участники беседы проголосуют за выполнение
+5. Если цель выполнена - ты сохраняешь звезды
+6. Если нет - звезды распределятся между участниками
+
+📋 Команды:
+/newgoal - Создать новую цель
+/mygoals - Мои активные цели
+/editgoal - Изменить цель
+/cancelgoal - Отменить цель
+/goals - Все цели в беседе
+/stats - Моя статистика
+/history - История операций со звездами
+/top - Рейтинг участников беседы
+/treasury - Казна беседы
+/payout - Выплата из казны (для администраторов)
+/settings - Настройки беседы (для администраторов)
+/help - Помощь`,
+		help: `📖 Помощь
+
+📋 Команды:
+/newgoal - Создать новую цель
+/mygoals - Посмотреть свои активные цели
+/editgoal - Изменить название, описание или срок цели
+/cancelgoal - Отменить цель
+/goals - Посмотреть все цели в беседе
+/stats - Моя статистика
+/history - История операций со звездами
+/top - Рейтинг участников беседы
+/treasury - Казна беседы
+/payout - Выплата из казны (для администраторов)
+/settings - Настройки беседы (для администраторов)
+/cancel - Отменить текущее действие
+
+💡 Советы:
+• Ставьте реалистичные цели
+• Сохраняйте доказательства выполнения
+• Голосуйте честно за цели других участников
+• Начальный баланс: %d звезд`,
+
+		settingsTitle:   "⚙️ Настройки беседы",
+		settingsAdmins:  "⛔ Настройки беседы могут менять только администраторы.",
+		settingsSaved:   "✅ Сохранено",
+		settingsBack:    "⬅️ Назад",
+		settingsFailed:  "❌ Не удалось проверить права администратора. Попробуйте позже.",
+		settingsNoLimit: "без ограничений",
+		settingsOff:     "выключены",
+		settingsFields: map[string]string{
+			settingMinBet:  "💰 Мин. ставка",
+			settingMaxBet:  "💰 Макс. ставка",
+			settingWindow:  "⏳ Голосование",
+			settingQuorum:  "🗳 Кворум",
+			settingPenalty: "⚖️ Штраф получают",
+			settingRemind:  "⏰ Напоминания",
+			settingFee:     "💸 Комиссия",
+			settingChange:  "✏️ Продление и отмена",
+			settingLang:    "🌐 Язык",
+		},
+		changeForbidden:     "запрещены",
+		changeUntilDeadline: "до дедлайна",
+		changeWindow:        "в первые %s%% срока",
+		penaltyModes: map[string]string{
+			models.PenaltyMembers:  "все участники поровну",
+			models.PenaltyVoters:   "участники голосования",
+			models.PenaltyWeighted: "участники по числу голосов",
+			models.PenaltyTreasury: "казна беседы",
+			models.PenaltyBurn:     "никто (сгорает)",
+			models.PenaltyCharity:  "благотворительность",
+		},
+		languages: map[string]string{
+			models.LanguageRussian: "Русский",
+			models.LanguageEnglish: "English",
+		},
+		duration: formatTimeLeft,
+	},
+	models.LanguageEnglish: {
+		start: `👋 Hi! I help you set goals and keep them, with stars at stake.
+
+🎯 How it works:
+1. Create a goal with /newgoal
+2. Enter a title, description, deadline and bet in stars
+3. Once you reach the goal, send proof
+4. Chat members vote on whether it is done
+5. If the goal is done, you keep your stars
+6. If not, your stars are shared among the members
+
+📋 Commands:
+/newgoal - Create a goal
+/mygoals - My active goals
+/editgoal - Edit a goal
+/cancelgoal - Cancel a goal
+/goals - All goals in this chat
+/stats - My statistics
+/history - Star transaction history
+/top - Chat leaderboard
+/treasury - Chat treasury
+/payout - Pay out the treasury (admins only)
+/settings - Chat settings (admins only)
+/help - Help`,
+		help: `📖 Help
+
+📋 Commands:
+/newgoal - Create a goal
+/mygoals - Show your active goals
+/editgoal - Change a goal's title, description or deadline
+/cancelgoal - Cancel a goal
+/goals - Show all goals in this chat
+/stats - My statistics
+/history - Star transaction history
+/top - Chat leaderboard
+/treasury - Chat treasury
+/payout - Pay out the treasury (admins only)
+/settings - Chat settings (admins only)
+/cancel - Cancel the current action
+
+💡 Tips:
+• Set realistic goals
+• Keep proof of your progress
+• Vote honestly on other members' goals
+• Starting balance: %d stars`,
+
+		settingsTitle:   "⚙️ Chat settings",
+		settingsAdmins:  "⛔ Only chat admins can change the settings.",
+		settingsSaved:   "✅ Saved",
+		settingsBack:    "⬅️ Back",
+		settingsFailed:  "❌ Could not check admin rights. Please try again later.",
+		settingsNoLimit: "no limit",
+		settingsOff:     "off",
+		settingsFields: map[string]string{
+			settingMinBet:  "💰 Min bet",
+			settingMaxBet:  "💰 Max bet",
+			settingWindow:  "⏳ Voting",
+			settingQuorum:  "🗳 Quorum",
+			settingPenalty: "⚖️ Penalty goes to",
+			settingRemind:  "⏰ Reminders",
+			settingFee:     "💸 Change fee",
+			settingChange:  "✏️ Extend or cancel",
+			settingLang:    "🌐 Language",
+		},
+		changeForbidden:     "not allowed",
+		changeUntilDeadline: "until the deadline",
+		changeWindow:        "in the first %s%% of the time",
+		penaltyModes: map[string]string{
+			models.PenaltyMembers:  "all members equally",
+			models.PenaltyVoters:   "voters",
+			models.PenaltyWeighted: "members by votes cast",
+			models.PenaltyTreasury: "chat treasury",
+			models.PenaltyBurn:     "nobody (burned)",
+			models.PenaltyCharity:  "charity",
+		},
+		languages: map[string]string{
+			models.LanguageRussian: "Русский",
+			models.LanguageEnglish: "English",
+		},
+		texts:    englishTexts,
+		duration: formatDurationEnglish,
+	},
+}
+
+// chatLocale returns the texts in a chat's language, falling back to the
+// default language if its settings cannot be read
+func (h *BotHandler) chatLocale(ctx context.Context, chatID int64) *locale {
+	settings, err := h.service.ChatSettings(ctx, chatID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error loading chat settings", "error", err)
+		settings = h.service.DefaultChatSettings(chatID)
+	}
+	return localeFor(settings.Language)
+}
+
+func localeFor(language string) *locale {
+	if l, ok := locales[language]; ok {
+		return l
+	}
+	return locales[models.LanguageRussian]
+}
+
+type localeKey struct{}
+
+// withLocale returns a copy of ctx carrying the locale of the chat an update
+// came from
+func withLocale(ctx context.Context, l *locale) context.Context {
+	return context.WithValue(ctx, localeKey{}, l)
+}
+
+// localeFrom returns the locale carried by ctx, or the default language's
+// texts if the chat's locale was not loaded
+func localeFrom(ctx context.Context) *locale {
+	if l, ok := ctx.Value(localeKey{}).(*locale); ok {
+		return l
+	}
+	return locales[models.LanguageRussian]
+}
+
+// t translates a Russian text. Texts missing from the table are returned as
+// they are.
+func (l *locale) t(text string) string {
+	if translated, ok := l.texts[text]; ok {
+		return translated
+	}
+	return text
+}
+
+// f formats args with the translation of a Russian format
+func (l *locale) f(format string, args ...any) string {
+	return fmt.Sprintf(l.t(format), args...)
+}
+
+// plural picks the form of a word for n from its Russian forms
+func (l *locale) plural(n int, one, few, many string) string {
+	if l.texts == nil {
+		return pluralize(n, one, few, many)
+	}
+	if n == 1 {
+		return l.t(one)
+	}
+	return l.t(many)
+}
+
+// errorText formats err for the user with format, or returns retryText if
+// err is a timeout, whose details mean nothing to the user. Only a
+// service.UserError is translated; other errors are shown as they are.
+func (l *locale) errorText(format string, err error) string {
+	if service.IsTimeout(err) {
+		return l.t(retryText)
+	}
+
+	message := err.Error()
+	var userErr *service.UserError
+	if errors.As(err, &userErr) {
+		message = l.f(userErr.Format, userErr.Args...)
+	}
+	return l.f(format, message)
+}
+
+// formatTimeLeft renders a duration as days, hours or minutes in Russian
+func formatTimeLeft(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour:
+		days := int(d.Round(time.Hour) / (24 * time.Hour))
+		return fmt.Sprintf("%d %s", days, pluralize(days, "день", "дня", "дней"))
+	case d >= time.Hour:
+		hours := int(d.Round(time.Hour) / time.Hour)
+		return fmt.Sprintf("%d %s", hours, pluralize(hours, "час", "часа", "часов"))
+	default:
+		minutes := int(d.Round(time.Minute) / time.Minute)
+		return fmt.Sprintf("%d %s", minutes, pluralize(minutes, "минута", "минуты", "минут"))
+	}
+}
+
+// pluralize picks the Russian plural form for n
+func pluralize(n int, one, few, many string) string {
+	n %= 100
+	if n >= 11 && n <= 14 {
+		return many
+	}
+	switch n % 10 {
+	case 1:
+		return one
+	case 2, 3, 4:
+		return few
+	default:
+		return many
+	}
+}
+
+// formatDurationEnglish renders a duration as days, hours or minutes in English
+func formatDurationEnglish(d time.Duration) string {
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("%d %s", n, unit)
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+
+	switch {
+	case d >= 24*time.Hour:
+		return plural(int(d.Round(time.Hour)/(24*time.Hour)), "day")
+	case d >= time.Hour:
+		return plural(int(d.Round(time.Hour)/time.Hour), "hour")
+	default:
+		return plural(int(d.Round(time.Minute)/time.Minute), "minute")
+	}
+}
+
+// englishTexts translates the texts passed to t and f
+var englishTexts = map[string]string{
+	retryText: "⏳ The bot is overloaded and could not answer in time. Please try again in a minute.",
+
+	// Creating goals and sending proof
+	"📝 Введите название цели:": "📝 Enter the goal's title:",
+	"📄 Введите описание цели:": "📄 Enter the goal's description:",
+	"📅 Введите срок выполнения (формат: 2024-12-31 или количество дней, например: 7):":        "📅 Enter the deadline (format: 2024-12-31 or a number of days, e.g. 7):",
+	"❌ Неверный формат даты. Используйте формат YYYY-MM-DD или количество дней (например: 7)": "❌ Invalid date. Use the format YYYY-MM-DD or a number of days (e.g. 7)",
+	"⭐ Введите ставку в звездах:":                       "⭐ Enter your bet in stars:",
+	"⭐ Введите ставку в звездах (ваш баланс: %d):":      "⭐ Enter your bet in stars (your balance: %d):",
+	"❌ Неверное значение. Введите положительное число:": "❌ Invalid value. Enter a positive number:",
+	"❌ Ошибка получения данных пользователя: %v":        "❌ Could not load your data: %v",
+	"❌ Ошибка получения настроек беседы: %v":            "❌ Could not load the chat settings: %v",
+	"❌ Недостаточно звезд. У вас: %d":                   "❌ Not enough stars. You have: %d",
+	"❌ Ошибка создания цели: %v":                        "❌ Could not create the goal: %v",
+	"Минимальная ставка в этой беседе: %d звезд":        "The minimum bet in this chat is %d stars",
+	"Ставка в этой беседе: от %d до %d звезд":           "Bets in this chat are from %d to %d stars",
+	`✅ Цель создана!
+
+🎯 %s
+📄 %s
+📅 Срок: %s
+⭐ Ставка: %d звезд
+
+Удачи! После выполнения используйте команду /mygoals чтобы отправить доказательство.`: `✅ Goal created!
+
+🎯 %s
+📄 %s
+📅 Deadline: %s
+⭐ Bet: %d stars
+
+Good luck! Once you are done, use /mygoals to send proof.`,
+	"❌ Цель не найдена": "❌ Goal not found",
+	"❌ Отправьте текст, фото, видео, документ, голосовое сообщение или видеосообщение:":                                "❌ Send text, a photo, a video, a document, a voice message or a video message:",
+	"📝 Отправьте доказательство выполнения цели (текст, ссылка, фото, видео, документ, голосовое или видеосообщение):": "📝 Send proof that you reached the goal (text, a link, a photo, a video, a document, a voice or video message):",
+	"см. вложение":                    "see attachment",
+	"\n⏳ Голосование открыто до %s\n": "\n⏳ Voting is open until %s\n",
+	`📢 @%s отправил доказательство выполнения цели:
+
+🎯 %s
+📄 %s
+💬 Доказательство: %s
+%s
+Голосуйте за выполнение:`: `📢 @%s sent proof of reaching a goal:
+
+🎯 %s
+📄 %s
+💬 Proof: %s
+%s
+Vote on whether it is done:`,
+	"✅ Выполнено":    "✅ Done",
+	"❌ Не выполнено": "❌ Not done",
+
+	// Voting
+	"✅ Голос учтен": "✅ Vote counted",
+	"✅ Цель выполнена! Голосов ЗА: %d, ПРОТИВ: %d":                      "✅ Goal achieved! Votes FOR: %d, AGAINST: %d",
+	"❌ Цель провалена! Голосов ЗА: %d, ПРОТИВ: %d. Ставка %d звезд %s.": "❌ Goal failed! Votes FOR: %d, AGAINST: %d. The bet of %d stars %s.",
+	"⏳ Ожидаем больше голосов. ЗА: %d, ПРОТИВ: %d (требуется: %d)":      "⏳ Waiting for more votes. FOR: %d, AGAINST: %d (needed: %d)",
+	"❌ Цель провалена. Ставка %d звезд %s.":                             "❌ Goal failed. The bet of %d stars %s.",
+	"✅ Цель засчитана, ставка возвращена автору.":                       "✅ Goal approved, the bet was returned to its author.",
+	"распределена между участниками":                                    "was shared among the members",
+	"распределена между участниками голосования":                        "was shared among the voters",
+	"распределена между участниками пропорционально их голосам":         "was shared among the members by the votes they cast",
+	"отправлена в казну беседы":                                         "went to the chat treasury",
+	"сгорела": "was burned",
+	"отправлена на благотворительность": "went to charity",
+	"участник": "a member",
+	`⌛ Время голосования истекло!
+
+🎯 %s
+👤 %s
+Голосов ЗА: %d, ПРОТИВ: %d, не проголосовали: %d
+
+%s`: `⌛ Voting time is over!
+
+🎯 %s
+👤 %s
+Votes FOR: %d, AGAINST: %d, did not vote: %d
+
+%s`,
+	`⌛ Срок цели истек!
+
+🎯 %s
+👤 %s
+📅 Срок: %s
+
+❌ Доказательство не было отправлено вовремя. Ставка %d звезд %s.`: `⌛ The goal's deadline has passed!
+
+🎯 %s
+👤 %s
+📅 Deadline: %s
+
+❌ No proof was sent in time. The bet of %d stars %s.`,
+	`⏰ До дедлайна цели @%s осталось %s!
+
+🎯 %s
+📅 Срок: %s
+⭐ Ставка: %d звезд`: `⏰ @%s's goal is due in %s!
+
+🎯 %s
+📅 Deadline: %s
+⭐ Bet: %d stars`,
+	`⏰ До дедлайна вашей цели осталось %s!
+
+🎯 %s
+⭐ Ставка: %d звезд
+
+Не забудьте отправить доказательство через /mygoals в беседе.`: `⏰ Your goal is due in %s!
+
+🎯 %s
+⭐ Bet: %d stars
+
+Don't forget to send proof with /mygoals in the chat.`,
+
+	// Goal lists and statistics
+	"У вас нет активных целей. Создайте новую с помощью /newgoal": "You have no active goals. Create one with /newgoal",
+	"📋 Ваши активные цели:\n\n":                                   "📋 Your active goals:\n\n",
+	"✅ Отправить доказательство #%d":                              "✅ Send proof #%d",
+	"✏️ Изменить #%d":                                             "✏️ Edit #%d",
+	"🚫 Отменить #%d":                                              "🚫 Cancel #%d",
+	"В этой беседе нет активных целей.":                           "There are no active goals in this chat.",
+	"📋 Активные цели в беседе:\n\n":                               "📋 Active goals in this chat:\n\n",
+	"Активна":        "Active",
+	"На голосовании": "Voting",
+	"👤 Статистика\n⭐ Доступно: %d звезд\n🔒 В ставках: %d звезд\n📋 Активных целей: %d\n": "👤 Statistics\n⭐ Available: %d stars\n🔒 In bets: %d stars\n📋 Active goals: %d\n",
+	"❌ Ошибка: %v":         "❌ Error: %v",
+	"❌ Действие отменено.": "❌ Action cancelled.",
+
+	// History
+	"📜 У вас пока нет операций со звездами.":                                         "📜 You have no star transactions yet.",
+	"📜 История операций @%s (стр. %d/%d):\n\n":                                       "📜 Transactions of @%s (page %d/%d):\n\n",
+	"🔒 и 🔓 — ставка блокируется и возвращается, общий баланс от этого не меняется\n": "🔒 and 🔓 — a bet is locked and returned, this does not change the total balance\n",
+	"❌ Это не ваша история. Используйте /history":                                    "❌ This is not your history. Use /history",
+	"⬅️ Назад":  "⬅️ Back",
+	"Вперед ➡️": "Next ➡️",
+	"Штраф за проваленную цель (поровну между участниками)":   "Penalty for a failed goal (shared equally among members)",
+	"Штраф за проваленную цель (поровну между голосовавшими)": "Penalty for a failed goal (shared equally among voters)",
+	"Штраф за проваленную цель (по числу голосов)":            "Penalty for a failed goal (by votes cast)",
+	"Штраф за проваленную цель (в казну беседы)":              "Penalty for a failed goal (to the chat treasury)",
+	"Штраф за проваленную цель (сгорел)":                      "Penalty for a failed goal (burned)",
+	"Штраф за проваленную цель (на благотворительность)":      "Penalty for a failed goal (to charity)",
+	"Выплата из казны беседы поровну":                         "Equal payout from the chat treasury",
+	"Приз победителю сезона из казны беседы":                  "Season prize from the chat treasury",
+	"Ставка заблокирована":                                    "Bet locked",
+	"Ставка возвращена":                                       "Bet returned",
+	"Ставка возвращена при отмене цели":                       "Bet returned on cancelling the goal",
+
+	// Leaderboard
+	"⭐ Баланс":     "⭐ Balance",
+	"✅ Цели":       "✅ Goals",
+	"📈 Успешность": "📈 Success rate",
+	"💰 Выигрыш":    "💰 Winnings",
+	"🏆 В беседе пока нет участников.": "🏆 This chat has no members yet.",
+	"🏆 Рейтинг участников: %s\n\n":    "🏆 Leaderboard: %s\n\n",
+	"%.0f%% (%d из %d)": "%.0f%% (%d of %d)",
+	"цель":              "goal",
+	"цели":              "goals",
+	"целей":             "goals",
+
+	// Editing and cancelling goals
+	"✏️ Какую цель изменить?": "✏️ Which goal do you want to edit?",
+	"🚫 Какую цель отменить?":  "🚫 Which goal do you want to cancel?",
+	"У вас нет целей, которые можно изменить. Цели с отправленным доказательством не меняются.": "You have no goals that can be changed. Goals with proof sent cannot be changed.",
+	"📝 Введите новое название цели:": "📝 Enter the goal's new title:",
+	"📄 Введите новое описание цели:": "📄 Enter the goal's new description:",
+	"📅 Введите новый срок (формат: 2024-12-31 или количество дней, например: 7). Комиссия за продление: %d звезд": "📅 Enter the new deadline (format: 2024-12-31 or a number of days, e.g. 7). The extension fee is %d stars",
+	`✏️ Изменение цели
+
+🎯 %s
+📄 %s
+📅 Срок: %s
+⭐ Ставка: %d звезд
+
+Название и описание можно менять бесплатно.
+📅 Продление и отмена: %s
+`: `✏️ Edit goal
+
+🎯 %s
+📄 %s
+📅 Deadline: %s
+⭐ Bet: %d stars
+
+The title and description can be changed for free.
+📅 Extending and cancelling: %s
+`,
+	"\n📜 История изменений:\n": "\n📜 Change history:\n",
+	"📝 Название":               "📝 Title",
+	"📄 Описание":               "📄 Description",
+	"📅 Продлить срок":          "📅 Extend deadline",
+	"🚫 Отменить цель":          "🚫 Cancel goal",
+	"✅ Да, отменить":           "✅ Yes, cancel",
+	"✅ Цель отменена":          "✅ Goal cancelled",
+	`🚫 Отменить цель?
+
+🎯 %s
+⭐ Ставка: %d звезд
+💸 Комиссия: %d звезд
+↩️ Вернется: %d звезд`: `🚫 Cancel the goal?
+
+🎯 %s
+⭐ Bet: %d stars
+💸 Fee: %d stars
+↩️ Returned: %d stars`,
+	"❌ Не удалось изменить цель: %v":        "❌ Could not change the goal: %v",
+	"❌ Изменять цель может только ее автор": "❌ Only the goal's author can change it",
+	"❌ Изменить можно только активную цель, по которой еще не отправлено доказательство": "❌ Only an active goal without proof sent can be changed",
+	"✏️ @%s изменяет название цели\n\nБыло: %s\nСтало: %s":                               "✏️ @%s renamed a goal\n\nWas: %s\nNow: %s",
+	"✏️ @%s изменяет описание цели\n\n🎯 %s\n📄 %s":                                        "✏️ @%s changed a goal's description\n\n🎯 %s\n📄 %s",
+	"📅 @%s продлевает срок цели\n\n🎯 %s\n📅 Было: %s\n📅 Стало: %s":                        "📅 @%s extended a goal's deadline\n\n🎯 %s\n📅 Was: %s\n📅 Now: %s",
+	"🚫 @%s отменяет цель\n\n🎯 %s\n↩️ Возвращено: %d звезд":                               "🚫 @%s cancelled a goal\n\n🎯 %s\n↩️ Returned: %d stars",
+	"\n💸 Комиссия %d звезд %s.":                                                          "\n💸 The fee of %d stars %s.",
+	"комиссия %d звезд, доступны до %s":                                                  "fee %d stars, possible until %s",
+	"были доступны до %s":                                                                "were possible until %s",
+	"запрещены в этой беседе":                                                            "not allowed in this chat",
+	"название: «%s» → «%s»":                                                              "title: “%s” → “%s”",
+	"описание":                                                                           "description",
+	"срок: %s → %s":                                                                      "deadline: %s → %s",
+	"отмена":                                                                             "cancelled",
+	" (комиссия %d ⭐)":                                                                   " (fee %d ⭐)",
+
+	// Treasury
+	"💰 Казна беседы: %d ⭐\n": "💰 Chat treasury: %d ⭐\n",
+	"📅 Сезон: %s\n":          "📅 Season: %s\n",
+	"\n📜 Операций с казной пока не было. Штрафы попадают в казну, если администраторы выбрали это в /settings.": "\n📜 No treasury transactions yet. Penalties go to the treasury if the admins choose so in /settings.",
+	"\n📜 Операции (стр. %d/%d):\n\n":                      "\n📜 Transactions (page %d/%d):\n\n",
+	"⛔ Выплаты из казны доступны только администраторам.": "⛔ Only admins can pay out the treasury.",
+	"Предстоящая выплата из казны:\n\n":                   "Upcoming treasury payout:\n\n",
+	"✅ Выплатить":                   "✅ Pay out",
+	"🎉 Казна беседы выплачена!\n\n": "🎉 The chat treasury was paid out!\n\n",
+	"✅ Выплачено":                   "✅ Paid out",
+	"💰 Казна беседы: %d ⭐\n📅 Сезон: %s\n\nКак распределить казну?": "💰 Chat treasury: %d ⭐\n📅 Season: %s\n\nHow should the treasury be shared?",
+	"🏆 Призы победителям сезона":                                   "🏆 Prizes for the season's winners",
+	"➗ Поровну между участниками":                                  "➗ Equally among members",
+	"с создания беседы":                                            "since the chat was created",
+	"с %s":                                                         "since %s",
+
+	// Errors from the service
+	"цель уже завершена":                                                                   "the goal is already resolved",
+	"минимальная ставка в этой беседе: %d звезд":                                           "the minimum bet in this chat is %d stars",
+	"максимальная ставка в этой беседе: %d звезд":                                          "the maximum bet in this chat is %d stars",
+	"недостаточно звезд на балансе. У вас: %d, требуется: %d":                              "not enough stars. You have: %d, needed: %d",
+	"цель относится к другой беседе":                                                       "the goal belongs to another chat",
+	"отправить доказательство может только автор цели":                                     "only the goal's author can send proof",
+	"цель должна быть активной для отправки доказательства":                                "the goal must be active to send proof",
+	"голосование доступно только для целей в статусе 'done_pending'":                       "voting is only open for goals with proof sent",
+	"вы не можете голосовать за свою собственную цель":                                     "you cannot vote on your own goal",
+	"голосовать могут только участники, бывшие в беседе на момент отправки доказательства": "only members who were in the chat when the proof was sent can vote",
+	"страница не найдена":                                                                  "page not found",
+	"текст не может быть пустым":                                                           "the text cannot be empty",
+	"название должно быть не длиннее %d символов":                                          "the title must be at most %d characters long",
+	"неизвестное изменение: %s":                                                            "unknown change: %s",
+	"новый срок должен быть позже текущего (%s)":                                           "the new deadline must be later than the current one (%s)",
+	"недостаточно звезд для оплаты комиссии: требуется %d":                                 "not enough stars to pay the fee: %d needed",
+	"изменять цель может только ее автор":                                                  "only the goal's author can change it",
+	"изменить можно только активную цель, по которой еще не отправлено доказательство":     "only an active goal without proof sent can be changed",
+	"в этой беседе цели нельзя продлевать и отменять":                                      "goals cannot be extended or cancelled in this chat",
+	"продлить или отменить цель можно было до %s":                                          "the goal could be extended or cancelled until %s",
+	"минимальная ставка должна быть не меньше 1 звезды":                                    "the minimum bet must be at least 1 star",
+	"максимальная ставка (%d) меньше минимальной (%d)":                                     "the maximum bet (%d) is below the minimum (%d)",
+	"срок голосования не может быть отрицательным":                                         "the voting window cannot be negative",
+	"кворум должен быть от 1 до 100%%":                                                     "the quorum must be from 1 to 100%%",
+	"недоступный режим распределения штрафа: %s":                                           "unavailable penalty mode: %s",
+	"напоминание можно отправить не раньше чем за 7 дней до срока":                         "reminders can be sent at most 7 days before the deadline",
+	"комиссия за изменение цели должна быть от 0 до 100%%":                                 "the change fee must be from 0 to 100%%",
+	"срок для изменения цели должен быть от 0 до 100%%":                                    "the change window must be from 0 to 100%%",
+	"неизвестный язык: %s":                                                                 "unknown language: %s",
+	"казна беседы пуста":                                                                   "the chat treasury is empty",
+	"в беседе нет участников":                                                              "the chat has no members",
+	"в этом сезоне еще никто не выполнил ни одной цели":                                    "nobody has reached a goal this season yet",
+	"неизвестный вид выплаты: %s":                                                          "unknown payout kind: %s",
+	"неверное значение: %s":                                                                "invalid value: %s",
+	"неизвестная настройка: %s":                                                            "unknown setting: %s",
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+// formatVerb matches the fmt verbs of a format string
+var formatVerb = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+// russianLiterals returns the string literals with Cyrillic letters in the
+// non-test Go files of dir, except those in skip
+func russianLiterals(t *testing.T, dir string, skip ...string) []string {
+	t.Helper()
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var literals []string
+	for _, path := range files {
+		if strings.HasSuffix(path, "_test.go") || slices.Contains(skip, filepath.Base(path)) {
+			continue
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			lit, ok := n.(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				return true
+			}
+			value, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.IndexFunc(value, func(r rune) bool { return unicode.Is(unicode.Cyrillic, r) }) >= 0 {
+				literals = append(literals, value)
+			}
+			return true
+		})
+	}
+	return literals
+}
+
+func TestEnglishTextsCoverRussianTexts(t *testing.T) {
+	// locale.go holds the Russian locale itself
+	literals := russianLiterals(t, ".", "locale.go")
+	literals = append(literals, russianLiterals(t, "../service")...)
+
+	for text := range englishTexts {
+		if !slices.Contains(literals, text) {
+			t.Errorf("unused English translation for %q", text)
+		}
+	}
+	for _, text := range literals {
+		translated, ok := englishTexts[text]
+		if !ok {
+			t.Errorf("no English translation for %q", text)
+			continue
+		}
+		if want, got := formatVerb.FindAllString(text, -1), formatVerb.FindAllString(translated, -1); !slices.Equal(want, got) {
+			t.Errorf("translation of %q has verbs %q, want %q", text, got, want)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"awesomeProject/internal/models"
+	"awesomeProject/internal/service"
+	"context"
+	"encoding/json"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fields of the /settings menu as they appear in callback data:
+// set_menu shows the menu, set_<field> the choices for a field and
+// set_<field>_<value> saves a choice
+const (
+	settingMinBet  = "minbet"
+	settingMaxBet  = "maxbet"
+	settingWindow  = "window"
+	settingQuorum  = "quorum"
+	settingPenalty = "penalty"
+	settingRemind  = "remind"
+	settingFee     = "fee"
+	settingChange  = "change"
+	settingLang    = "lang"
+)
+
+// settingsFields lists the menu fields in button order
+var settingsFields = []string{settingMinBet, settingMaxBet, settingWindow, settingQuorum, settingPenalty, settingRemind, settingFee, settingChange, settingLang}
+
+// settingsChoices are the values offered for each field. Durations are in
+// minutes, reminder offsets are comma-separated and "off" turns them off.
+// Penalty modes depend on the service's configuration.
+var settingsChoices = map[string][]string{
+	settingMinBet: {"1", "5", "10", "20", "50"},
+	settingMaxBet: {"0", "50", "100", "200", "500"},
+	settingWindow: {"0", "720", "1440", "2880", "4320", "10080"},
+	settingQuorum: {"25", "50", "67", "75", "100"},
+	settingRemind: {"4320,1440,180", "1440,180", "1440", "180", "off"},
+	settingFee:    {"0", "10", "25", "50", "100"},
+	settingChange: {"0", "25", "50", "75", "100"},
+	settingLang:   {models.LanguageRussian, models.LanguageEnglish},
+}
+
+func (h *BotHandler) handleSettings(ctx context.Context, message *tgbotapi.Message) {
+	settings, err := h.service.ChatSettings(ctx, message.Chat.ID)
+	if err != nil {
+		h.send(ctx, tgbotapi.NewMessage(message.Chat.ID, localeFrom(ctx).errorText("❌ Ошибка: %v", err)))
+		return
+	}
+	l := localeFor(settings.Language)
+
+	admin, err := h.isChatAdmin(message.Chat, message.From.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error checking chat admin", "error", err)
+		h.send(ctx, tgbotapi.NewMessage(message.Chat.ID, l.settingsFailed))
+		return
+	}
+	if !admin {
+		h.send(ctx, tgbotapi.NewMessage(message.Chat.ID, l.settingsAdmins))
+		return
+	}
+
+	text, keyboard := h.renderSettings(settings, "")
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	msg.ReplyMarkup = keyboard
+	h.send(ctx, msg)
+}
+
+// handleSettingsCallback handles a press in the /settings menu; parts is the
+// split callback data without the leading "set"
+func (h *BotHandler) handleSettingsCallback(ctx context.Context, query *tgbotapi.CallbackQuery, parts []string) {
+	chatID := query.Message.Chat.ID
+
+	settings, err := h.service.ChatSettings(ctx, chatID)
+	if err != nil {
+		h.answerCallback(ctx, query, localeFrom(ctx).errorText("❌ %v", err))
+		return
+	}
+	l := localeFor(settings.Language)
+
+	// Anyone can press the buttons, so check every time
+	admin, err := h.isChatAdmin(query.Message.Chat, query.From.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error checking chat admin", "error", err)
+		h.answerCallback(ctx, query, l.settingsFailed)
+		return
+	}
+	if !admin {
+		h.answerCallback(ctx, query, l.settingsAdmins)
+		return
+	}
+
+	field, answer := parts[0], ""
+	if field == "menu" {
+		field = ""
+	}
+
+	if len(parts) >= 2 {
+		if err := applySetting(&settings, field, parts[1]); err != nil {
+			h.answerCallback(ctx, query, l.errorText("❌ %v", err))
+			return
+		}
+		if err := h.service.UpdateChatSettings(ctx, settings); err != nil {
+			h.answerCallback(ctx, query, l.errorText("❌ %v", err))
+			return
+		}
+		field, answer = "", localeFor(settings.Language).settingsSaved
+	}
+
+	text, keyboard := h.renderSettings(settings, field)
+	edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, query.Message.MessageID, text, keyboard)
+	h.send(ctx, edit)
+	h.answerCallback(ctx, query, answer)
+}
+
+// isChatAdmin reports whether a user administers chat. In a private chat the
+// user is the only member and manages its settings.
+func (h *BotHandler) isChatAdmin(chat *tgbotapi.Chat, userID int64) (bool, error) {
+	if chat.IsPrivate() {
+		return true, nil
+	}
+
+	resp, err := h.bot.Request(tgbotapi.GetChatMemberConfig{
+		ChatConfigWithUser: tgbotapi.ChatConfigWithUser{ChatID: chat.ID, UserID: userID},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	var member tgbotapi.ChatMember
+	if err := json.Unmarshal(resp.Result, &member); err != nil {
+		return false, err
+	}
+	return member.IsCreator() || member.IsAdministrator(), nil
+}
+
+// renderSettings builds the summary of a chat's settings with either the
+// field buttons or, if field is set, the choices for that field
+func (h *BotHandler) renderSettings(settings models.ChatSettings, field string) (string, tgbotapi.InlineKeyboardMarkup) {
+	l := localeFor(settings.Language)
+
+	text := l.settingsTitle + "\n\n"
+	for _, f := range settingsFields {
+		text += fmt.Sprintf("%s: %s\n", l.settingsFields[f], settingText(l, f, settingValue(settings, f)))
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	if field == "" {
+		for i := 0; i < len(settingsFields); i += 2 {
+			var row []tgbotapi.InlineKeyboardButton
+			for _, f := range settingsFields[i:min(i+2, len(settingsFields))] {
+				row = append(row, tgbotapi.NewInlineKeyboardButtonData(l.settingsFields[f], "set_"+f))
+			}
+			rows = append(rows, row)
+		}
+		return text, tgbotapi.NewInlineKeyboardMarkup(rows...)
+	}
+
+	choices := settingsChoices[field]
+	if field == settingPenalty {
+		choices = h.service.PenaltyModes()
+	}
+
+	current := settingValue(settings, field)
+	for _, value := range choices {
+		label := settingText(l, field, value)
+		if value == current {
+			label = "• " + label + " •"
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("set_%s_%s", field, value)),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(l.settingsBack, "set_menu")))
+	return text, tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// settingValue encodes a field's current value like its choices
+func settingValue(settings models.ChatSettings, field string) string {
+	switch field {
+	case settingMinBet:
+		return strconv.Itoa(settings.MinBet)
+	case settingMaxBet:
+		return strconv.Itoa(settings.MaxBet)
+	case settingWindow:
+		return strconv.Itoa(int(settings.VotingWindow / time.Minute))
+	case settingQuorum:
+		return strconv.Itoa(settings.ApprovalPercent)
+	case settingPenalty:
+		return settings.PenaltyMode
+	case settingRemind:
+		if len(settings.ReminderOffsets) == 0 {
+			return "off"
+		}
+		minutes := make([]string, len(settings.ReminderOffsets))
+		for i, offset := range settings.ReminderOffsets {
+			minutes[i] = strconv.Itoa(int(offset / time.Minute))
+		}
+		return strings.Join(minutes, ",")
+	case settingFee:
+		return strconv.Itoa(settings.ChangeFee)
+	case settingChange:
+		return strconv.Itoa(settings.ChangeWindow)
+	case settingLang:
+		return settings.Language
+	}
+	return ""
+}
+
+// settingText describes an encoded value of a field for users
+func settingText(l *locale, field, value string) string {
+	switch field {
+	case settingMinBet:
+		return value + " ⭐"
+	case settingMaxBet:
+		if value == "0" {
+			return l.settingsNoLimit
+		}
+		return value + " ⭐"
+	case settingWindow:
+		minutes, _ := strconv.Atoi(value)
+		if minutes == 0 {
+			return l.settingsNoLimit
+		}
+		return l.duration(time.Duration(minutes) * time.Minute)
+	case settingQuorum:
+		return value + "%"
+	case settingPenalty:
+		return l.penaltyModes[value]
+	case settingRemind:
+		if value == "off" {
+			return l.settingsOff
+		}
+		var offsets []string
+		for _, part := range strings.Split(value, ",") {
+			minutes, _ := strconv.Atoi(part)
+			offsets = append(offsets, l.duration(time.Duration(minutes)*time.Minute))
+		}
+		return strings.Join(offsets, ", ")
+	case settingFee:
+		return value + "%"
+	case settingChange:
+		switch value {
+		case "0":
+			return l.changeForbidden
+		case "100":
+			return l.changeUntilDeadline
+		}
+		return fmt.Sprintf(l.changeWindow, value)
+	case settingLang:
+		return l.languages[value]
+	}
+	return value
+}
+
+// applySetting decodes value into a field of settings. The result is
+// validated as a whole when it is saved.
+func applySetting(settings *models.ChatSettings, field, value string) error {
+	number := func() (int, error) {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, service.UserErrorf("неверное значение: %s", value)
+		}
+		return n, nil
+	}
+
+	var err error
+	switch field {
+	case settingMinBet:
+		settings.MinBet, err = number()
+	case settingMaxBet:
+		settings.MaxBet, err = number()
+	case settingWindow:
+		var minutes int
+		minutes, err = number()
+		settings.VotingWindow = time.Duration(minutes) * time.Minute
+	case settingQuorum:
+		settings.ApprovalPercent, err = number()
+	case settingPenalty:
+		settings.PenaltyMode = value
+	case settingRemind:
+		settings.ReminderOffsets = nil
+		if value == "off" {
+			break
+		}
+		for _, part := range strings.Split(value, ",") {
+			minutes, convErr := strconv.Atoi(part)
+			if convErr != nil {
+				return service.UserErrorf("неверное значение: %s", value)
+			}
+			settings.ReminderOffsets = append(settings.ReminderOffsets, time.Duration(minutes)*time.Minute)
+		}
+	case settingFee:
+		settings.ChangeFee, err = number()
+	case settingChange:
+		settings.ChangeWindow, err = number()
+	case settingLang:
+		settings.Language = value
+	default:
+		return service.UserErrorf("неизвестная настройка: %s", field)
+	}
+	return err
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"awesomeProject/internal/models"
+	"awesomeProject/internal/service"
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log/slog"
+	"time"
+)
+
+// payoutTitles describes each payout kind, in button order; the titles are
+// translated when rendered
+var payoutTitles = []struct {
+	kind  string
+	title string
+}{
+	{models.PayoutSeason, "🏆 Призы победителям сезона"},
+	{models.PayoutEqual, "➗ Поровну между участниками"},
+}
+
+func (h *BotHandler) handleTreasury(ctx context.Context, message *tgbotapi.Message) {
+	text, keyboard, err := h.renderTreasury(ctx, message.Chat.ID, 0)
+	if err != nil {
+		h.send(ctx, tgbotapi.NewMessage(message.Chat.ID, localeFrom(ctx).errorText("❌ Ошибка: %v", err)))
+		return
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	if keyboard != nil {
+		msg.ReplyMarkup = *keyboard
+	}
+	h.send(ctx, msg)
+}
+
+// renderTreasury builds the treasury balance with a page of its ledger and
+// the pagination buttons
+func (h *BotHandler) renderTreasury(ctx context.Context, chatID int64, page int) (string, *tgbotapi.InlineKeyboardMarkup, error) {
+	l := localeFrom(ctx)
+
+	treasury, err := h.service.GetTreasury(ctx, chatID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	entries, pages, err := h.service.GetTreasuryHistory(ctx, chatID, page)
+	if err != nil {
+		return "", nil, err
+	}
+
+	text := l.f("💰 Казна беседы: %d ⭐\n", treasury.Balance)
+	text += l.f("📅 Сезон: %s\n", seasonText(l, treasury.SeasonStartedAt))
+	if len(entries) == 0 {
+		text += l.t("\n📜 Операций с казной пока не было. Штрафы попадают в казну, если администраторы выбрали это в /settings.")
+		return text, nil, nil
+	}
+
+	text += l.f("\n📜 Операции (стр. %d/%d):\n\n", page+1, pages)
+	for _, entry := range entries {
+		text += historyEntryText(l, entry)
+	}
+
+	var row []tgbotapi.InlineKeyboardButton
+	if page > 0 {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(l.t("⬅️ Назад"), fmt.Sprintf("treasury_%d", page-1)))
+	}
+	if page < pages-1 {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(l.t("Вперед ➡️"), fmt.Sprintf("treasury_%d", page+1)))
+	}
+	if len(row) == 0 {
+		return text, nil, nil
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(row)
+	return text, &keyboard, nil
+}
+
+func (h *BotHandler) handlePayout(ctx context.Context, message *tgbotapi.Message) {
+	l := localeFrom(ctx)
+
+	admin, err := h.isChatAdmin(message.Chat, message.From.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error checking chat admin", "error", err)
+		h.send(ctx, tgbotapi.NewMessage(message.Chat.ID, l.settingsFailed))
+		return
+	}
+	if !admin {
+		h.send(ctx, tgbotapi.NewMessage(message.Chat.ID, l.t("⛔ Выплаты из казны доступны только администраторам.")))
+		return
+	}
+
+	text, keyboard, err := h.renderPayoutMenu(ctx, message.Chat.ID)
+	if err != nil {
+		h.send(ctx, tgbotapi.NewMessage(message.Chat.ID, l.errorText("❌ Ошибка: %v", err)))
+		return
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	msg.ReplyMarkup = keyboard
+	h.send(ctx, msg)
+}
+
+// handlePayoutCallback handles a press in the /payout menu; parts is the
+// split callback data without the leading "pay": menu shows the menu,
+// <kind> previews a payout and <kind>_ok makes it
+func (h *BotHandler) handlePayoutCallback(ctx context.Context, query *tgbotapi.CallbackQuery, parts []string) {
+	chatID := query.Message.Chat.ID
+	l := localeFrom(ctx)
+
+	// Anyone can press the buttons, so check every time
+	admin, err := h.isChatAdmin(query.Message.Chat, query.From.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error checking chat admin", "error", err)
+		h.answerCallback(ctx, query, l.settingsFailed)
+		return
+	}
+	if !admin {
+		h.answerCallback(ctx, query, l.t("⛔ Выплаты из казны доступны только администраторам."))
+		return
+	}
+
+	kind := parts[0]
+	if kind == "menu" {
+		text, keyboard, err := h.renderPayoutMenu(ctx, chatID)
+		if err != nil {
+			h.answerCallback(ctx, query, l.errorText("❌ %v", err))
+			return
+		}
+		h.send(ctx, tgbotapi.NewEditMessageTextAndMarkup(chatID, query.Message.MessageID, text, keyboard))
+		h.answerCallback(ctx, query, "")
+		return
+	}
+
+	if len(parts) < 2 || parts[1] != "ok" {
+		payout, err := h.service.PlanPayout(ctx, chatID, kind)
+		if err != nil {
+			h.answerCallback(ctx, query, l.errorText("❌ %v", err))
+			return
+		}
+
+		text := l.t("Предстоящая выплата из казны:\n\n") + payoutText(l, payout)
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(l.t("✅ Выплатить"), fmt.Sprintf("pay_%s_ok", kind))),
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(l.t("⬅️ Назад"), "pay_menu")),
+		)
+		h.send(ctx, tgbotapi.NewEditMessageTextAndMarkup(chatID, query.Message.MessageID, text, keyboard))
+		h.answerCallback(ctx, query, "")
+		return
+	}
+
+	payout, err := h.service.PayOutTreasury(ctx, chatID, kind)
+	if err != nil {
+		h.answerCallback(ctx, query, l.errorText("❌ %v", err))
+		return
+	}
+
+	text := l.t("🎉 Казна беседы выплачена!\n\n") + payoutText(l, payout)
+	h.send(ctx, tgbotapi.NewEditMessageText(chatID, query.Message.MessageID, text))
+	h.answerCallback(ctx, query, l.t("✅ Выплачено"))
+}
+
+// renderPayoutMenu builds the treasury balance with the payout kinds
+func (h *BotHandler) renderPayoutMenu(ctx context.Context, chatID int64) (string, tgbotapi.InlineKeyboardMarkup, error) {
+	l := localeFrom(ctx)
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, p := range payoutTitles {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(l.t(p.title), "pay_"+p.kind)))
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+
+	treasury, err := h.service.GetTreasury(ctx, chatID)
+	if err != nil {
+		return "", keyboard, err
+	}
+
+	text := l.f("💰 Казна беседы: %d ⭐\n📅 Сезон: %s\n\nКак распределить казну?", treasury.Balance, seasonText(l, treasury.SeasonStartedAt))
+	return text, keyboard, nil
+}
+
+// payoutText lists the shares of a payout
+func payoutText(l *locale, payout *service.Payout) string {
+	var title string
+	for _, p := range payoutTitles {
+		if p.kind == payout.Kind {
+			title = l.t(p.title)
+		}
+	}
+
+	text := fmt.Sprintf("%s — %d ⭐\n", title, payout.Total)
+	if payout.Kind == models.PayoutSeason {
+		text += l.f("📅 Сезон: %s\n", seasonText(l, payout.SeasonStartedAt))
+	}
+	text += "\n"
+
+	for _, share := range payout.Shares {
+		text += fmt.Sprintf("@%s — %d ⭐", share.User.Username, share.Amount)
+		if payout.Kind == models.PayoutSeason {
+			text += fmt.Sprintf(" (%d %s)", share.Succeeded, l.plural(share.Succeeded, "цель", "цели", "целей"))
+		}
+		text += "\n"
+	}
+	return text
+}
+
+// seasonText describes when the current treasury season started
+func seasonText(l *locale, startedAt *time.Time) string {
+	if startedAt == nil {
+		return l.t("с создания беседы")
+	}
+	return l.f("с %s", startedAt.Format("02.01.2006 15:04"))
+}
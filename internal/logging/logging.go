@@ -0,0 +1,89 @@
+// Package logging configures structured logging with log/slog. Fields that
+// identify the work being done (update, chat, user, command, goal) are
+// attached to a context with With and added to every record logged through
+// slog's *Context functions with that context.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Field names of the request-scoped attributes
+const (
+	UpdateID = "update_id"
+	ChatID   = "chat_id"
+	UserID   = "user_id"
+	Command  = "command"
+	GoalID   = "goal_id"
+)
+
+type attrsKey struct{}
+
+// With returns a copy of ctx carrying args, given as alternating keys and
+// values like slog.Logger.With, in addition to the attributes already on ctx
+func With(ctx context.Context, args ...any) context.Context {
+	var record slog.Record
+	record.Add(args...)
+
+	attrs := fromContext(ctx)
+	attrs = attrs[:len(attrs):len(attrs)] // never share the parent's backing array
+	record.Attrs(func(attr slog.Attr) bool {
+		attrs = append(attrs, attr)
+		return true
+	})
+
+	return context.WithValue(ctx, attrsKey{}, attrs)
+}
+
+func fromContext(ctx context.Context) []slog.Attr {
+	attrs, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	return attrs
+}
+
+// New returns a logger writing to w. level is debug, info, warn or error;
+// format is text or json.
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("unknown log level %q", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "text":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+
+	return slog.New(contextHandler{handler}), nil
+}
+
+// contextHandler adds the attributes stored by With to each record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if attrs := fromContext(ctx); len(attrs) > 0 {
+		record = record.Clone()
+		record.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
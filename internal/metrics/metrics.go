@@ -0,0 +1,79 @@
+// Package metrics defines the Prometheus metrics exported by the bot. They
+// are registered with the default registry, which also carries the Go
+// runtime and process collectors.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+const namespace = "goalsbot"
+
+var (
+	// Updates counts received Telegram updates by type (message, callback_query, other)
+	Updates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "updates_total",
+		Help:      "Telegram updates received, by update type.",
+	}, []string{"type"})
+
+	// Commands counts handled bot commands; unknown commands share one label
+	Commands = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "commands_total",
+		Help:      "Bot commands handled, by command.",
+	}, []string{"command"})
+
+	// HandlerDuration observes how long handling an update took
+	HandlerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "handler_duration_seconds",
+		Help:      "Time spent handling an update, by update type.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"type"})
+
+	// TelegramErrors counts failed Telegram Bot API calls by request type
+	TelegramErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "telegram_errors_total",
+		Help:      "Failed Telegram Bot API calls, by request type.",
+	}, []string{"request"})
+
+	// QueryDuration observes repository calls by method, including failed ones
+	QueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Time spent in a repository call, by repository method.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"method"})
+
+	// Goals counts goal lifecycle events: created, succeeded and failed
+	Goals = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "goals_total",
+		Help:      "Goals created and resolved, by outcome.",
+	}, []string{"outcome"})
+
+	// StarsMoved counts stars moved by committed transactions, by reason
+	StarsMoved = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stars_moved_total",
+		Help:      "Stars moved between balances and escrow, by transaction reason.",
+	}, []string{"reason"})
+)
+
+// Goal outcomes used as the Goals label
+const (
+	GoalCreated   = "created"
+	GoalSucceeded = "succeeded"
+	GoalFailed    = "failed"
+	GoalCancelled = "cancelled"
+)
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
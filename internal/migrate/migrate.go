@@ -0,0 +1,323 @@
+package migrate
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// advisoryLockKey serializes migrations between bot instances starting at once
+const advisoryLockKey = 7_466_129_001
+
+// ErrUntracked is returned when the database already has tables but no
+// applied versions, e.g. because migrations used to be applied by hand
+var ErrUntracked = errors.New("database schema exists but is not tracked in schema_migrations; record the applied version with `migrate baseline <version>`")
+
+var fileName = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration is a pair of SQL scripts moving the schema to Version and back
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string // Empty if the migration cannot be reverted
+}
+
+// Status describes whether a migration has been applied
+type Status struct {
+	Migration
+	AppliedAt *time.Time // nil if pending
+}
+
+// Migrator applies migrations and records them in the schema_migrations table
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration // Sorted by version
+}
+
+// New loads migrations named NN_name.up.sql / NN_name.down.sql from fsys
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has files with different names: %s and %s", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrator := &Migrator{db: db}
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", m.Version, m.Name)
+		}
+		migrator.migrations = append(migrator.migrations, *m)
+	}
+	sort.Slice(migrator.migrations, func(i, j int) bool {
+		return migrator.migrations[i].Version < migrator.migrations[j].Version
+	})
+
+	return migrator, nil
+}
+
+// Latest returns the version the code expects, 0 if there are no migrations
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Status lists every known migration with its applied time
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, len(m.migrations))
+	for i, migration := range m.migrations {
+		statuses[i].Migration = migration
+		if at, ok := applied[migration.Version]; ok {
+			at := at
+			statuses[i].AppliedAt = &at
+		}
+	}
+	return statuses, nil
+}
+
+// Check verifies the database schema matches the code. It reports the
+// migrations that are still pending and fails if the database has versions
+// the code does not know about.
+func (m *Migrator) Check() (pending []Migration, err error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.checkKnown(applied); err != nil {
+		return nil, err
+	}
+	if len(applied) == 0 {
+		if err := m.checkUntracked(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies all pending migrations in version order, each in its own
+// transaction, and returns the ones it applied
+func (m *Migrator) Up() ([]Migration, error) {
+	pending, err := m.Check()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, migration := range pending {
+		applied := false
+		err := m.inLockedTx(func(tx *sql.Tx) error {
+			// Another instance may have applied it while we waited for the lock
+			var exists bool
+			err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, migration.Version).Scan(&exists)
+			if err != nil || exists {
+				return err
+			}
+
+			if _, err := tx.Exec(migration.Up); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, migration.Version, migration.Name); err != nil {
+				return err
+			}
+			applied = true
+			return nil
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		if applied {
+			done = append(done, migration)
+		}
+	}
+	return done, nil
+}
+
+// Down reverts the last steps applied migrations, newest first, and returns
+// the ones it reverted
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkKnown(applied); err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if migration.Down == "" {
+			return done, fmt.Errorf("migration %d_%s cannot be reverted: no down script", migration.Version, migration.Name)
+		}
+
+		err := m.inLockedTx(func(tx *sql.Tx) error {
+			if _, err := tx.Exec(migration.Down); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Baseline records migrations up to and including version as applied
+// without running them, for databases that were migrated by hand
+func (m *Migrator) Baseline(version int) error {
+	if version > m.Latest() {
+		return fmt.Errorf("unknown version %d, latest is %d", version, m.Latest())
+	}
+
+	if err := m.ensureTable(); err != nil {
+		return err
+	}
+
+	return m.inLockedTx(func(tx *sql.Tx) error {
+		for _, migration := range m.migrations {
+			if migration.Version > version {
+				break
+			}
+			_, err := tx.Exec(`
+				INSERT INTO schema_migrations (version, name) VALUES ($1, $2)
+				ON CONFLICT (version) DO NOTHING
+			`, migration.Version, migration.Name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (m *Migrator) ensureTable() error {
+	_, err := m.db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations(
+			version INT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	return err
+}
+
+// applied returns the applied versions and when they were applied
+func (m *Migrator) applied() (map[int]time.Time, error) {
+	if err := m.ensureTable(); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// checkKnown fails if the database has versions newer than the code
+func (m *Migrator) checkKnown(applied map[int]time.Time) error {
+	for version := range applied {
+		if version > m.Latest() {
+			return fmt.Errorf("database schema version %d is newer than this build supports (%d); upgrade the bot", version, m.Latest())
+		}
+	}
+	return nil
+}
+
+// checkUntracked fails if tables from the first migration exist although no
+// version was recorded
+func (m *Migrator) checkUntracked() error {
+	var exists bool
+	if err := m.db.QueryRow(`SELECT to_regclass('users') IS NOT NULL`).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return ErrUntracked
+	}
+	return nil
+}
+
+// inLockedTx runs fn in a transaction holding the migration advisory lock
+func (m *Migrator) inLockedTx(fn func(tx *sql.Tx) error) (err error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, advisoryLockKey); err != nil {
+		return err
+	}
+	return fn(tx)
+}
@@ -0,0 +1,103 @@
+package migrate
+
+import (
+	"awesomeProject/migrations"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestNewParsesAndOrdersMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"10_settings.up.sql":   {Data: []byte("CREATE TABLE settings();")},
+		"10_settings.down.sql": {Data: []byte("DROP TABLE settings;")},
+		"2_users.up.sql":       {Data: []byte("CREATE TABLE users();")},
+		"2_users.down.sql":     {Data: []byte("DROP TABLE users;")},
+		"1_init.up.sql":        {Data: []byte("CREATE TABLE init();")},
+		"embed.go":             {Data: []byte("package migrations")},
+		"README.md":            {Data: []byte("not a migration")},
+		"3_seed.sql":           {Data: []byte("not a migration either")},
+		"4_dir.up.sql/x":       {Data: []byte("directories are skipped")},
+	}
+
+	m, err := New(nil, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Versions sort numerically, not by file name
+	want := []Migration{
+		{Version: 1, Name: "init", Up: "CREATE TABLE init();"},
+		{Version: 2, Name: "users", Up: "CREATE TABLE users();", Down: "DROP TABLE users;"},
+		{Version: 10, Name: "settings", Up: "CREATE TABLE settings();", Down: "DROP TABLE settings;"},
+	}
+	if len(m.migrations) != len(want) {
+		t.Fatalf("expected %d migrations, got %+v", len(want), m.migrations)
+	}
+	for i := range want {
+		if m.migrations[i] != want[i] {
+			t.Errorf("migration %d: expected %+v, got %+v", i, want[i], m.migrations[i])
+		}
+	}
+	if m.Latest() != 10 {
+		t.Errorf("expected latest version 10, got %d", m.Latest())
+	}
+}
+
+func TestNewRejectsInconsistentFiles(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+		want string
+	}{
+		{"down without up", fstest.MapFS{
+			"1_init.down.sql": {Data: []byte("DROP TABLE init;")},
+		}, "no up script"},
+		{"names differ", fstest.MapFS{
+			"1_init.up.sql":    {Data: []byte("CREATE TABLE init();")},
+			"1_setup.down.sql": {Data: []byte("DROP TABLE init;")},
+		}, "different names"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(nil, tt.fsys)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected an error with %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLatestWithoutMigrations(t *testing.T) {
+	m, err := New(nil, fstest.MapFS{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Latest() != 0 {
+		t.Errorf("expected version 0, got %d", m.Latest())
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	m, err := New(nil, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.migrations) == 0 {
+		t.Fatal("expected embedded migrations")
+	}
+
+	for i, migration := range m.migrations {
+		// Versions run 1, 2, 3... so a gap or a duplicate number stands out
+		if migration.Version != i+1 {
+			t.Errorf("expected version %d, got %d_%s", i+1, migration.Version, migration.Name)
+		}
+		if strings.TrimSpace(migration.Up) == "" {
+			t.Errorf("migration %d_%s has an empty up script", migration.Version, migration.Name)
+		}
+		if strings.TrimSpace(migration.Down) == "" {
+			t.Errorf("migration %d_%s has no down script", migration.Version, migration.Name)
+		}
+	}
+}
@@ -4,25 +4,60 @@ import "time"
 
 // User represents a user in the system.
 type User struct {
-	ID        int       // Internal ID
-	TgID      int64     // Telegram ID of the user
-	Username  string    // @nickname or name
-	Balance   int       // Balance of "stars"
-	CreatedAt time.Time // When the user was added to the system
+	ID            int       // Internal ID
+	TgID          int64     // Telegram ID of the user
+	Username      string    // @nickname or name
+	Balance       int       // Available balance of "stars"
+	LockedBalance int       // Stars held in escrow as bets on unresolved goals
+	CreatedAt     time.Time // When the user was added to the system
 }
 
 // Goal represents a goal created by a user.
 type Goal struct {
-	ID               int       // Goal ID
-	UserID           int       // Author of the goal (foreign key to users.id)
-	Title            string    // Title of the goal
-	Description      string    // Description of the goal
-	Deadline         time.Time // Deadline for the goal
-	Bet              int       // Number of "stars" as penalty
-	Status           string    // Status: active / done_pending / success / failed
-	CreatedAt        time.Time // When the goal was created
-	VotingStartedAt  *time.Time
-	ChatMembersCount int
+	ID               int        // Goal ID
+	UserID           int        // Author of the goal (foreign key to users.id)
+	ChatID           int64      // Chat where the goal was created
+	Title            string     // Title of the goal
+	Description      string     // Description of the goal
+	Deadline         time.Time  // Deadline for the goal
+	Bet              int        // Number of "stars" as penalty
+	Status           string     // Status: active / done_pending / success / failed / cancelled
+	CreatedAt        time.Time  // When the goal was created
+	VotingStartedAt  *time.Time // When proof was submitted and voting opened
+	VotingEndsAt     *time.Time // When voting is resolved automatically, nil if never
+	ChatMembersCount int        // Number of members eligible to vote, frozen when voting opens
+	RequiredVotes    int        // Yes votes needed for success, frozen when voting opens
+}
+
+// ConversationState is the progress of a multi-step dialog such as /newgoal,
+// stored between updates as JSON.
+type ConversationState struct {
+	Step        string    `json:"step"`                  // Current step, e.g. awaiting_title
+	GoalID      int       `json:"goal_id,omitempty"`     // Goal the dialog is about, e.g. for proofs
+	Title       string    `json:"title,omitempty"`       // Title entered so far
+	Description string    `json:"description,omitempty"` // Description entered so far
+	Deadline    time.Time `json:"deadline,omitempty"`    // Deadline entered so far
+	Bet         int       `json:"bet,omitempty"`         // Bet entered so far
+}
+
+// Proof kinds, matching the Telegram message type the proof was sent as.
+const (
+	ProofText      = "text"
+	ProofPhoto     = "photo"
+	ProofVideo     = "video"
+	ProofDocument  = "document"
+	ProofVoice     = "voice"
+	ProofVideoNote = "video_note"
+)
+
+// Proof represents evidence submitted for a goal.
+type Proof struct {
+	ID        int       // Proof ID
+	GoalID    int       // Reference to the goal (foreign key to goals.id)
+	Kind      string    // One of the Proof* kinds
+	FileID    string    // Telegram file_id, empty for text proofs
+	Caption   string    // Text of the proof or the media caption
+	CreatedAt time.Time // When the proof was submitted
 }
 
 // Vote represents a vote on a goal.
@@ -36,10 +71,109 @@ type Vote struct {
 
 // Transaction represents a transaction of "stars".
 type Transaction struct {
-	ID        int       // Transaction ID
-	FromUser  int       // From whom the stars were deducted (foreign key to users.id)
-	ToUser    int       // To whom the stars were added (foreign key to users.id)
-	Amount    int       // Number of stars transferred
-	Reason    string    // Reason for the transaction (penalty, reward, transfer)
-	CreatedAt time.Time // Date of the transaction
+	ID             int       // Transaction ID
+	FromUser       *int      // From whom the stars were deducted (foreign key to users.id), nil for escrow or the treasury
+	ToUser         *int      // To whom the stars were added (foreign key to users.id), nil for escrow, the treasury or burned stars
+	Amount         int       // Number of stars transferred
+	Reason         string    // Reason for the transaction (escrow_lock, escrow_release, penalty_<mode> or treasury_<kind>)
+	GoalID         *int      // Goal the transaction belongs to, if any
+	TreasuryChatID *int64    // Chat whose treasury is on the nil user side, if any
+	CreatedAt      time.Time // Date of the transaction
+}
+
+// HistoryEntry is a transaction as seen by one of its participants.
+type HistoryEntry struct {
+	Transaction
+	Incoming     bool   // True if the stars were added to the user
+	Counterparty string // Username on the other side, empty for escrow
+	GoalTitle    string // Title of the linked goal, empty if none
+}
+
+// Leaderboard metrics selectable in /top.
+const (
+	LeaderboardBalance = "balance" // Total stars, available plus locked
+	LeaderboardSuccess = "success" // Number of successful goals
+	LeaderboardRate    = "rate"    // Share of resolved goals that succeeded
+	LeaderboardWon     = "won"     // Stars received from other members' penalties
+)
+
+// LeaderboardEntry holds a chat member's aggregates for the leaderboard.
+type LeaderboardEntry struct {
+	User        User    // The member
+	Succeeded   int     // Goals in the chat that ended in success
+	Resolved    int     // Goals in the chat that ended in success or failure
+	SuccessRate float64 // Succeeded / Resolved, 0 if nothing was resolved
+	StarsWon    int     // Stars received from penalties in the chat
+}
+
+// Penalty distribution modes selectable per chat. Penalty transactions are
+// recorded with the reason "penalty_" followed by the mode.
+const (
+	PenaltyMembers  = "members"  // Split evenly among all chat members except the author
+	PenaltyVoters   = "voters"   // Split evenly among the members who voted on the goal, or all other members if nobody voted
+	PenaltyWeighted = "weighted" // Split among members in proportion to the votes they cast in the chat
+	PenaltyTreasury = "treasury" // Sent to the chat treasury
+	PenaltyBurn     = "burn"     // Destroyed
+	PenaltyCharity  = "charity"  // Sent to the designated charity account
+)
+
+// PenaltyModes lists every penalty mode in menu order.
+var PenaltyModes = []string{PenaltyMembers, PenaltyVoters, PenaltyWeighted, PenaltyTreasury, PenaltyBurn, PenaltyCharity}
+
+// Treasury is a chat's common pot. Penalties in treasury mode fill it and
+// the chat's admins pay it out.
+type Treasury struct {
+	ChatID          int64      // Chat the treasury belongs to
+	Balance         int        // Stars in the treasury
+	SeasonStartedAt *time.Time // When season prizes were last paid out, nil if never
+	CreatedAt       time.Time  // When the treasury received its first stars
+}
+
+// Treasury payout kinds. Payouts are recorded with the reason "treasury_"
+// followed by the kind.
+const (
+	PayoutEqual  = "equal"  // Split evenly among all chat members
+	PayoutSeason = "season" // Prizes for the members who achieved the most goals this season
+)
+
+// Languages the bot can talk in.
+const (
+	LanguageRussian = "ru"
+	LanguageEnglish = "en"
+)
+
+// ChatSettings are the rules a chat's admins chose with /settings. Chats
+// that never saved settings use the bot-wide defaults.
+type ChatSettings struct {
+	ChatID          int64           // Chat the settings belong to
+	MinBet          int             // Smallest bet allowed
+	MaxBet          int             // Largest bet allowed, 0 for no limit
+	VotingWindow    time.Duration   // How long voting stays open after proof, 0 for no limit
+	ApprovalPercent int             // Share of eligible voters, 1-100, whose yes votes approve a goal
+	PenaltyMode     string          // One of the Penalty* modes
+	ReminderOffsets []time.Duration // How long before a deadline to remind, empty for no reminders
+	Language        string          // One of the Language* codes
+	ChangeFee       int             // Percent of the bet, 0-100, charged to extend a deadline or cancel a goal
+	ChangeWindow    int             // Percent of a goal's time, 0-100, during which it may be extended or cancelled; 0 forbids both
+	UpdatedAt       time.Time       // When the settings were last saved
+}
+
+// Kinds of goal changes recorded in the audit trail.
+const (
+	GoalChangeTitle       = "title"       // Title edited
+	GoalChangeDescription = "description" // Description edited
+	GoalChangeDeadline    = "deadline"    // Deadline extended
+	GoalChangeCancel      = "cancel"      // Goal withdrawn by its author
+)
+
+// GoalChange is an entry of a goal's audit trail.
+type GoalChange struct {
+	ID        int       // Change ID
+	GoalID    int       // Changed goal (foreign key to goals.id)
+	UserID    int       // Who made the change (foreign key to users.id)
+	Kind      string    // One of the GoalChange* kinds
+	OldValue  string    // Value before the change: a text, a deadline in RFC 3339 or a status
+	NewValue  string    // Value after the change, in the same form
+	Fee       int       // Stars charged for the change
+	CreatedAt time.Time // When the change was made
 }
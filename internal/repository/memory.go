@@ -0,0 +1,1294 @@
+package repository
+
+import (
+	"awesomeProject/internal/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type memberKey struct {
+	chatID int64
+	userID int
+}
+
+type voteKey struct {
+	goalID  int
+	voterID int
+}
+
+type reminderKey struct {
+	goalID        int
+	offsetMinutes int
+}
+
+type conversationKey struct {
+	chatID int64
+	userID int64
+}
+
+type memoryConversation struct {
+	state     []byte
+	expiresAt time.Time
+}
+
+// memoryData holds the tables of a MemoryRepository. Rows are stored by
+// value so a copy of the maps is a full snapshot.
+type memoryData struct {
+	lastID map[string]int
+
+	users         map[int]models.User
+	usersByTgID   map[int64]int
+	goals         map[int]models.Goal
+	proofMessages map[int]string
+	goalVoters    map[voteKey]struct{}
+	proofs        map[int]models.Proof
+	goalChanges   map[int]models.GoalChange
+	reminders     map[reminderKey]struct{}
+	votes         map[voteKey]models.Vote
+	chatMembers   map[memberKey]time.Time
+	conversations map[conversationKey]memoryConversation
+	chatSettings  map[int64]models.ChatSettings
+	treasuries    map[int64]models.Treasury
+	transactions  map[int]models.Transaction
+}
+
+func newMemoryData() *memoryData {
+	return &memoryData{
+		lastID:        make(map[string]int),
+		users:         make(map[int]models.User),
+		usersByTgID:   make(map[int64]int),
+		goals:         make(map[int]models.Goal),
+		proofMessages: make(map[int]string),
+		goalVoters:    make(map[voteKey]struct{}),
+		proofs:        make(map[int]models.Proof),
+		goalChanges:   make(map[int]models.GoalChange),
+		reminders:     make(map[reminderKey]struct{}),
+		votes:         make(map[voteKey]models.Vote),
+		chatMembers:   make(map[memberKey]time.Time),
+		conversations: make(map[conversationKey]memoryConversation),
+		chatSettings:  make(map[int64]models.ChatSettings),
+		treasuries:    make(map[int64]models.Treasury),
+		transactions:  make(map[int]models.Transaction),
+	}
+}
+
+func (d *memoryData) clone() *memoryData {
+	c := newMemoryData()
+	copyMap(c.lastID, d.lastID)
+	copyMap(c.users, d.users)
+	copyMap(c.usersByTgID, d.usersByTgID)
+	copyMap(c.goals, d.goals)
+	copyMap(c.proofMessages, d.proofMessages)
+	copyMap(c.goalVoters, d.goalVoters)
+	copyMap(c.proofs, d.proofs)
+	copyMap(c.goalChanges, d.goalChanges)
+	copyMap(c.reminders, d.reminders)
+	copyMap(c.votes, d.votes)
+	copyMap(c.chatMembers, d.chatMembers)
+	copyMap(c.conversations, d.conversations)
+	copyMap(c.chatSettings, d.chatSettings)
+	copyMap(c.treasuries, d.treasuries)
+	copyMap(c.transactions, d.transactions)
+	return c
+}
+
+func copyMap[K comparable, V any](dst, src map[K]V) {
+	for k, v := range src {
+		dst[k] = v
+	}
+}
+
+// nextID returns the next value of a table's SERIAL column
+func (d *memoryData) nextID(table string) int {
+	d.lastID[table]++
+	return d.lastID[table]
+}
+
+// MemoryRepository is a Store that keeps everything in memory. It mirrors the
+// PostgreSQL schema's constraints (one vote per voter, unique chat members,
+// cascading deletes) and is meant for tests and local experiments.
+type MemoryRepository struct {
+	mu     *sync.Mutex
+	data   **memoryData
+	inTx   bool // true when bound to a transaction that already holds mu
+	config Config
+}
+
+// NewMemoryRepository returns an empty MemoryRepository. config.QueryTimeout
+// is ignored since nothing waits on I/O.
+func NewMemoryRepository(config Config) *MemoryRepository {
+	data := newMemoryData()
+	return &MemoryRepository{mu: &sync.Mutex{}, data: &data, config: config}
+}
+
+// WithTx runs fn with exclusive access to the repository. Changes made by fn
+// are kept if it returns nil and discarded otherwise. Nested calls reuse the
+// outer transaction. Cancelling ctx makes the remaining calls in fn fail.
+func (r *MemoryRepository) WithTx(ctx context.Context, fn func(tx Store) error) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if r.inTx {
+		return fn(r)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	committed := *r.data
+	working := committed.clone()
+	*r.data = working
+
+	defer func() {
+		if p := recover(); p != nil {
+			*r.data = committed
+			panic(p)
+		}
+		if err != nil {
+			*r.data = committed
+		}
+	}()
+
+	return fn(&MemoryRepository{mu: r.mu, data: r.data, inTx: true, config: r.config})
+}
+
+// lock acquires the repository for a single call and returns the tables.
+// Inside WithTx the lock is already held. Like a query on a cancelled
+// context, it fails if ctx is done.
+func (r *MemoryRepository) lock(ctx context.Context) (*memoryData, func(), error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	if r.inTx {
+		return *r.data, func() {}, nil
+	}
+	r.mu.Lock()
+	return *r.data, r.mu.Unlock, nil
+}
+
+// User methods
+func (r *MemoryRepository) GetOrCreateUser(ctx context.Context, tgID int64, username string) (*models.User, error) {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if id, ok := d.usersByTgID[tgID]; ok {
+		user := d.users[id]
+		return &user, nil
+	}
+
+	user := models.User{
+		ID:        d.nextID("users"),
+		TgID:      tgID,
+		Username:  username,
+		Balance:   r.config.StartingBalance,
+		CreatedAt: time.Now(),
+	}
+	d.users[user.ID] = user
+	d.usersByTgID[tgID] = user.ID
+	return &user, nil
+}
+
+func (r *MemoryRepository) GetUserByID(ctx context.Context, id int64) (*models.User, error) {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	user, ok := d.users[int(id)]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &user, nil
+}
+
+func (r *MemoryRepository) GetUserByTgID(ctx context.Context, tgID int64) (*models.User, error) {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	id, ok := d.usersByTgID[tgID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	user := d.users[id]
+	return &user, nil
+}
+
+// DeleteUser removes a user together with their goals, votes, goal changes
+// and chat memberships; transactions keep their amounts with the user unset
+func (r *MemoryRepository) DeleteUser(ctx context.Context, userID int) error {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	user, ok := d.users[userID]
+	if !ok {
+		return nil
+	}
+
+	for id, goal := range d.goals {
+		if goal.UserID == userID {
+			d.deleteGoal(id)
+		}
+	}
+	for key := range d.votes {
+		if key.voterID == userID {
+			delete(d.votes, key)
+		}
+	}
+	for key := range d.goalVoters {
+		if key.voterID == userID {
+			delete(d.goalVoters, key)
+		}
+	}
+	for key := range d.chatMembers {
+		if key.userID == userID {
+			delete(d.chatMembers, key)
+		}
+	}
+	for id, change := range d.goalChanges {
+		if change.UserID == userID {
+			delete(d.goalChanges, id)
+		}
+	}
+	for id, t := range d.transactions {
+		if t.FromUser != nil && *t.FromUser == userID {
+			t.FromUser = nil
+		}
+		if t.ToUser != nil && *t.ToUser == userID {
+			t.ToUser = nil
+		}
+		d.transactions[id] = t
+	}
+
+	delete(d.usersByTgID, user.TgID)
+	delete(d.users, userID)
+	return nil
+}
+
+func (r *MemoryRepository) UpdateUserBalance(ctx context.Context, userID int, amount int) error {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if user, ok := d.users[userID]; ok {
+		user.Balance += amount
+		d.users[userID] = user
+	}
+	return nil
+}
+
+func (r *MemoryRepository) GetUserBalance(ctx context.Context, userID int) (int, error) {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	user, ok := d.users[userID]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return user.Balance, nil
+}
+
+// LockStars moves amount from the available balance into escrow. It reports
+// false without changing anything if the available balance is too small.
+func (r *MemoryRepository) LockStars(ctx context.Context, userID int, amount int) (bool, error) {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	user, ok := d.users[userID]
+	if !ok || user.Balance < amount {
+		return false, nil
+	}
+	user.Balance -= amount
+	user.LockedBalance += amount
+	d.users[userID] = user
+	return true, nil
+}
+
+// ReleaseStars returns amount from escrow back to the available balance
+func (r *MemoryRepository) ReleaseStars(ctx context.Context, userID int, amount int) error {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if user, ok := d.users[userID]; ok {
+		user.Balance += amount
+		user.LockedBalance -= amount
+		d.users[userID] = user
+	}
+	return nil
+}
+
+// SpendLockedStars removes amount from escrow without returning it to the user
+func (r *MemoryRepository) SpendLockedStars(ctx context.Context, userID int, amount int) error {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if user, ok := d.users[userID]; ok {
+		user.LockedBalance -= amount
+		d.users[userID] = user
+	}
+	return nil
+}
+
+// Goal methods
+
+// filterGoals returns copies of the goals matching keep, ordered by less
+func (d *memoryData) filterGoals(keep func(models.Goal) bool, less func(a, b models.Goal) bool) []models.Goal {
+	var goals []models.Goal
+	for _, goal := range d.goals {
+		if keep(goal) {
+			goals = append(goals, goal)
+		}
+	}
+	sort.Slice(goals, func(i, j int) bool {
+		if less(goals[i], goals[j]) {
+			return true
+		}
+		if less(goals[j], goals[i]) {
+			return false
+		}
+		return goals[i].ID < goals[j].ID
+	})
+	return goals
+}
+
+func isOpenGoal(goal models.Goal) bool {
+	return goal.Status == "active" || goal.Status == "done_pending"
+}
+
+func (r *MemoryRepository) CreateGoal(ctx context.Context, userID int, chatID int64, title, description string, deadline time.Time, bet int) (*models.Goal, error) {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if _, ok := d.users[userID]; !ok {
+		return nil, fmt.Errorf("user %d does not exist", userID)
+	}
+
+	goal := models.Goal{
+		ID:          d.nextID("goals"),
+		UserID:      userID,
+		ChatID:      chatID,
+		Title:       title,
+		Description: description,
+		Deadline:    deadline,
+		Bet:         bet,
+		Status:      "active",
+		CreatedAt:   time.Now(),
+	}
+	d.goals[goal.ID] = goal
+	return &goal, nil
+}
+
+func (r *MemoryRepository) GetGoal(ctx context.Context, goalID int) (*models.Goal, error) {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	goal, ok := d.goals[goalID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &goal, nil
+}
+
+// GetGoalForUpdate loads a goal. Inside WithTx the whole repository is
+// already locked, so no row lock is needed.
+func (r *MemoryRepository) GetGoalForUpdate(ctx context.Context, goalID int) (*models.Goal, error) {
+	return r.GetGoal(ctx, goalID)
+}
+
+// DeleteGoal removes a goal together with its proofs, votes, voters,
+// reminders and changes; transactions keep their amounts with the goal unset
+func (r *MemoryRepository) DeleteGoal(ctx context.Context, goalID int) error {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	d.deleteGoal(goalID)
+	return nil
+}
+
+func (d *memoryData) deleteGoal(goalID int) {
+	for id, proof := range d.proofs {
+		if proof.GoalID == goalID {
+			delete(d.proofs, id)
+		}
+	}
+	for key := range d.votes {
+		if key.goalID == goalID {
+			delete(d.votes, key)
+		}
+	}
+	for key := range d.goalVoters {
+		if key.goalID == goalID {
+			delete(d.goalVoters, key)
+		}
+	}
+	for key := range d.reminders {
+		if key.goalID == goalID {
+			delete(d.reminders, key)
+		}
+	}
+	for id, change := range d.goalChanges {
+		if change.GoalID == goalID {
+			delete(d.goalChanges, id)
+		}
+	}
+	for id, t := range d.transactions {
+		if t.GoalID != nil && *t.GoalID == goalID {
+			t.GoalID = nil
+			d.transactions[id] = t
+		}
+	}
+
+	delete(d.proofMessages, goalID)
+	delete(d.goals, goalID)
+}
+
+func (r *MemoryRepository) TransitionGoalStatus(ctx context.Context, goalID int, to string, from ...string) (bool, error) {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	goal, ok := d.goals[goalID]
+	if !ok {
+		return false, nil
+	}
+	for _, status := range from {
+		if goal.Status == status {
+			goal.Status = to
+			d.goals[goalID] = goal
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *MemoryRepository) UpdateGoalProof(ctx context.Context, goalID int, proof string) error {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if goal, ok := d.goals[goalID]; ok {
+		goal.Status = "done_pending"
+		d.goals[goalID] = goal
+		d.proofMessages[goalID] = proof
+	}
+	return nil
+}
+
+func (r *MemoryRepository) UpdateGoalText(ctx context.Context, goalID int, title, description string) error {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if goal, ok := d.goals[goalID]; ok {
+		goal.Title = title
+		goal.Description = description
+		d.goals[goalID] = goal
+	}
+	return nil
+}
+
+// UpdateGoalDeadline moves a goal's deadline and forgets the reminders sent
+// for the old one
+func (r *MemoryRepository) UpdateGoalDeadline(ctx context.Context, goalID int, deadline time.Time) error {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if goal, ok := d.goals[goalID]; ok {
+		goal.Deadline = deadline
+		d.goals[goalID] = goal
+	}
+	for key := range d.reminders {
+		if key.goalID == goalID {
+			delete(d.reminders, key)
+		}
+	}
+	return nil
+}
+
+// StartVoting freezes the set of members allowed to vote on a goal and the
+// number of yes votes needed for it to succeed. A nil endsAt leaves voting
+// open until it is decided by votes.
+func (r *MemoryRepository) StartVoting(ctx context.Context, goalID int, startedAt time.Time, endsAt *time.Time, voterIDs []int, requiredVotes int) error {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	goal, ok := d.goals[goalID]
+	if !ok {
+		return nil
+	}
+
+	for _, voterID := range voterIDs {
+		if _, ok := d.users[voterID]; !ok {
+			return fmt.Errorf("user %d does not exist", voterID)
+		}
+		d.goalVoters[voteKey{goalID: goalID, voterID: voterID}] = struct{}{}
+	}
+
+	goal.VotingStartedAt = &startedAt
+	if endsAt != nil {
+		end := *endsAt
+		goal.VotingEndsAt = &end
+	} else {
+		goal.VotingEndsAt = nil
+	}
+	goal.ChatMembersCount = len(voterIDs)
+	goal.RequiredVotes = requiredVotes
+	d.goals[goalID] = goal
+	return nil
+}
+
+func (r *MemoryRepository) IsEligibleVoter(ctx context.Context, goalID, userID int) (bool, error) {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	_, ok := d.goalVoters[voteKey{goalID: goalID, voterID: userID}]
+	return ok, nil
+}
+
+func (r *MemoryRepository) GetGoalVoters(ctx context.Context, goalID int) ([]models.User, error) {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	var users []models.User
+	for key := range d.votes {
+		if key.goalID == goalID {
+			users = append(users, d.users[key.voterID])
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+func (r *MemoryRepository) GetActiveGoalsByChat(ctx context.Context, chatID int64) ([]models.Goal, error) {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return d.filterGoals(
+		func(g models.Goal) bool { return g.ChatID == chatID && isOpenGoal(g) },
+		func(a, b models.Goal) bool { return a.CreatedAt.After(b.CreatedAt) },
+	), nil
+}
+
+func (r *MemoryRepository) GetUserActiveGoals(ctx context.Context, userID int) ([]models.Goal, error) {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return d.filterGoals(
+		func(g models.Goal) bool { return g.UserID == userID && isOpenGoal(g) },
+		func(a, b models.Goal) bool { return a.Deadline.Before(b.Deadline) },
+	), nil
+}
+
+func (r *MemoryRepository) GetExpiredActiveGoals(ctx context.Context, now time.Time) ([]models.Goal, error) {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return d.filterGoals(
+		func(g models.Goal) bool { return g.Status == "active" && g.Deadline.Before(now) },
+		func(a, b models.Goal) bool { return a.Deadline.Before(b.Deadline) },
+	), nil
+}
+
+func (r *MemoryRepository) GetActiveGoalsDueBefore(ctx context.Context, from, to time.Time) ([]models.Goal, error) {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return d.filterGoals(
+		func(g models.Goal) bool {
+			return g.Status == "active" && g.Deadline.After(from) && !g.Deadline.After(to)
+		},
+		func(a, b models.Goal) bool { return a.Deadline.Before(b.Deadline) },
+	), nil
+}
+
+func (r *MemoryRepository) GetGoalsWithExpiredVoting(ctx context.Context, now time.Time) ([]models.Goal, error) {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return d.filterGoals(
+		func(g models.Goal) bool {
+			return g.Status == "done_pending" && g.VotingEndsAt != nil && g.VotingEndsAt.Before(now)
+		},
+		func(a, b models.Goal) bool { return a.VotingEndsAt.Before(*b.VotingEndsAt) },
+	), nil
+}
+
+// Proof methods
+func (r *MemoryRepository) CreateProof(ctx context.Context, proof models.Proof) (*models.Proof, error) {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if _, ok := d.goals[proof.GoalID]; !ok {
+		return nil, fmt.Errorf("goal %d does not exist", proof.GoalID)
+	}
+
+	proof.ID = d.nextID("goal_proofs")
+	proof.CreatedAt = time.Now()
+	d.proofs[proof.ID] = proof
+	return &proof, nil
+}
+
+// Goal change methods
+
+// CreateGoalChange adds an entry to a goal's audit trail. ID and CreatedAt
+// are ignored.
+func (r *MemoryRepository) CreateGoalChange(ctx context.Context, change models.GoalChange) error {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, ok := d.goals[change.GoalID]; !ok {
+		return fmt.Errorf("goal %d does not exist", change.GoalID)
+	}
+	if _, ok := d.users[change.UserID]; !ok {
+		return fmt.Errorf("user %d does not exist", change.UserID)
+	}
+
+	change.ID = d.nextID("goal_changes")
+	change.CreatedAt = time.Now()
+	d.goalChanges[change.ID] = change
+	return nil
+}
+
+// GetGoalChanges returns a goal's audit trail, oldest first
+func (r *MemoryRepository) GetGoalChanges(ctx context.Context, goalID int) ([]models.GoalChange, error) {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	var changes []models.GoalChange
+	for _, change := range d.goalChanges {
+		if change.GoalID == goalID {
+			changes = append(changes, change)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if !changes[i].CreatedAt.Equal(changes[j].CreatedAt) {
+			return changes[i].CreatedAt.Before(changes[j].CreatedAt)
+		}
+		return changes[i].ID < changes[j].ID
+	})
+	return changes, nil
+}
+
+// Reminder methods
+
+// MarkReminderSent records that the reminder for the given offset before the
+// deadline was sent. It reports false if it had already been recorded.
+func (r *MemoryRepository) MarkReminderSent(ctx context.Context, goalID int, offset time.Duration) (bool, error) {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	if _, ok := d.goals[goalID]; !ok {
+		return false, fmt.Errorf("goal %d does not exist", goalID)
+	}
+
+	key := reminderKey{goalID: goalID, offsetMinutes: int(offset / time.Minute)}
+	if _, ok := d.reminders[key]; ok {
+		return false, nil
+	}
+	d.reminders[key] = struct{}{}
+	return true, nil
+}
+
+// Vote methods
+
+// CreateVote records a vote, replacing the voter's earlier vote on the goal
+func (r *MemoryRepository) CreateVote(ctx context.Context, goalID, voterID int, vote bool) error {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, ok := d.goals[goalID]; !ok {
+		return fmt.Errorf("goal %d does not exist", goalID)
+	}
+	if _, ok := d.users[voterID]; !ok {
+		return fmt.Errorf("user %d does not exist", voterID)
+	}
+
+	key := voteKey{goalID: goalID, voterID: voterID}
+	existing, ok := d.votes[key]
+	if ok {
+		existing.Vote = vote
+		d.votes[key] = existing
+		return nil
+	}
+
+	d.votes[key] = models.Vote{
+		ID:        d.nextID("votes"),
+		GoalID:    goalID,
+		VoterID:   voterID,
+		Vote:      vote,
+		CreatedAt: time.Now(),
+	}
+	return nil
+}
+
+func (r *MemoryRepository) GetVotesByGoal(ctx context.Context, goalID int) ([]models.Vote, error) {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	var votes []models.Vote
+	for key, vote := range d.votes {
+		if key.goalID == goalID {
+			votes = append(votes, vote)
+		}
+	}
+	sort.Slice(votes, func(i, j int) bool { return votes[i].ID < votes[j].ID })
+	return votes, nil
+}
+
+func (r *MemoryRepository) CountVotes(ctx context.Context, goalID int) (yesCount int, noCount int, err error) {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer unlock()
+
+	for key, vote := range d.votes {
+		if key.goalID != goalID {
+			continue
+		}
+		if vote.Vote {
+			yesCount++
+		} else {
+			noCount++
+		}
+	}
+	return yesCount, noCount, nil
+}
+
+// ChatMember methods
+func (r *MemoryRepository) AddChatMember(ctx context.Context, chatID int64, userID int) error {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, ok := d.users[userID]; !ok {
+		return fmt.Errorf("user %d does not exist", userID)
+	}
+
+	key := memberKey{chatID: chatID, userID: userID}
+	if _, ok := d.chatMembers[key]; !ok {
+		d.chatMembers[key] = time.Now()
+	}
+	return nil
+}
+
+func (r *MemoryRepository) GetChatMembers(ctx context.Context, chatID int64) ([]models.User, error) {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return d.chatMembersOf(chatID), nil
+}
+
+func (d *memoryData) chatMembersOf(chatID int64) []models.User {
+	var users []models.User
+	for key := range d.chatMembers {
+		if key.chatID == chatID {
+			users = append(users, d.users[key.userID])
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users
+}
+
+func (r *MemoryRepository) CountChatVotes(ctx context.Context, chatID int64) (map[int]int, error) {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	counts := make(map[int]int)
+	for _, vote := range d.votes {
+		if goal, ok := d.goals[vote.GoalID]; ok && goal.ChatID == chatID {
+			counts[vote.VoterID]++
+		}
+	}
+	return counts, nil
+}
+
+func (r *MemoryRepository) CountSucceededGoals(ctx context.Context, chatID int64, since time.Time) (map[int]int, error) {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	counts := make(map[int]int)
+	for _, t := range d.transactions {
+		if t.Reason != "escrow_release" || t.GoalID == nil || t.CreatedAt.Before(since) {
+			continue
+		}
+		if goal, ok := d.goals[*t.GoalID]; ok && goal.ChatID == chatID {
+			counts[goal.UserID]++
+		}
+	}
+	return counts, nil
+}
+
+// GetChatLeaderboard ranks members of a chat by the given metric
+func (r *MemoryRepository) GetChatLeaderboard(ctx context.Context, chatID int64, metric string, limit int) ([]models.LeaderboardEntry, error) {
+	var less func(a, b models.LeaderboardEntry) bool
+	switch metric {
+	case models.LeaderboardBalance:
+		less = func(a, b models.LeaderboardEntry) bool {
+			return a.User.Balance+a.User.LockedBalance > b.User.Balance+b.User.LockedBalance
+		}
+	case models.LeaderboardSuccess:
+		less = func(a, b models.LeaderboardEntry) bool {
+			if a.Succeeded != b.Succeeded {
+				return a.Succeeded > b.Succeeded
+			}
+			return a.SuccessRate > b.SuccessRate
+		}
+	case models.LeaderboardRate:
+		less = func(a, b models.LeaderboardEntry) bool {
+			if a.SuccessRate != b.SuccessRate {
+				return a.SuccessRate > b.SuccessRate
+			}
+			return a.Resolved > b.Resolved
+		}
+	case models.LeaderboardWon:
+		less = func(a, b models.LeaderboardEntry) bool { return a.StarsWon > b.StarsWon }
+	default:
+		return nil, fmt.Errorf("unknown leaderboard metric %q", metric)
+	}
+
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	var entries []models.LeaderboardEntry
+	for _, user := range d.chatMembersOf(chatID) {
+		entry := models.LeaderboardEntry{User: user}
+		for _, goal := range d.goals {
+			if goal.ChatID != chatID || goal.UserID != user.ID {
+				continue
+			}
+			switch goal.Status {
+			case "success":
+				entry.Succeeded++
+				entry.Resolved++
+			case "failed":
+				entry.Resolved++
+			}
+		}
+		if entry.Resolved > 0 {
+			entry.SuccessRate = float64(entry.Succeeded) / float64(entry.Resolved)
+		}
+		for _, t := range d.transactions {
+			if !strings.HasPrefix(t.Reason, "penalty_") || t.ToUser == nil || *t.ToUser != user.ID || t.GoalID == nil {
+				continue
+			}
+			if goal, ok := d.goals[*t.GoalID]; ok && goal.ChatID == chatID {
+				entry.StarsWon += t.Amount
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if less(entries[i], entries[j]) {
+			return true
+		}
+		if less(entries[j], entries[i]) {
+			return false
+		}
+		return entries[i].User.ID < entries[j].User.ID
+	})
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+// Conversation state methods
+
+// GetConversationState returns the saved dialog state for a user in a chat,
+// or nil if there is none or it has expired
+func (r *MemoryRepository) GetConversationState(ctx context.Context, chatID, userID int64, now time.Time) (*models.ConversationState, error) {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	saved, ok := d.conversations[conversationKey{chatID: chatID, userID: userID}]
+	if !ok || !saved.expiresAt.After(now) {
+		return nil, nil
+	}
+
+	var state models.ConversationState
+	if err := json.Unmarshal(saved.state, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (r *MemoryRepository) SaveConversationState(ctx context.Context, chatID, userID int64, state *models.ConversationState, expiresAt time.Time) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	d.conversations[conversationKey{chatID: chatID, userID: userID}] = memoryConversation{state: data, expiresAt: expiresAt}
+	return nil
+}
+
+func (r *MemoryRepository) DeleteConversationState(ctx context.Context, chatID, userID int64) error {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	delete(d.conversations, conversationKey{chatID: chatID, userID: userID})
+	return nil
+}
+
+func (r *MemoryRepository) DeleteExpiredConversationStates(ctx context.Context, now time.Time) error {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for key, saved := range d.conversations {
+		if !saved.expiresAt.After(now) {
+			delete(d.conversations, key)
+		}
+	}
+	return nil
+}
+
+// Chat settings methods
+
+func (r *MemoryRepository) GetChatSettings(ctx context.Context, chatID int64) (*models.ChatSettings, error) {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	settings, ok := d.chatSettings[chatID]
+	if !ok {
+		return nil, nil
+	}
+	settings.ReminderOffsets = append([]time.Duration{}, settings.ReminderOffsets...)
+	return &settings, nil
+}
+
+func (r *MemoryRepository) SaveChatSettings(ctx context.Context, settings models.ChatSettings) error {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	settings.ReminderOffsets = append([]time.Duration{}, settings.ReminderOffsets...)
+	settings.UpdatedAt = time.Now()
+	d.chatSettings[settings.ChatID] = settings
+	return nil
+}
+
+// Treasury methods
+
+func (r *MemoryRepository) GetTreasury(ctx context.Context, chatID int64) (*models.Treasury, error) {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	treasury, ok := d.treasuries[chatID]
+	if !ok {
+		return nil, nil
+	}
+	treasury.SeasonStartedAt = copyPtr(treasury.SeasonStartedAt)
+	return &treasury, nil
+}
+
+func (r *MemoryRepository) GetTreasuryForUpdate(ctx context.Context, chatID int64) (*models.Treasury, error) {
+	return r.GetTreasury(ctx, chatID)
+}
+
+func (r *MemoryRepository) AddTreasuryBalance(ctx context.Context, chatID int64, amount int) error {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	treasury, ok := d.treasuries[chatID]
+	if !ok {
+		treasury = models.Treasury{ChatID: chatID, CreatedAt: time.Now()}
+	}
+	if treasury.Balance+amount < 0 {
+		return fmt.Errorf("treasury of chat %d would go negative", chatID)
+	}
+	treasury.Balance += amount
+	d.treasuries[chatID] = treasury
+	return nil
+}
+
+func (r *MemoryRepository) StartTreasurySeason(ctx context.Context, chatID int64, startedAt time.Time) error {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if treasury, ok := d.treasuries[chatID]; ok {
+		treasury.SeasonStartedAt = &startedAt
+		d.treasuries[chatID] = treasury
+	}
+	return nil
+}
+
+// GetTreasuryTransactions returns a page of the transactions in and out of a
+// chat's treasury, newest first. Incoming entries added stars to the treasury.
+func (r *MemoryRepository) GetTreasuryTransactions(ctx context.Context, chatID int64, limit, offset int) ([]models.HistoryEntry, error) {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	var entries []models.HistoryEntry
+	for _, t := range d.treasuryTransactions(chatID) {
+		entry := models.HistoryEntry{Transaction: t, Incoming: t.ToUser == nil}
+
+		counterparty := t.ToUser
+		if entry.Incoming {
+			counterparty = t.FromUser
+		}
+		if counterparty != nil {
+			entry.Counterparty = d.users[*counterparty].Username
+		}
+		if t.GoalID != nil {
+			entry.GoalTitle = d.goals[*t.GoalID].Title
+		}
+		entries = append(entries, entry)
+	}
+	return pageHistory(entries, limit, offset), nil
+}
+
+func (r *MemoryRepository) CountTreasuryTransactions(ctx context.Context, chatID int64) (int, error) {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	return len(d.treasuryTransactions(chatID)), nil
+}
+
+func (d *memoryData) treasuryTransactions(chatID int64) []models.Transaction {
+	var transactions []models.Transaction
+	for _, t := range d.transactions {
+		if t.TreasuryChatID != nil && *t.TreasuryChatID == chatID {
+			transactions = append(transactions, t)
+		}
+	}
+	return transactions
+}
+
+// Transaction methods
+// CreateTransaction records a star movement. A nil FromUser or ToUser means
+// the stars came from or went to escrow rather than another user, or the
+// treasury of TreasuryChatID if it is set. ID and CreatedAt are ignored.
+func (r *MemoryRepository) CreateTransaction(ctx context.Context, t models.Transaction) error {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	t.ID = d.nextID("transactions")
+	t.FromUser = copyPtr(t.FromUser)
+	t.ToUser = copyPtr(t.ToUser)
+	t.GoalID = copyPtr(t.GoalID)
+	t.TreasuryChatID = copyPtr(t.TreasuryChatID)
+	t.CreatedAt = time.Now()
+	d.transactions[t.ID] = t
+	return nil
+}
+
+// GetUserTransactions returns a page of transactions where the user is the
+// sender or the recipient, newest first
+func (r *MemoryRepository) GetUserTransactions(ctx context.Context, userID, limit, offset int) ([]models.HistoryEntry, error) {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	var entries []models.HistoryEntry
+	for _, t := range d.userTransactions(userID) {
+		entry := models.HistoryEntry{
+			Transaction: t,
+			Incoming:    t.ToUser != nil && *t.ToUser == userID,
+		}
+
+		counterparty := t.ToUser
+		if entry.Incoming {
+			counterparty = t.FromUser
+		}
+		if counterparty != nil {
+			entry.Counterparty = d.users[*counterparty].Username
+		}
+		if t.GoalID != nil {
+			entry.GoalTitle = d.goals[*t.GoalID].Title
+		}
+		entries = append(entries, entry)
+	}
+	return pageHistory(entries, limit, offset), nil
+}
+
+// pageHistory sorts entries newest first and cuts a page out of them
+func pageHistory(entries []models.HistoryEntry, limit, offset int) []models.HistoryEntry {
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].CreatedAt.Equal(entries[j].CreatedAt) {
+			return entries[i].CreatedAt.After(entries[j].CreatedAt)
+		}
+		return entries[i].ID > entries[j].ID
+	})
+
+	if offset >= len(entries) {
+		return nil
+	}
+	entries = entries[offset:]
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries
+}
+
+func (r *MemoryRepository) CountUserTransactions(ctx context.Context, userID int) (int, error) {
+	d, unlock, err := r.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	return len(d.userTransactions(userID)), nil
+}
+
+func (d *memoryData) userTransactions(userID int) []models.Transaction {
+	var transactions []models.Transaction
+	for _, t := range d.transactions {
+		if (t.FromUser != nil && *t.FromUser == userID) || (t.ToUser != nil && *t.ToUser == userID) {
+			transactions = append(transactions, t)
+		}
+	}
+	return transactions
+}
+
+func copyPtr[T any](v *T) *T {
+	if v == nil {
+		return nil
+	}
+	c := *v
+	return &c
+}
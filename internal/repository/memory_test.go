@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"awesomeProject/internal/models"
+	"context"
+	"testing"
+	"time"
+)
+
+const testChatID int64 = -1001
+
+// votedGoal stores a goal of a new author with proof, a reminder, a change,
+// an escrow transaction and a vote by a new voter
+func votedGoal(t *testing.T, r *MemoryRepository) (author, voter *models.User, goal *models.Goal) {
+	t.Helper()
+
+	ctx := context.Background()
+	author, err := r.GetOrCreateUser(ctx, 1, "author")
+	if err != nil {
+		t.Fatal(err)
+	}
+	voter, err = r.GetOrCreateUser(ctx, 2, "voter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range []*models.User{author, voter} {
+		if err := r.AddChatMember(ctx, testChatID, user.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if goal, err = r.CreateGoal(ctx, author.ID, testChatID, "Run", "10 km", time.Now().Add(time.Hour), 10); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.CreateProof(ctx, models.Proof{GoalID: goal.ID, Kind: models.ProofText, Caption: "Done"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.StartVoting(ctx, goal.ID, time.Now(), nil, []int{voter.ID}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CreateVote(ctx, goal.ID, voter.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.MarkReminderSent(ctx, goal.ID, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CreateGoalChange(ctx, models.GoalChange{GoalID: goal.ID, UserID: author.ID, Kind: models.GoalChangeTitle, NewValue: "Run"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CreateTransaction(ctx, models.Transaction{FromUser: &author.ID, Amount: 10, Reason: "escrow_lock", GoalID: &goal.ID}); err != nil {
+		t.Fatal(err)
+	}
+	return author, voter, goal
+}
+
+func TestMemoryDeleteGoalCascades(t *testing.T) {
+	r := NewMemoryRepository(Config{StartingBalance: 100})
+	author, _, goal := votedGoal(t, r)
+
+	if err := r.DeleteGoal(context.Background(), goal.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	d := *r.data
+	if len(d.goals) != 0 || len(d.proofs) != 0 || len(d.votes) != 0 || len(d.goalVoters) != 0 ||
+		len(d.reminders) != 0 || len(d.goalChanges) != 0 || len(d.proofMessages) != 0 {
+		t.Errorf("expected everything attached to the goal to be deleted, got %d goals, %d proofs, %d votes, %d voters, %d reminders, %d changes",
+			len(d.goals), len(d.proofs), len(d.votes), len(d.goalVoters), len(d.reminders), len(d.goalChanges))
+	}
+
+	// The ledger keeps the amount but loses the link, like ON DELETE SET NULL
+	history, err := r.GetUserTransactions(context.Background(), author.ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].GoalID != nil || history[0].Amount != 10 {
+		t.Errorf("expected one unlinked transaction of 10 stars, got %+v", history)
+	}
+}
+
+func TestMemoryDeleteUserCascades(t *testing.T) {
+	r := NewMemoryRepository(Config{StartingBalance: 100})
+	author, voter, _ := votedGoal(t, r)
+
+	// Deleting the voter removes their vote but keeps the author's goal
+	if err := r.DeleteUser(context.Background(), voter.ID); err != nil {
+		t.Fatal(err)
+	}
+	d := *r.data
+	if len(d.votes) != 0 || len(d.goalVoters) != 0 || len(d.goals) != 1 {
+		t.Errorf("expected the voter's vote to be deleted and the goal kept, got %d votes, %d voters, %d goals",
+			len(d.votes), len(d.goalVoters), len(d.goals))
+	}
+
+	// Deleting the author removes their goal with everything attached to it
+	if err := r.DeleteUser(context.Background(), author.ID); err != nil {
+		t.Fatal(err)
+	}
+	d = *r.data
+	if len(d.users) != 0 || len(d.goals) != 0 || len(d.proofs) != 0 || len(d.chatMembers) != 0 || len(d.goalChanges) != 0 {
+		t.Errorf("expected the author's data to be deleted, got %d users, %d goals, %d proofs, %d members, %d changes",
+			len(d.users), len(d.goals), len(d.proofs), len(d.chatMembers), len(d.goalChanges))
+	}
+	for _, tx := range d.transactions {
+		if tx.FromUser != nil || tx.GoalID != nil {
+			t.Errorf("expected transactions to lose their links to deleted rows, got %+v", tx)
+		}
+	}
+}
@@ -1,33 +1,120 @@
 package repository
 
 import (
+	"awesomeProject/internal/metrics"
 	"awesomeProject/internal/models"
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
 	"time"
 )
 
+// querier is the subset of *sql.DB and *sql.Tx used by Repository, so the
+// same methods work both standalone and inside WithTx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Config holds the settings shared by the Store implementations
+type Config struct {
+	QueryTimeout    time.Duration // Limit for a single method call, 0 means none
+	StartingBalance int           // Stars a newly created user starts with
+	ChangeFee       int           // Change fee of chats whose settings predate it
+	ChangeWindow    int           // Change window of chats whose settings predate it
+}
+
 type Repository struct {
-	db *sql.DB
+	db     querier
+	conn   *sql.DB // nil when the repository is bound to a transaction
+	config Config
+}
+
+// NewRepository returns a Repository whose methods each give up after
+// config.QueryTimeout, so a stuck connection cannot block the caller forever
+func NewRepository(db *sql.DB, config Config) *Repository {
+	return &Repository{db: db, conn: db, config: config}
+}
+
+// call starts a repository call named method. The returned context is
+// bounded by the query timeout; done cancels it and records the call's
+// duration. Inside WithTx the limit applies to each call, not to the whole
+// transaction.
+func (r *Repository) call(ctx context.Context, method string) (context.Context, func()) {
+	start := time.Now()
+
+	cancel := context.CancelFunc(func() {})
+	if r.config.QueryTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, r.config.QueryTimeout)
+	}
+
+	return ctx, func() {
+		cancel()
+		metrics.QueryDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	}
 }
 
-func NewRepository(db *sql.DB) *Repository {
-	return &Repository{db: db}
+// IsTimeout reports whether err means the database did not answer in time.
+// Depending on when the deadline hits, database/sql returns the context
+// error or PostgreSQL reports the statement as cancelled.
+func IsTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "57014" // query_canceled
+}
+
+// WithTx runs fn inside a database transaction. The repository passed to fn
+// is bound to that transaction; it is committed if fn returns nil and rolled
+// back otherwise. Nested calls reuse the outer transaction. Cancelling ctx
+// rolls the transaction back.
+func (r *Repository) WithTx(ctx context.Context, fn func(tx Store) error) (err error) {
+	if r.conn == nil {
+		return fn(r)
+	}
+
+	tx, err := r.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			_ = tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	return fn(&Repository{db: tx, config: r.config})
 }
 
 // User methods
-func (r *Repository) GetOrCreateUser(tgID int64, username string) (*models.User, error) {
+func (r *Repository) GetOrCreateUser(ctx context.Context, tgID int64, username string) (*models.User, error) {
+	ctx, done := r.call(ctx, "GetOrCreateUser")
+	defer done()
+
 	var user models.User
-	err := r.db.QueryRow(`
-		SELECT id, tg_id, username, balance, created_at 
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, tg_id, username, balance, locked_balance, created_at 
 		FROM users WHERE tg_id = $1
-	`, tgID).Scan(&user.ID, &user.TgID, &user.Username, &user.Balance, &user.CreatedAt)
+	`, tgID).Scan(&user.ID, &user.TgID, &user.Username, &user.Balance, &user.LockedBalance, &user.CreatedAt)
 
 	if err == sql.ErrNoRows {
-		err = r.db.QueryRow(`
+		err = r.db.QueryRowContext(ctx, `
 			INSERT INTO users (tg_id, username, balance) 
-			VALUES ($1, $2, 100) 
-			RETURNING id, tg_id, username, balance, created_at
-		`, tgID, username).Scan(&user.ID, &user.TgID, &user.Username, &user.Balance, &user.CreatedAt)
+			VALUES ($1, $2, $3) 
+			RETURNING id, tg_id, username, balance, locked_balance, created_at
+		`, tgID, username, r.config.StartingBalance).Scan(&user.ID, &user.TgID, &user.Username, &user.Balance, &user.LockedBalance, &user.CreatedAt)
 	}
 
 	if err != nil {
@@ -36,106 +123,408 @@ func (r *Repository) GetOrCreateUser(tgID int64, username string) (*models.User,
 	return &user, nil
 }
 
-func (r *Repository) UpdateUserBalance(userID int, amount int) error {
-	_, err := r.db.Exec(`UPDATE users SET balance = balance + $1 WHERE id = $2`, amount, userID)
+// DeleteUser removes a user; their goals, votes, goal changes and chat
+// memberships are removed by the schema's cascading foreign keys
+func (r *Repository) DeleteUser(ctx context.Context, userID int) error {
+	ctx, done := r.call(ctx, "DeleteUser")
+	defer done()
+
+	_, err := r.db.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, userID)
+	return err
+}
+
+func (r *Repository) UpdateUserBalance(ctx context.Context, userID int, amount int) error {
+	ctx, done := r.call(ctx, "UpdateUserBalance")
+	defer done()
+
+	_, err := r.db.ExecContext(ctx, `UPDATE users SET balance = balance + $1 WHERE id = $2`, amount, userID)
 	return err
 }
 
-func (r *Repository) GetUserBalance(userID int) (int, error) {
+func (r *Repository) GetUserBalance(ctx context.Context, userID int) (int, error) {
+	ctx, done := r.call(ctx, "GetUserBalance")
+	defer done()
+
 	var balance int
-	err := r.db.QueryRow(`SELECT balance FROM users WHERE id = $1`, userID).Scan(&balance)
+	err := r.db.QueryRowContext(ctx, `SELECT balance FROM users WHERE id = $1`, userID).Scan(&balance)
 	return balance, err
 }
 
+// LockStars moves amount from the available balance into escrow. It reports
+// false without changing anything if the available balance is too small.
+func (r *Repository) LockStars(ctx context.Context, userID int, amount int) (bool, error) {
+	ctx, done := r.call(ctx, "LockStars")
+	defer done()
+
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE users SET balance = balance - $1, locked_balance = locked_balance + $1
+		WHERE id = $2 AND balance >= $1
+	`, amount, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// ReleaseStars returns amount from escrow back to the available balance
+func (r *Repository) ReleaseStars(ctx context.Context, userID int, amount int) error {
+	ctx, done := r.call(ctx, "ReleaseStars")
+	defer done()
+
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE users SET balance = balance + $1, locked_balance = locked_balance - $1
+		WHERE id = $2
+	`, amount, userID)
+	return err
+}
+
+// SpendLockedStars removes amount from escrow without returning it to the user
+func (r *Repository) SpendLockedStars(ctx context.Context, userID int, amount int) error {
+	ctx, done := r.call(ctx, "SpendLockedStars")
+	defer done()
+
+	_, err := r.db.ExecContext(ctx, `UPDATE users SET locked_balance = locked_balance - $1 WHERE id = $2`, amount, userID)
+	return err
+}
+
 // Goal methods
-func (r *Repository) CreateGoal(userID int, chatID int64, title, description string, deadline time.Time, bet int) (*models.Goal, error) {
+
+// goalColumns lists the goals columns in the order scanGoal expects them
+const goalColumns = `id, user_id, chat_id, title, description, deadline, bet, status, created_at,
+	voting_started_at, voting_ends_at, chat_members_count, required_votes`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanGoal(row rowScanner) (*models.Goal, error) {
 	var goal models.Goal
-	err := r.db.QueryRow(`
-		INSERT INTO goals (user_id, chat_id, title, description, deadline, bet, status) 
-		VALUES ($1, $2, $3, $4, $5, $6, 'active') 
-		RETURNING id, user_id, title, description, deadline, bet, status, created_at
-	`, userID, chatID, title, description, deadline, bet).Scan(
-		&goal.ID, &goal.UserID, &goal.Title, &goal.Description,
+	err := row.Scan(&goal.ID, &goal.UserID, &goal.ChatID, &goal.Title, &goal.Description,
 		&goal.Deadline, &goal.Bet, &goal.Status, &goal.CreatedAt,
-	)
+		&goal.VotingStartedAt, &goal.VotingEndsAt, &goal.ChatMembersCount, &goal.RequiredVotes)
 	if err != nil {
 		return nil, err
 	}
 	return &goal, nil
 }
 
-func (r *Repository) GetGoal(goalID int) (*models.Goal, error) {
-	var goal models.Goal
-	err := r.db.QueryRow(`
-		SELECT id, user_id, title, description, deadline, bet, status, created_at 
-		FROM goals WHERE id = $1
-	`, goalID).Scan(&goal.ID, &goal.UserID, &goal.Title, &goal.Description,
-		&goal.Deadline, &goal.Bet, &goal.Status, &goal.CreatedAt)
+func (r *Repository) queryGoals(ctx context.Context, query string, args ...any) ([]models.Goal, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
-	return &goal, nil
+	defer rows.Close()
+
+	var goals []models.Goal
+	for rows.Next() {
+		goal, err := scanGoal(rows)
+		if err != nil {
+			return nil, err
+		}
+		goals = append(goals, *goal)
+	}
+	return goals, rows.Err()
+}
+
+func (r *Repository) CreateGoal(ctx context.Context, userID int, chatID int64, title, description string, deadline time.Time, bet int) (*models.Goal, error) {
+	ctx, done := r.call(ctx, "CreateGoal")
+	defer done()
+
+	return scanGoal(r.db.QueryRowContext(ctx, `
+		INSERT INTO goals (user_id, chat_id, title, description, deadline, bet, status) 
+		VALUES ($1, $2, $3, $4, $5, $6, 'active') 
+		RETURNING `+goalColumns,
+		userID, chatID, title, description, deadline, bet))
+}
+
+func (r *Repository) GetGoal(ctx context.Context, goalID int) (*models.Goal, error) {
+	ctx, done := r.call(ctx, "GetGoal")
+	defer done()
+
+	return scanGoal(r.db.QueryRowContext(ctx, `SELECT `+goalColumns+` FROM goals WHERE id = $1`, goalID))
+}
+
+// GetGoalForUpdate loads a goal and locks its row until the surrounding
+// transaction ends. It must be called inside WithTx.
+func (r *Repository) GetGoalForUpdate(ctx context.Context, goalID int) (*models.Goal, error) {
+	ctx, done := r.call(ctx, "GetGoalForUpdate")
+	defer done()
+
+	return scanGoal(r.db.QueryRowContext(ctx, `SELECT `+goalColumns+` FROM goals WHERE id = $1 FOR UPDATE`, goalID))
+}
+
+// DeleteGoal removes a goal; its proofs, votes, voters, reminders and
+// changes are removed by the schema's cascading foreign keys
+func (r *Repository) DeleteGoal(ctx context.Context, goalID int) error {
+	ctx, done := r.call(ctx, "DeleteGoal")
+	defer done()
+
+	_, err := r.db.ExecContext(ctx, `DELETE FROM goals WHERE id = $1`, goalID)
+	return err
+}
+
+// TransitionGoalStatus moves a goal to status "to" only if it is currently in
+// one of the "from" statuses. It reports whether the row was updated, which
+// lets callers claim a goal exactly once.
+func (r *Repository) TransitionGoalStatus(ctx context.Context, goalID int, to string, from ...string) (bool, error) {
+	ctx, done := r.call(ctx, "TransitionGoalStatus")
+	defer done()
+
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE goals SET status = $1
+		WHERE id = $2 AND status = ANY($3)
+	`, to, goalID, pq.Array(from))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
 }
 
-func (r *Repository) UpdateGoalStatus(goalID int, status string) error {
-	_, err := r.db.Exec(`UPDATE goals SET status = $1 WHERE id = $2`, status, goalID)
+func (r *Repository) UpdateGoalProof(ctx context.Context, goalID int, proof string) error {
+	ctx, done := r.call(ctx, "UpdateGoalProof")
+	defer done()
+
+	_, err := r.db.ExecContext(ctx, `UPDATE goals SET proof_message = $1, status = 'done_pending' WHERE id = $2`, proof, goalID)
 	return err
 }
 
-func (r *Repository) UpdateGoalProof(goalID int, proof string) error {
-	_, err := r.db.Exec(`UPDATE goals SET proof_message = $1, status = 'done_pending' WHERE id = $2`, proof, goalID)
+func (r *Repository) UpdateGoalText(ctx context.Context, goalID int, title, description string) error {
+	ctx, done := r.call(ctx, "UpdateGoalText")
+	defer done()
+
+	_, err := r.db.ExecContext(ctx, `UPDATE goals SET title = $1, description = $2 WHERE id = $3`, title, description, goalID)
 	return err
 }
 
-func (r *Repository) GetActiveGoalsByChat(chatID int64) ([]models.Goal, error) {
-	rows, err := r.db.Query(`
-		SELECT id, user_id, title, description, deadline, bet, status, created_at 
-		FROM goals WHERE chat_id = $1 AND status IN ('active', 'done_pending')
-		ORDER BY created_at DESC
-	`, chatID)
+// UpdateGoalDeadline moves a goal's deadline and forgets the reminders sent
+// for the old one
+func (r *Repository) UpdateGoalDeadline(ctx context.Context, goalID int, deadline time.Time) error {
+	ctx, done := r.call(ctx, "UpdateGoalDeadline")
+	defer done()
+
+	_, err := r.db.ExecContext(ctx, `
+		WITH forgotten AS (DELETE FROM goal_reminders WHERE goal_id = $2)
+		UPDATE goals SET deadline = $1 WHERE id = $2
+	`, deadline, goalID)
+	return err
+}
+
+// StartVoting freezes the set of members allowed to vote on a goal and the
+// number of yes votes needed for it to succeed. A nil endsAt leaves voting
+// open until it is decided by votes.
+func (r *Repository) StartVoting(ctx context.Context, goalID int, startedAt time.Time, endsAt *time.Time, voterIDs []int, requiredVotes int) error {
+	ctx, done := r.call(ctx, "StartVoting")
+	defer done()
+
+	for _, voterID := range voterIDs {
+		_, err := r.db.ExecContext(ctx, `
+			INSERT INTO goal_voters (goal_id, user_id)
+			VALUES ($1, $2)
+			ON CONFLICT (goal_id, user_id) DO NOTHING
+		`, goalID, voterID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE goals SET voting_started_at = $1, voting_ends_at = $2, chat_members_count = $3, required_votes = $4
+		WHERE id = $5
+	`, startedAt, endsAt, len(voterIDs), requiredVotes, goalID)
+	return err
+}
+
+func (r *Repository) IsEligibleVoter(ctx context.Context, goalID, userID int) (bool, error) {
+	ctx, done := r.call(ctx, "IsEligibleVoter")
+	defer done()
+
+	var eligible bool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM goal_voters WHERE goal_id = $1 AND user_id = $2)
+	`, goalID, userID).Scan(&eligible)
+	return eligible, err
+}
+
+// GetGoalVoters returns the members who cast a vote on the goal, unlike
+// eligible voters who may not have voted
+func (r *Repository) GetGoalVoters(ctx context.Context, goalID int) ([]models.User, error) {
+	ctx, done := r.call(ctx, "GetGoalVoters")
+	defer done()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT u.id, u.tg_id, u.username, u.balance, u.locked_balance, u.created_at
+		FROM users u
+		INNER JOIN votes v ON u.id = v.voter_id
+		WHERE v.goal_id = $1
+		ORDER BY u.id
+	`, goalID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var goals []models.Goal
+	var users []models.User
 	for rows.Next() {
-		var goal models.Goal
-		if err := rows.Scan(&goal.ID, &goal.UserID, &goal.Title, &goal.Description,
-			&goal.Deadline, &goal.Bet, &goal.Status, &goal.CreatedAt); err != nil {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.TgID, &user.Username, &user.Balance, &user.LockedBalance, &user.CreatedAt); err != nil {
 			return nil, err
 		}
-		goals = append(goals, goal)
+		users = append(users, user)
 	}
-	return goals, nil
+	return users, rows.Err()
 }
 
-func (r *Repository) GetUserActiveGoals(userID int) ([]models.Goal, error) {
-	rows, err := r.db.Query(`
-		SELECT id, user_id, title, description, deadline, bet, status, created_at 
+// Proof methods
+func (r *Repository) CreateProof(ctx context.Context, proof models.Proof) (*models.Proof, error) {
+	ctx, done := r.call(ctx, "CreateProof")
+	defer done()
+
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO goal_proofs (goal_id, kind, file_id, caption)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`, proof.GoalID, proof.Kind, proof.FileID, proof.Caption).Scan(&proof.ID, &proof.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &proof, nil
+}
+
+func (r *Repository) GetActiveGoalsByChat(ctx context.Context, chatID int64) ([]models.Goal, error) {
+	ctx, done := r.call(ctx, "GetActiveGoalsByChat")
+	defer done()
+
+	return r.queryGoals(ctx, `
+		SELECT `+goalColumns+`
+		FROM goals WHERE chat_id = $1 AND status IN ('active', 'done_pending')
+		ORDER BY created_at DESC
+	`, chatID)
+}
+
+func (r *Repository) GetUserActiveGoals(ctx context.Context, userID int) ([]models.Goal, error) {
+	ctx, done := r.call(ctx, "GetUserActiveGoals")
+	defer done()
+
+	return r.queryGoals(ctx, `
+		SELECT `+goalColumns+`
 		FROM goals WHERE user_id = $1 AND status IN ('active', 'done_pending')
 		ORDER BY deadline ASC
 	`, userID)
+}
+
+func (r *Repository) GetExpiredActiveGoals(ctx context.Context, now time.Time) ([]models.Goal, error) {
+	ctx, done := r.call(ctx, "GetExpiredActiveGoals")
+	defer done()
+
+	return r.queryGoals(ctx, `
+		SELECT `+goalColumns+`
+		FROM goals WHERE status = 'active' AND deadline < $1
+		ORDER BY deadline ASC
+	`, now)
+}
+
+func (r *Repository) GetActiveGoalsDueBefore(ctx context.Context, from, to time.Time) ([]models.Goal, error) {
+	ctx, done := r.call(ctx, "GetActiveGoalsDueBefore")
+	defer done()
+
+	return r.queryGoals(ctx, `
+		SELECT `+goalColumns+`
+		FROM goals WHERE status = 'active' AND deadline > $1 AND deadline <= $2
+		ORDER BY deadline ASC
+	`, from, to)
+}
+
+func (r *Repository) GetGoalsWithExpiredVoting(ctx context.Context, now time.Time) ([]models.Goal, error) {
+	ctx, done := r.call(ctx, "GetGoalsWithExpiredVoting")
+	defer done()
+
+	return r.queryGoals(ctx, `
+		SELECT `+goalColumns+`
+		FROM goals WHERE status = 'done_pending' AND voting_ends_at < $1
+		ORDER BY voting_ends_at ASC
+	`, now)
+}
+
+// Goal change methods
+
+// CreateGoalChange adds an entry to a goal's audit trail. ID and CreatedAt
+// are ignored.
+func (r *Repository) CreateGoalChange(ctx context.Context, change models.GoalChange) error {
+	ctx, done := r.call(ctx, "CreateGoalChange")
+	defer done()
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO goal_changes (goal_id, user_id, kind, old_value, new_value, fee)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, change.GoalID, change.UserID, change.Kind, change.OldValue, change.NewValue, change.Fee)
+	return err
+}
+
+// GetGoalChanges returns a goal's audit trail, oldest first
+func (r *Repository) GetGoalChanges(ctx context.Context, goalID int) ([]models.GoalChange, error) {
+	ctx, done := r.call(ctx, "GetGoalChanges")
+	defer done()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, goal_id, user_id, kind, old_value, new_value, fee, created_at
+		FROM goal_changes WHERE goal_id = $1
+		ORDER BY created_at, id
+	`, goalID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var goals []models.Goal
+	var changes []models.GoalChange
 	for rows.Next() {
-		var goal models.Goal
-		if err := rows.Scan(&goal.ID, &goal.UserID, &goal.Title, &goal.Description,
-			&goal.Deadline, &goal.Bet, &goal.Status, &goal.CreatedAt); err != nil {
+		var change models.GoalChange
+		if err := rows.Scan(&change.ID, &change.GoalID, &change.UserID, &change.Kind,
+			&change.OldValue, &change.NewValue, &change.Fee, &change.CreatedAt); err != nil {
 			return nil, err
 		}
-		goals = append(goals, goal)
+		changes = append(changes, change)
 	}
-	return goals, nil
+	return changes, rows.Err()
+}
+
+// Reminder methods
+
+// MarkReminderSent records that the reminder for the given offset before the
+// deadline was sent. It reports false if it had already been recorded.
+func (r *Repository) MarkReminderSent(ctx context.Context, goalID int, offset time.Duration) (bool, error) {
+	ctx, done := r.call(ctx, "MarkReminderSent")
+	defer done()
+
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO goal_reminders (goal_id, offset_minutes)
+		VALUES ($1, $2)
+		ON CONFLICT (goal_id, offset_minutes) DO NOTHING
+	`, goalID, int(offset/time.Minute))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
 }
 
 // Vote methods
-func (r *Repository) CreateVote(goalID, voterID int, vote bool) error {
-	_, err := r.db.Exec(`
+func (r *Repository) CreateVote(ctx context.Context, goalID, voterID int, vote bool) error {
+	ctx, done := r.call(ctx, "CreateVote")
+	defer done()
+
+	_, err := r.db.ExecContext(ctx, `
 		INSERT INTO votes (goal_id, voter_id, vote) 
 		VALUES ($1, $2, $3)
 		ON CONFLICT (goal_id, voter_id) DO UPDATE SET vote = $3
@@ -143,8 +532,11 @@ func (r *Repository) CreateVote(goalID, voterID int, vote bool) error {
 	return err
 }
 
-func (r *Repository) GetVotesByGoal(goalID int) ([]models.Vote, error) {
-	rows, err := r.db.Query(`
+func (r *Repository) GetVotesByGoal(ctx context.Context, goalID int) ([]models.Vote, error) {
+	ctx, done := r.call(ctx, "GetVotesByGoal")
+	defer done()
+
+	rows, err := r.db.QueryContext(ctx, `
 		SELECT id, goal_id, voter_id, vote, created_at 
 		FROM votes WHERE goal_id = $1
 	`, goalID)
@@ -164,8 +556,11 @@ func (r *Repository) GetVotesByGoal(goalID int) ([]models.Vote, error) {
 	return votes, nil
 }
 
-func (r *Repository) CountVotes(goalID int) (yesCount int, noCount int, err error) {
-	err = r.db.QueryRow(`
+func (r *Repository) CountVotes(ctx context.Context, goalID int) (yesCount int, noCount int, err error) {
+	ctx, done := r.call(ctx, "CountVotes")
+	defer done()
+
+	err = r.db.QueryRowContext(ctx, `
 		SELECT 
 			COUNT(CASE WHEN vote = true THEN 1 END) as yes_count,
 			COUNT(CASE WHEN vote = false THEN 1 END) as no_count
@@ -175,8 +570,11 @@ func (r *Repository) CountVotes(goalID int) (yesCount int, noCount int, err erro
 }
 
 // ChatMember methods
-func (r *Repository) AddChatMember(chatID int64, userID int) error {
-	_, err := r.db.Exec(`
+func (r *Repository) AddChatMember(ctx context.Context, chatID int64, userID int) error {
+	ctx, done := r.call(ctx, "AddChatMember")
+	defer done()
+
+	_, err := r.db.ExecContext(ctx, `
 		INSERT INTO chat_members (chat_id, user_id) 
 		VALUES ($1, $2) 
 		ON CONFLICT (chat_id, user_id) DO NOTHING
@@ -184,12 +582,16 @@ func (r *Repository) AddChatMember(chatID int64, userID int) error {
 	return err
 }
 
-func (r *Repository) GetChatMembers(chatID int64) ([]models.User, error) {
-	rows, err := r.db.Query(`
-		SELECT u.id, u.tg_id, u.username, u.balance, u.created_at 
+func (r *Repository) GetChatMembers(ctx context.Context, chatID int64) ([]models.User, error) {
+	ctx, done := r.call(ctx, "GetChatMembers")
+	defer done()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT u.id, u.tg_id, u.username, u.balance, u.locked_balance, u.created_at 
 		FROM users u
 		INNER JOIN chat_members cm ON u.id = cm.user_id
 		WHERE cm.chat_id = $1
+		ORDER BY u.id
 	`, chatID)
 	if err != nil {
 		return nil, err
@@ -199,7 +601,7 @@ func (r *Repository) GetChatMembers(chatID int64) ([]models.User, error) {
 	var users []models.User
 	for rows.Next() {
 		var user models.User
-		if err := rows.Scan(&user.ID, &user.TgID, &user.Username, &user.Balance, &user.CreatedAt); err != nil {
+		if err := rows.Scan(&user.ID, &user.TgID, &user.Username, &user.Balance, &user.LockedBalance, &user.CreatedAt); err != nil {
 			return nil, err
 		}
 		users = append(users, user)
@@ -207,23 +609,451 @@ func (r *Repository) GetChatMembers(chatID int64) ([]models.User, error) {
 	return users, nil
 }
 
+// CountChatVotes returns how many votes each user cast on goals of the chat
+func (r *Repository) CountChatVotes(ctx context.Context, chatID int64) (map[int]int, error) {
+	ctx, done := r.call(ctx, "CountChatVotes")
+	defer done()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT v.voter_id, COUNT(*)
+		FROM votes v
+		INNER JOIN goals g ON g.id = v.goal_id
+		WHERE g.chat_id = $1
+		GROUP BY v.voter_id
+	`, chatID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[int]int)
+	for rows.Next() {
+		var userID, count int
+		if err := rows.Scan(&userID, &count); err != nil {
+			return nil, err
+		}
+		counts[userID] = count
+	}
+	return counts, rows.Err()
+}
+
+// CountSucceededGoals returns how many goals of the chat each user achieved
+// since the given time, counted by when their bets were released
+func (r *Repository) CountSucceededGoals(ctx context.Context, chatID int64, since time.Time) (map[int]int, error) {
+	ctx, done := r.call(ctx, "CountSucceededGoals")
+	defer done()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT g.user_id, COUNT(*)
+		FROM transactions t
+		INNER JOIN goals g ON g.id = t.goal_id
+		WHERE g.chat_id = $1 AND t.reason = 'escrow_release' AND t.created_at >= $2
+		GROUP BY g.user_id
+	`, chatID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[int]int)
+	for rows.Next() {
+		var userID, count int
+		if err := rows.Scan(&userID, &count); err != nil {
+			return nil, err
+		}
+		counts[userID] = count
+	}
+	return counts, rows.Err()
+}
+
+// leaderboardOrder maps leaderboard metrics to their ORDER BY clauses
+var leaderboardOrder = map[string]string{
+	models.LeaderboardBalance: "u.balance + u.locked_balance DESC",
+	models.LeaderboardSuccess: "succeeded DESC, success_rate DESC",
+	models.LeaderboardRate:    "success_rate DESC, resolved DESC",
+	models.LeaderboardWon:     "stars_won DESC",
+}
+
+// GetChatLeaderboard ranks members of a chat by the given metric
+func (r *Repository) GetChatLeaderboard(ctx context.Context, chatID int64, metric string, limit int) ([]models.LeaderboardEntry, error) {
+	ctx, done := r.call(ctx, "GetChatLeaderboard")
+	defer done()
+
+	order, ok := leaderboardOrder[metric]
+	if !ok {
+		return nil, fmt.Errorf("unknown leaderboard metric %q", metric)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT u.id, u.tg_id, u.username, u.balance, u.locked_balance, u.created_at,
+			COALESCE(g.succeeded, 0) AS succeeded,
+			COALESCE(g.resolved, 0) AS resolved,
+			COALESCE(g.succeeded::float / NULLIF(g.resolved, 0), 0) AS success_rate,
+			COALESCE(w.won, 0) AS stars_won
+		FROM chat_members cm
+		INNER JOIN users u ON u.id = cm.user_id
+		LEFT JOIN (
+			SELECT user_id,
+				COUNT(*) FILTER (WHERE status = 'success') AS succeeded,
+				COUNT(*) FILTER (WHERE status IN ('success', 'failed')) AS resolved
+			FROM goals WHERE chat_id = $1
+			GROUP BY user_id
+		) g ON g.user_id = u.id
+		LEFT JOIN (
+			SELECT t.to_user_id, SUM(t.amount) AS won
+			FROM transactions t
+			INNER JOIN goals pg ON pg.id = t.goal_id
+			WHERE pg.chat_id = $1 AND t.reason LIKE 'penalty\_%'
+			GROUP BY t.to_user_id
+		) w ON w.to_user_id = u.id
+		WHERE cm.chat_id = $1
+		ORDER BY `+order+`, u.id ASC
+		LIMIT $2
+	`, chatID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.LeaderboardEntry
+	for rows.Next() {
+		var entry models.LeaderboardEntry
+		if err := rows.Scan(&entry.User.ID, &entry.User.TgID, &entry.User.Username, &entry.User.Balance,
+			&entry.User.LockedBalance, &entry.User.CreatedAt,
+			&entry.Succeeded, &entry.Resolved, &entry.SuccessRate, &entry.StarsWon); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// Conversation state methods
+
+// GetConversationState returns the saved dialog state for a user in a chat,
+// or nil if there is none or it has expired
+func (r *Repository) GetConversationState(ctx context.Context, chatID, userID int64, now time.Time) (*models.ConversationState, error) {
+	ctx, done := r.call(ctx, "GetConversationState")
+	defer done()
+
+	var data []byte
+	err := r.db.QueryRowContext(ctx, `
+		SELECT state FROM conversation_states
+		WHERE chat_id = $1 AND user_id = $2 AND expires_at > $3
+	`, chatID, userID, now).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state models.ConversationState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (r *Repository) SaveConversationState(ctx context.Context, chatID, userID int64, state *models.ConversationState, expiresAt time.Time) error {
+	ctx, done := r.call(ctx, "SaveConversationState")
+	defer done()
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(ctx, `
+		INSERT INTO conversation_states (chat_id, user_id, state, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (chat_id, user_id) DO UPDATE SET state = $3, expires_at = $4
+	`, chatID, userID, data, expiresAt)
+	return err
+}
+
+func (r *Repository) DeleteConversationState(ctx context.Context, chatID, userID int64) error {
+	ctx, done := r.call(ctx, "DeleteConversationState")
+	defer done()
+
+	_, err := r.db.ExecContext(ctx, `DELETE FROM conversation_states WHERE chat_id = $1 AND user_id = $2`, chatID, userID)
+	return err
+}
+
+func (r *Repository) DeleteExpiredConversationStates(ctx context.Context, now time.Time) error {
+	ctx, done := r.call(ctx, "DeleteExpiredConversationStates")
+	defer done()
+
+	_, err := r.db.ExecContext(ctx, `DELETE FROM conversation_states WHERE expires_at <= $1`, now)
+	return err
+}
+
+// Chat settings methods
+
+// GetChatSettings returns the settings saved for a chat, or nil if its admins
+// never changed them
+func (r *Repository) GetChatSettings(ctx context.Context, chatID int64) (*models.ChatSettings, error) {
+	ctx, done := r.call(ctx, "GetChatSettings")
+	defer done()
+
+	var settings models.ChatSettings
+	var windowSeconds int64
+	var offsetSeconds []int64
+	err := r.db.QueryRowContext(ctx, `
+		SELECT chat_id, min_bet, max_bet, voting_window_seconds, approval_percent,
+			penalty_mode, reminder_offsets_seconds, language,
+			COALESCE(change_fee, $2), COALESCE(change_window, $3), updated_at
+		FROM chat_settings WHERE chat_id = $1
+	`, chatID, r.config.ChangeFee, r.config.ChangeWindow).Scan(&settings.ChatID, &settings.MinBet, &settings.MaxBet, &windowSeconds, &settings.ApprovalPercent,
+		&settings.PenaltyMode, pq.Array(&offsetSeconds), &settings.Language, &settings.ChangeFee, &settings.ChangeWindow,
+		&settings.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	settings.VotingWindow = time.Duration(windowSeconds) * time.Second
+	settings.ReminderOffsets = make([]time.Duration, len(offsetSeconds))
+	for i, seconds := range offsetSeconds {
+		settings.ReminderOffsets[i] = time.Duration(seconds) * time.Second
+	}
+	return &settings, nil
+}
+
+// SaveChatSettings creates or replaces a chat's settings
+func (r *Repository) SaveChatSettings(ctx context.Context, settings models.ChatSettings) error {
+	ctx, done := r.call(ctx, "SaveChatSettings")
+	defer done()
+
+	offsetSeconds := make([]int64, len(settings.ReminderOffsets))
+	for i, offset := range settings.ReminderOffsets {
+		offsetSeconds[i] = int64(offset / time.Second)
+	}
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO chat_settings (chat_id, min_bet, max_bet, voting_window_seconds, approval_percent,
+			penalty_mode, reminder_offsets_seconds, language, change_fee, change_window, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, CURRENT_TIMESTAMP)
+		ON CONFLICT (chat_id) DO UPDATE SET
+			min_bet = EXCLUDED.min_bet,
+			max_bet = EXCLUDED.max_bet,
+			voting_window_seconds = EXCLUDED.voting_window_seconds,
+			approval_percent = EXCLUDED.approval_percent,
+			penalty_mode = EXCLUDED.penalty_mode,
+			reminder_offsets_seconds = EXCLUDED.reminder_offsets_seconds,
+			language = EXCLUDED.language,
+			change_fee = EXCLUDED.change_fee,
+			change_window = EXCLUDED.change_window,
+			updated_at = EXCLUDED.updated_at
+	`, settings.ChatID, settings.MinBet, settings.MaxBet, int64(settings.VotingWindow/time.Second), settings.ApprovalPercent,
+		settings.PenaltyMode, pq.Array(offsetSeconds), settings.Language, settings.ChangeFee, settings.ChangeWindow)
+	return err
+}
+
+// Treasury methods
+
+// GetTreasury returns a chat's treasury, or nil if it never received stars
+func (r *Repository) GetTreasury(ctx context.Context, chatID int64) (*models.Treasury, error) {
+	ctx, done := r.call(ctx, "GetTreasury")
+	defer done()
+
+	return scanTreasury(r.db.QueryRowContext(ctx, `SELECT `+treasuryColumns+` FROM chat_treasuries WHERE chat_id = $1`, chatID))
+}
+
+// GetTreasuryForUpdate loads a chat's treasury and locks its row until the
+// surrounding transaction ends. It must be called inside WithTx.
+func (r *Repository) GetTreasuryForUpdate(ctx context.Context, chatID int64) (*models.Treasury, error) {
+	ctx, done := r.call(ctx, "GetTreasuryForUpdate")
+	defer done()
+
+	return scanTreasury(r.db.QueryRowContext(ctx, `SELECT `+treasuryColumns+` FROM chat_treasuries WHERE chat_id = $1 FOR UPDATE`, chatID))
+}
+
+const treasuryColumns = `chat_id, balance, season_started_at, created_at`
+
+func scanTreasury(row rowScanner) (*models.Treasury, error) {
+	var treasury models.Treasury
+	var seasonStartedAt sql.NullTime
+	err := row.Scan(&treasury.ChatID, &treasury.Balance, &seasonStartedAt, &treasury.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if seasonStartedAt.Valid {
+		treasury.SeasonStartedAt = &seasonStartedAt.Time
+	}
+	return &treasury, nil
+}
+
+// AddTreasuryBalance adds amount, which may be negative, to a chat's
+// treasury, creating it on first use
+func (r *Repository) AddTreasuryBalance(ctx context.Context, chatID int64, amount int) error {
+	ctx, done := r.call(ctx, "AddTreasuryBalance")
+	defer done()
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO chat_treasuries (chat_id, balance) VALUES ($1, $2)
+		ON CONFLICT (chat_id) DO UPDATE SET balance = chat_treasuries.balance + EXCLUDED.balance
+	`, chatID, amount)
+	return err
+}
+
+// StartTreasurySeason starts a new season of a chat's treasury
+func (r *Repository) StartTreasurySeason(ctx context.Context, chatID int64, startedAt time.Time) error {
+	ctx, done := r.call(ctx, "StartTreasurySeason")
+	defer done()
+
+	_, err := r.db.ExecContext(ctx, `UPDATE chat_treasuries SET season_started_at = $1 WHERE chat_id = $2`, startedAt, chatID)
+	return err
+}
+
+// GetTreasuryTransactions returns a page of the transactions in and out of a
+// chat's treasury, newest first. Incoming entries added stars to the treasury.
+func (r *Repository) GetTreasuryTransactions(ctx context.Context, chatID int64, limit, offset int) ([]models.HistoryEntry, error) {
+	ctx, done := r.call(ctx, "GetTreasuryTransactions")
+	defer done()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT t.id, t.from_user_id, t.to_user_id, t.amount, t.reason, t.goal_id, t.treasury_chat_id, t.created_at,
+			t.to_user_id IS NULL AS incoming,
+			COALESCE(cp.username, ''), COALESCE(g.title, '')
+		FROM transactions t
+		LEFT JOIN users cp ON cp.id = COALESCE(t.to_user_id, t.from_user_id)
+		LEFT JOIN goals g ON g.id = t.goal_id
+		WHERE t.treasury_chat_id = $1
+		ORDER BY t.created_at DESC, t.id DESC
+		LIMIT $2 OFFSET $3
+	`, chatID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanHistory(rows)
+}
+
+func (r *Repository) CountTreasuryTransactions(ctx context.Context, chatID int64) (int, error) {
+	ctx, done := r.call(ctx, "CountTreasuryTransactions")
+	defer done()
+
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM transactions WHERE treasury_chat_id = $1`, chatID).Scan(&count)
+	return count, err
+}
+
 // Transaction methods
-func (r *Repository) CreateTransaction(fromUserID, toUserID, amount int, reason string, goalID *int) error {
-	_, err := r.db.Exec(`
-		INSERT INTO transactions (from_user_id, to_user_id, amount, reason, goal_id) 
-		VALUES ($1, $2, $3, $4, $5)
-	`, fromUserID, toUserID, amount, reason, goalID)
+// CreateTransaction records a star movement. A nil FromUser or ToUser means
+// the stars came from or went to escrow rather than another user, or the
+// treasury of TreasuryChatID if it is set. ID and CreatedAt are ignored.
+func (r *Repository) CreateTransaction(ctx context.Context, t models.Transaction) error {
+	ctx, done := r.call(ctx, "CreateTransaction")
+	defer done()
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO transactions (from_user_id, to_user_id, amount, reason, goal_id, treasury_chat_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, t.FromUser, t.ToUser, t.Amount, t.Reason, t.GoalID, t.TreasuryChatID)
 	return err
 }
 
-func (r *Repository) GetUserByID(id int64) (*models.User, error) {
+// GetUserTransactions returns a page of transactions where the user is the
+// sender or the recipient, newest first
+func (r *Repository) GetUserTransactions(ctx context.Context, userID, limit, offset int) ([]models.HistoryEntry, error) {
+	ctx, done := r.call(ctx, "GetUserTransactions")
+	defer done()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT t.id, t.from_user_id, t.to_user_id, t.amount, t.reason, t.goal_id, t.treasury_chat_id, t.created_at,
+			t.to_user_id IS NOT DISTINCT FROM $1 AS incoming,
+			COALESCE(cp.username, ''), COALESCE(g.title, '')
+		FROM transactions t
+		LEFT JOIN users cp ON cp.id = CASE WHEN t.to_user_id = $1 THEN t.from_user_id ELSE t.to_user_id END
+		LEFT JOIN goals g ON g.id = t.goal_id
+		WHERE t.from_user_id = $1 OR t.to_user_id = $1
+		ORDER BY t.created_at DESC, t.id DESC
+		LIMIT $2 OFFSET $3
+	`, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanHistory(rows)
+}
+
+// scanHistory reads the rows of a transaction history query
+func scanHistory(rows *sql.Rows) ([]models.HistoryEntry, error) {
+	var entries []models.HistoryEntry
+	for rows.Next() {
+		var entry models.HistoryEntry
+		var from, to, goalID, treasuryChatID sql.NullInt64
+		if err := rows.Scan(&entry.ID, &from, &to, &entry.Amount, &entry.Reason, &goalID, &treasuryChatID, &entry.CreatedAt,
+			&entry.Incoming, &entry.Counterparty, &entry.GoalTitle); err != nil {
+			return nil, err
+		}
+		entry.FromUser = nullIntPtr(from)
+		entry.ToUser = nullIntPtr(to)
+		entry.GoalID = nullIntPtr(goalID)
+		if treasuryChatID.Valid {
+			entry.TreasuryChatID = &treasuryChatID.Int64
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (r *Repository) CountUserTransactions(ctx context.Context, userID int) (int, error) {
+	ctx, done := r.call(ctx, "CountUserTransactions")
+	defer done()
+
+	var count int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM transactions
+		WHERE from_user_id = $1 OR to_user_id = $1
+	`, userID).Scan(&count)
+	return count, err
+}
+
+func (r *Repository) GetUserByID(ctx context.Context, id int64) (*models.User, error) {
+	ctx, done := r.call(ctx, "GetUserByID")
+	defer done()
+
 	var user models.User
-	err := r.db.QueryRow(`
-		SELECT id, tg_id, username, balance, created_at 
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, tg_id, username, balance, locked_balance, created_at 
 		FROM users WHERE id = $1
-	`, id).Scan(&user.ID, &user.TgID, &user.Username, &user.Balance, &user.CreatedAt)
+	`, id).Scan(&user.ID, &user.TgID, &user.Username, &user.Balance, &user.LockedBalance, &user.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
+
+// GetUserByTgID returns the user with a Telegram ID without creating it,
+// or sql.ErrNoRows
+func (r *Repository) GetUserByTgID(ctx context.Context, tgID int64) (*models.User, error) {
+	ctx, done := r.call(ctx, "GetUserByTgID")
+	defer done()
+
+	var user models.User
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, tg_id, username, balance, locked_balance, created_at
+		FROM users WHERE tg_id = $1
+	`, tgID).Scan(&user.ID, &user.TgID, &user.Username, &user.Balance, &user.LockedBalance, &user.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func nullIntPtr(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	i := int(v.Int64)
+	return &i
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"awesomeProject/internal/models"
+	"context"
+	"time"
+)
+
+// Store is the storage used by the service layer. Repository implements it
+// on top of PostgreSQL and MemoryRepository keeps everything in memory.
+type Store interface {
+	// WithTx runs fn atomically: all its changes are applied if it returns
+	// nil and discarded otherwise. Nested calls reuse the outer transaction.
+	// Cancelling ctx aborts the transaction.
+	WithTx(ctx context.Context, fn func(tx Store) error) error
+
+	// Users
+	GetOrCreateUser(ctx context.Context, tgID int64, username string) (*models.User, error)
+	GetUserByID(ctx context.Context, id int64) (*models.User, error)
+	GetUserByTgID(ctx context.Context, tgID int64) (*models.User, error)
+	DeleteUser(ctx context.Context, userID int) error
+	UpdateUserBalance(ctx context.Context, userID int, amount int) error
+	GetUserBalance(ctx context.Context, userID int) (int, error)
+	LockStars(ctx context.Context, userID int, amount int) (bool, error)
+	ReleaseStars(ctx context.Context, userID int, amount int) error
+	SpendLockedStars(ctx context.Context, userID int, amount int) error
+
+	// Goals
+	CreateGoal(ctx context.Context, userID int, chatID int64, title, description string, deadline time.Time, bet int) (*models.Goal, error)
+	GetGoal(ctx context.Context, goalID int) (*models.Goal, error)
+	GetGoalForUpdate(ctx context.Context, goalID int) (*models.Goal, error)
+	DeleteGoal(ctx context.Context, goalID int) error
+	TransitionGoalStatus(ctx context.Context, goalID int, to string, from ...string) (bool, error)
+	UpdateGoalProof(ctx context.Context, goalID int, proof string) error
+	UpdateGoalText(ctx context.Context, goalID int, title, description string) error
+	UpdateGoalDeadline(ctx context.Context, goalID int, deadline time.Time) error
+	StartVoting(ctx context.Context, goalID int, startedAt time.Time, endsAt *time.Time, voterIDs []int, requiredVotes int) error
+	IsEligibleVoter(ctx context.Context, goalID, userID int) (bool, error)
+	GetGoalVoters(ctx context.Context, goalID int) ([]models.User, error)
+	GetActiveGoalsByChat(ctx context.Context, chatID int64) ([]models.Goal, error)
+	GetUserActiveGoals(ctx context.Context, userID int) ([]models.Goal, error)
+	GetExpiredActiveGoals(ctx context.Context, now time.Time) ([]models.Goal, error)
+	GetActiveGoalsDueBefore(ctx context.Context, from, to time.Time) ([]models.Goal, error)
+	GetGoalsWithExpiredVoting(ctx context.Context, now time.Time) ([]models.Goal, error)
+
+	// Goal changes
+	CreateGoalChange(ctx context.Context, change models.GoalChange) error
+	GetGoalChanges(ctx context.Context, goalID int) ([]models.GoalChange, error)
+
+	// Proofs
+	CreateProof(ctx context.Context, proof models.Proof) (*models.Proof, error)
+
+	// Reminders
+	MarkReminderSent(ctx context.Context, goalID int, offset time.Duration) (bool, error)
+
+	// Votes
+	CreateVote(ctx context.Context, goalID, voterID int, vote bool) error
+	GetVotesByGoal(ctx context.Context, goalID int) ([]models.Vote, error)
+	CountVotes(ctx context.Context, goalID int) (yesCount int, noCount int, err error)
+
+	// Chat members
+	AddChatMember(ctx context.Context, chatID int64, userID int) error
+	GetChatMembers(ctx context.Context, chatID int64) ([]models.User, error)
+	CountChatVotes(ctx context.Context, chatID int64) (map[int]int, error)
+	CountSucceededGoals(ctx context.Context, chatID int64, since time.Time) (map[int]int, error)
+	GetChatLeaderboard(ctx context.Context, chatID int64, metric string, limit int) ([]models.LeaderboardEntry, error)
+
+	// Conversation state
+	GetConversationState(ctx context.Context, chatID, userID int64, now time.Time) (*models.ConversationState, error)
+	SaveConversationState(ctx context.Context, chatID, userID int64, state *models.ConversationState, expiresAt time.Time) error
+	DeleteConversationState(ctx context.Context, chatID, userID int64) error
+	DeleteExpiredConversationStates(ctx context.Context, now time.Time) error
+
+	// Chat settings
+	GetChatSettings(ctx context.Context, chatID int64) (*models.ChatSettings, error)
+	SaveChatSettings(ctx context.Context, settings models.ChatSettings) error
+
+	// Treasuries
+	GetTreasury(ctx context.Context, chatID int64) (*models.Treasury, error)
+	GetTreasuryForUpdate(ctx context.Context, chatID int64) (*models.Treasury, error)
+	AddTreasuryBalance(ctx context.Context, chatID int64, amount int) error
+	StartTreasurySeason(ctx context.Context, chatID int64, startedAt time.Time) error
+	GetTreasuryTransactions(ctx context.Context, chatID int64, limit, offset int) ([]models.HistoryEntry, error)
+	CountTreasuryTransactions(ctx context.Context, chatID int64) (int, error)
+
+	// Transactions
+	CreateTransaction(ctx context.Context, t models.Transaction) error
+	GetUserTransactions(ctx context.Context, userID, limit, offset int) ([]models.HistoryEntry, error)
+	CountUserTransactions(ctx context.Context, userID int) (int, error)
+}
+
+var (
+	_ Store = (*Repository)(nil)
+	_ Store = (*MemoryRepository)(nil)
+)
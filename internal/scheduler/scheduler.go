@@ -0,0 +1,143 @@
+package scheduler
+
+import (
+	"awesomeProject/internal/service"
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Clock abstracts the current time so ticks can be driven from tests
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is a Clock backed by time.Now
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Notifier announces the outcome of scheduled jobs in Telegram
+type Notifier interface {
+	NotifyGoalExpired(ctx context.Context, expired service.ExpiredGoal)
+	NotifyDeadlineReminder(ctx context.Context, reminder service.Reminder, inChat, toAuthor bool)
+	NotifyVotingResolved(ctx context.Context, result service.VotingResult)
+}
+
+// Config controls how often jobs run and where reminders are sent. When they
+// are sent is a per-chat setting.
+type Config struct {
+	Interval     time.Duration // How often jobs run
+	RemindInChat bool          // Send reminders to the goal's chat
+	RemindAuthor bool          // Send reminders to the author's private chat
+}
+
+// Scheduler periodically runs background jobs: deadline enforcement,
+// reminders and resolution of votes whose window expired
+type Scheduler struct {
+	service  *service.Service
+	notifier Notifier
+	clock    Clock
+	config   Config
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewScheduler(service *service.Service, notifier Notifier, clock Clock, config Config) *Scheduler {
+	return &Scheduler{
+		service:  service,
+		notifier: notifier,
+		clock:    clock,
+		config:   config,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start runs the scheduler loop in a background goroutine. Jobs run with ctx,
+// so cancelling it aborts a tick in progress; the loop exits on Stop or
+// when ctx is done.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(s.config.Interval)
+		defer ticker.Stop()
+
+		s.Tick(ctx)
+		for {
+			select {
+			case <-ticker.C:
+				s.Tick(ctx)
+			case <-s.stop:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop signals the loop to exit and waits for the current tick to finish
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+// Tick runs every job once using the scheduler's clock
+func (s *Scheduler) Tick(ctx context.Context) {
+	s.sendReminders(ctx)
+	s.checkExpiredGoals(ctx)
+	s.resolveExpiredVotes(ctx)
+	s.purgeExpiredConversations(ctx)
+}
+
+func (s *Scheduler) sendReminders(ctx context.Context) {
+	if !s.config.RemindInChat && !s.config.RemindAuthor {
+		return
+	}
+
+	reminders, err := s.service.DueReminders(ctx, s.clock.Now())
+	if err != nil {
+		slog.ErrorContext(ctx, "Error collecting deadline reminders", "error", err)
+		return
+	}
+
+	for _, reminder := range reminders {
+		s.notifier.NotifyDeadlineReminder(ctx, reminder, s.config.RemindInChat, s.config.RemindAuthor)
+	}
+}
+
+func (s *Scheduler) checkExpiredGoals(ctx context.Context) {
+	failed, err := s.service.CheckExpiredGoals(ctx, s.clock.Now())
+	if err != nil {
+		slog.ErrorContext(ctx, "Error checking expired goals", "error", err)
+		return
+	}
+
+	for _, expired := range failed {
+		s.notifier.NotifyGoalExpired(ctx, expired)
+	}
+}
+
+func (s *Scheduler) resolveExpiredVotes(ctx context.Context) {
+	results, err := s.service.ResolveExpiredVotes(ctx, s.clock.Now())
+	if err != nil {
+		slog.ErrorContext(ctx, "Error resolving expired votes", "error", err)
+		return
+	}
+
+	for _, result := range results {
+		s.notifier.NotifyVotingResolved(ctx, result)
+	}
+}
+
+func (s *Scheduler) purgeExpiredConversations(ctx context.Context) {
+	if err := s.service.PurgeExpiredConversations(ctx, s.clock.Now()); err != nil {
+		slog.ErrorContext(ctx, "Error purging expired conversations", "error", err)
+	}
+}
@@ -0,0 +1,203 @@
+package scheduler
+
+import (
+	"awesomeProject/internal/models"
+	"awesomeProject/internal/repository"
+	"awesomeProject/internal/service"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testChatID int64 = -1001
+
+// fakeClock is a Clock that only moves when the test advances it
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// recordingNotifier collects what the scheduler announces
+type recordingNotifier struct {
+	mu        sync.Mutex
+	expired   []service.ExpiredGoal
+	reminders []service.Reminder
+	resolved  []service.VotingResult
+}
+
+func (n *recordingNotifier) NotifyGoalExpired(_ context.Context, expired service.ExpiredGoal) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.expired = append(n.expired, expired)
+}
+
+func (n *recordingNotifier) NotifyDeadlineReminder(_ context.Context, reminder service.Reminder, _, _ bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.reminders = append(n.reminders, reminder)
+}
+
+func (n *recordingNotifier) NotifyVotingResolved(_ context.Context, result service.VotingResult) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.resolved = append(n.resolved, result)
+}
+
+// newTestScheduler returns a Scheduler on a fresh MemoryRepository driven by
+// a fake clock set to the current time. Reminders go out a day before the
+// deadline and votes stay open for two days.
+func newTestScheduler(t *testing.T) (*Scheduler, *service.Service, repository.Store, *fakeClock, *recordingNotifier) {
+	t.Helper()
+
+	store := repository.NewMemoryRepository(repository.Config{StartingBalance: 100})
+	svc := service.NewService(store, service.Config{
+		MinBet:           1,
+		ApprovalPercent:  50,
+		VotingWindow:     48 * time.Hour,
+		VotingResolution: service.ResolveAbstainYes,
+		PenaltyMode:      models.PenaltyMembers,
+		ReminderOffsets:  []time.Duration{24 * time.Hour},
+		Language:         models.LanguageRussian,
+		ChangeFee:        10,
+		ChangeWindow:     50,
+		ConversationTTL:  24 * time.Hour,
+	})
+
+	clock := &fakeClock{now: time.Now()}
+	notifier := &recordingNotifier{}
+	s := NewScheduler(svc, notifier, clock, Config{Interval: time.Minute, RemindInChat: true})
+	return s, svc, store, clock, notifier
+}
+
+// register adds a member with Telegram ID tgID to the test chat
+func register(t *testing.T, svc *service.Service, tgID int64) *models.User {
+	t.Helper()
+
+	user, err := svc.RegisterUser(context.Background(), tgID, "user", testChatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// expectBalance checks a user's available and locked stars
+func expectBalance(t *testing.T, store repository.Store, user *models.User, balance, locked int) {
+	t.Helper()
+
+	fresh, err := store.GetUserByID(context.Background(), int64(user.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fresh.Balance != balance || fresh.LockedBalance != locked {
+		t.Errorf("user %d: expected %d available and %d locked stars, got %d and %d",
+			user.ID, balance, locked, fresh.Balance, fresh.LockedBalance)
+	}
+}
+
+func TestTickFailsExpiredGoalOnce(t *testing.T) {
+	s, svc, store, clock, notifier := newTestScheduler(t)
+	author := register(t, svc, 1)
+	member := register(t, svc, 2)
+
+	goal, err := svc.CreateGoal(context.Background(), author.ID, testChatID, "Run", "10 km", clock.Now().Add(3*24*time.Hour), 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is due yet
+	s.Tick(context.Background())
+	if len(notifier.reminders) != 0 || len(notifier.expired) != 0 {
+		t.Fatalf("expected nothing to happen before the deadline, got %d reminders and %d expired goals",
+			len(notifier.reminders), len(notifier.expired))
+	}
+
+	// A day before the deadline the reminder goes out, once
+	clock.Advance(2*24*time.Hour + time.Hour)
+	s.Tick(context.Background())
+	s.Tick(context.Background())
+	if len(notifier.reminders) != 1 || notifier.reminders[0].Goal.ID != goal.ID {
+		t.Fatalf("expected one reminder for the goal, got %+v", notifier.reminders)
+	}
+
+	// After the deadline the goal fails, and repeated ticks at the same
+	// instant and later do not take the penalty again
+	clock.Advance(24 * time.Hour)
+	for i := 0; i < 3; i++ {
+		s.Tick(context.Background())
+	}
+	clock.Advance(time.Hour)
+	s.Tick(context.Background())
+
+	if len(notifier.expired) != 1 || notifier.expired[0].Goal.ID != goal.ID {
+		t.Fatalf("expected the goal to expire once, got %+v", notifier.expired)
+	}
+	expectBalance(t, store, author, 70, 0)
+	expectBalance(t, store, member, 130, 0)
+
+	fresh, err := store.GetGoal(context.Background(), goal.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fresh.Status != "failed" {
+		t.Errorf("expected the goal to be failed, got %q", fresh.Status)
+	}
+}
+
+func TestTickResolvesExpiredVoteOnce(t *testing.T) {
+	s, svc, store, clock, notifier := newTestScheduler(t)
+	author := register(t, svc, 1)
+	voter := register(t, svc, 2)
+	register(t, svc, 3)
+	register(t, svc, 4)
+
+	ctx := context.Background()
+	goal, err := svc.CreateGoal(ctx, author.ID, testChatID, "Run", "10 km", clock.Now().Add(7*24*time.Hour), 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.SubmitProof(ctx, goal.ID, author.ID, testChatID, models.Proof{Kind: models.ProofText, Caption: "Done"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.VoteOnGoal(ctx, goal.ID, voter.ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// The vote is still open within its window
+	clock.Advance(24 * time.Hour)
+	s.Tick(ctx)
+	if len(notifier.resolved) != 0 {
+		t.Fatalf("expected the vote to stay open, got %+v", notifier.resolved)
+	}
+
+	// Once the window ends the members who did not vote count as yes and the
+	// goal succeeds; further ticks leave it alone
+	clock.Advance(2 * 24 * time.Hour)
+	for i := 0; i < 3; i++ {
+		s.Tick(ctx)
+	}
+
+	if len(notifier.resolved) != 1 {
+		t.Fatalf("expected the vote to be resolved once, got %d results", len(notifier.resolved))
+	}
+	result := notifier.resolved[0]
+	if !result.Succeeded || result.Yes != 1 || result.No != 0 || result.Abstained != 2 {
+		t.Errorf("expected success with 1 yes and 2 abstentions, got %+v", result)
+	}
+	if len(notifier.expired) != 0 {
+		t.Errorf("expected a goal on vote not to expire, got %+v", notifier.expired)
+	}
+	expectBalance(t, store, author, 100, 0)
+}
@@ -0,0 +1,301 @@
+package service
+
+import (
+	"awesomeProject/internal/metrics"
+	"awesomeProject/internal/models"
+	"awesomeProject/internal/repository"
+	"context"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxTitleLength is the length of goals.title
+const maxTitleLength = 255
+
+// ChangeTerms are the chat's rules for extending a goal's deadline or
+// cancelling it
+type ChangeTerms struct {
+	Fee     int       // Stars charged, a share of the bet rounded up
+	Until   time.Time // Last moment the goal may be extended or cancelled
+	Allowed bool      // Whether the goal may still be extended or cancelled
+}
+
+// GoalChangeResult is a committed change of a goal
+type GoalChangeResult struct {
+	Goal        models.Goal       // The goal after the change
+	Change      models.GoalChange // The audit trail entry
+	PenaltyMode string            // Strategy that moved the fee, empty without a fee
+}
+
+// GoalChangeTerms returns what extending or cancelling a goal costs now
+func (s *Service) GoalChangeTerms(ctx context.Context, goal *models.Goal) (ChangeTerms, error) {
+	settings, err := s.ChatSettings(ctx, goal.ChatID)
+	if err != nil {
+		return ChangeTerms{}, err
+	}
+	deadline, err := originalDeadline(ctx, s.repo, goal)
+	if err != nil {
+		return ChangeTerms{}, err
+	}
+	return changeTerms(goal, deadline, settings, time.Now()), nil
+}
+
+// GetGoalChanges returns a goal's audit trail, oldest first
+func (s *Service) GetGoalChanges(ctx context.Context, goalID int) ([]models.GoalChange, error) {
+	return s.repo.GetGoalChanges(ctx, goalID)
+}
+
+// changeTerms applies a chat's settings to a goal. Goals may be changed
+// while less than ChangeWindow percent of the time between their creation
+// and their original deadline has passed, so extending a goal does not
+// widen the window for further changes.
+func changeTerms(goal *models.Goal, deadline time.Time, settings models.ChatSettings, now time.Time) ChangeTerms {
+	span := deadline.Sub(goal.CreatedAt)
+	until := goal.CreatedAt.Add(span * time.Duration(settings.ChangeWindow) / 100)
+
+	return ChangeTerms{
+		Fee:     (goal.Bet*settings.ChangeFee + 99) / 100,
+		Until:   until,
+		Allowed: settings.ChangeWindow > 0 && now.Before(until),
+	}
+}
+
+// originalDeadline returns the deadline goal was created with. Every
+// extension records the deadline it replaced, so that is the old value of
+// the first one.
+func originalDeadline(ctx context.Context, store repository.Store, goal *models.Goal) (time.Time, error) {
+	changes, err := store.GetGoalChanges(ctx, goal.ID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, change := range changes {
+		if change.Kind == models.GoalChangeDeadline {
+			return time.Parse(time.RFC3339, change.OldValue)
+		}
+	}
+	return goal.Deadline, nil
+}
+
+// EditGoalText replaces the title or description of an active goal, which
+// is free at any time. kind is models.GoalChangeTitle or
+// models.GoalChangeDescription.
+func (s *Service) EditGoalText(ctx context.Context, goalID, userID int, kind, value string) (*GoalChangeResult, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, UserErrorf("текст не может быть пустым")
+	}
+	if kind == models.GoalChangeTitle && utf8.RuneCountInString(value) > maxTitleLength {
+		return nil, UserErrorf("название должно быть не длиннее %d символов", maxTitleLength)
+	}
+
+	var result *GoalChangeResult
+	err := s.repo.WithTx(ctx, func(tx repository.Store) error {
+		goal, err := s.changeableGoal(ctx, tx, goalID, userID)
+		if err != nil {
+			return err
+		}
+
+		change := models.GoalChange{GoalID: goalID, UserID: userID, Kind: kind, NewValue: value}
+		switch kind {
+		case models.GoalChangeTitle:
+			change.OldValue, goal.Title = goal.Title, value
+		case models.GoalChangeDescription:
+			change.OldValue, goal.Description = goal.Description, value
+		default:
+			return UserErrorf("неизвестное изменение: %s", kind)
+		}
+
+		if err := tx.UpdateGoalText(ctx, goalID, goal.Title, goal.Description); err != nil {
+			return err
+		}
+		if err := tx.CreateGoalChange(ctx, change); err != nil {
+			return err
+		}
+
+		result = &GoalChangeResult{Goal: *goal, Change: change}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ExtendDeadline moves an active goal's deadline later if the chat's rules
+// allow it, charging the author the chat's fee from their available balance
+func (s *Service) ExtendDeadline(ctx context.Context, goalID, userID int, deadline time.Time) (*GoalChangeResult, error) {
+	var result *GoalChangeResult
+	var terms ChangeTerms
+	err := s.repo.WithTx(ctx, func(tx repository.Store) error {
+		goal, err := s.changeableGoal(ctx, tx, goalID, userID)
+		if err != nil {
+			return err
+		}
+		if !deadline.After(goal.Deadline) {
+			return UserErrorf("новый срок должен быть позже текущего (%s)", goal.Deadline.Format("02.01.2006"))
+		}
+
+		settings, err := s.chatSettings(ctx, tx, goal.ChatID)
+		if err != nil {
+			return err
+		}
+		if terms, err = allowedTerms(ctx, tx, goal, settings); err != nil {
+			return err
+		}
+
+		var mode string
+		if terms.Fee > 0 {
+			locked, err := tx.LockStars(ctx, userID, terms.Fee)
+			if err != nil {
+				return err
+			}
+			if !locked {
+				return UserErrorf("недостаточно звезд для оплаты комиссии: требуется %d", terms.Fee)
+			}
+			if mode, err = s.chargeFee(ctx, tx, goal, terms.Fee, settings); err != nil {
+				return err
+			}
+		}
+
+		change := models.GoalChange{
+			GoalID:   goalID,
+			UserID:   userID,
+			Kind:     models.GoalChangeDeadline,
+			OldValue: goal.Deadline.Format(time.RFC3339),
+			NewValue: deadline.Format(time.RFC3339),
+			Fee:      terms.Fee,
+		}
+		if err := tx.UpdateGoalDeadline(ctx, goalID, deadline); err != nil {
+			return err
+		}
+		if err := tx.CreateGoalChange(ctx, change); err != nil {
+			return err
+		}
+
+		goal.Deadline = deadline
+		result = &GoalChangeResult{Goal: *goal, Change: change, PenaltyMode: mode}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if terms.Fee > 0 {
+		metrics.StarsMoved.WithLabelValues(PenaltyReason(result.PenaltyMode)).Add(float64(terms.Fee))
+	}
+	return result, nil
+}
+
+// CancelGoal withdraws an active goal if the chat's rules allow it. The bet
+// is returned to the author minus the chat's fee.
+func (s *Service) CancelGoal(ctx context.Context, goalID, userID int) (*GoalChangeResult, error) {
+	var result *GoalChangeResult
+	var terms ChangeTerms
+	err := s.repo.WithTx(ctx, func(tx repository.Store) error {
+		goal, err := s.changeableGoal(ctx, tx, goalID, userID)
+		if err != nil {
+			return err
+		}
+
+		settings, err := s.chatSettings(ctx, tx, goal.ChatID)
+		if err != nil {
+			return err
+		}
+		if terms, err = allowedTerms(ctx, tx, goal, settings); err != nil {
+			return err
+		}
+		if err := claimGoal(ctx, tx, goal, "cancelled", "active"); err != nil {
+			return err
+		}
+
+		if refund := goal.Bet - terms.Fee; refund > 0 {
+			if err := tx.ReleaseStars(ctx, userID, refund); err != nil {
+				return err
+			}
+			if err := tx.CreateTransaction(ctx, models.Transaction{ToUser: &userID, Amount: refund, Reason: "escrow_refund", GoalID: &goalID}); err != nil {
+				return err
+			}
+		}
+
+		var mode string
+		if terms.Fee > 0 {
+			if mode, err = s.chargeFee(ctx, tx, goal, terms.Fee, settings); err != nil {
+				return err
+			}
+		}
+
+		change := models.GoalChange{
+			GoalID:   goalID,
+			UserID:   userID,
+			Kind:     models.GoalChangeCancel,
+			OldValue: goal.Status,
+			NewValue: "cancelled",
+			Fee:      terms.Fee,
+		}
+		if err := tx.CreateGoalChange(ctx, change); err != nil {
+			return err
+		}
+
+		goal.Status = "cancelled"
+		result = &GoalChangeResult{Goal: *goal, Change: change, PenaltyMode: mode}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	metrics.Goals.WithLabelValues(metrics.GoalCancelled).Inc()
+	metrics.StarsMoved.WithLabelValues("escrow_refund").Add(float64(result.Goal.Bet - terms.Fee))
+	if terms.Fee > 0 {
+		metrics.StarsMoved.WithLabelValues(PenaltyReason(result.PenaltyMode)).Add(float64(terms.Fee))
+	}
+	return result, nil
+}
+
+// changeableGoal locks a goal that its author may still change
+func (s *Service) changeableGoal(ctx context.Context, tx repository.Store, goalID, userID int) (*models.Goal, error) {
+	goal, err := tx.GetGoalForUpdate(ctx, goalID)
+	if err != nil {
+		return nil, err
+	}
+	if goal.UserID != userID {
+		return nil, UserErrorf("изменять цель может только ее автор")
+	}
+	if goal.Status != "active" {
+		return nil, UserErrorf("изменить можно только активную цель, по которой еще не отправлено доказательство")
+	}
+	return goal, nil
+}
+
+// allowedTerms returns the terms of extending or cancelling goal now, or an
+// error explaining why the chat's rules forbid it
+func allowedTerms(ctx context.Context, tx repository.Store, goal *models.Goal, settings models.ChatSettings) (ChangeTerms, error) {
+	deadline, err := originalDeadline(ctx, tx, goal)
+	if err != nil {
+		return ChangeTerms{}, err
+	}
+
+	terms := changeTerms(goal, deadline, settings, time.Now())
+	if settings.ChangeWindow == 0 {
+		return terms, UserErrorf("в этой беседе цели нельзя продлевать и отменять")
+	}
+	if !terms.Allowed {
+		return terms, UserErrorf("продлить или отменить цель можно было до %s", terms.Until.Format("02.01.2006 15:04"))
+	}
+	return terms, nil
+}
+
+// chargeFee moves a fee already locked in the author's escrow like a
+// penalty of the chat's strategy and returns the strategy's mode
+func (s *Service) chargeFee(ctx context.Context, tx repository.Store, goal *models.Goal, fee int, settings models.ChatSettings) (string, error) {
+	if err := tx.SpendLockedStars(ctx, goal.UserID, fee); err != nil {
+		return "", err
+	}
+
+	// Strategies move a goal's whole bet, so hand them the fee as the bet
+	charged := *goal
+	charged.Bet = fee
+
+	return s.distributePenalty(ctx, tx, &charged, settings.PenaltyMode)
+}
@@ -0,0 +1,296 @@
+package service
+
+import (
+	"awesomeProject/internal/models"
+	"awesomeProject/internal/repository"
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+)
+
+// errNoRecipients is returned by strategies that have nobody to pay, e.g.
+// when the author is the only chat member or is the charity account
+var errNoRecipients = errors.New("no members to share the penalty")
+
+// PenaltyStrategy decides where the bet of a failed goal goes. Chats pick a
+// strategy by name in their settings.
+type PenaltyStrategy interface {
+	// Name is the strategy's models.Penalty* mode
+	Name() string
+
+	// Distribute moves a failed goal's bet, already taken out of the
+	// author's escrow, inside the caller's transaction. Every movement is
+	// recorded with PenaltyReason(Name()).
+	Distribute(ctx context.Context, tx repository.Store, goal *models.Goal) error
+}
+
+// PenaltyReason is the transaction reason of penalties moved under mode
+func PenaltyReason(mode string) string {
+	return "penalty_" + mode
+}
+
+// penaltyStrategies returns the strategies available with config, in menu
+// order. The charity strategy needs an account to send stars to.
+func penaltyStrategies(config Config) []PenaltyStrategy {
+	strategies := []PenaltyStrategy{
+		membersSplit{},
+		votersSplit{},
+		weightedSplit{},
+		treasuryPenalty{},
+		burnPenalty{},
+	}
+	if config.CharityAccount != 0 {
+		strategies = append(strategies, charityPenalty{tgID: config.CharityAccount})
+	}
+	return strategies
+}
+
+// PenaltyModes returns the names of the penalty strategies chats can choose
+func (s *Service) PenaltyModes() []string {
+	modes := make([]string, len(s.penalties))
+	for i, strategy := range s.penalties {
+		modes[i] = strategy.Name()
+	}
+	return modes
+}
+
+// penaltyStrategy returns the strategy named mode. A mode that is no longer
+// available, e.g. charity after its account was removed from the
+// configuration, falls back to the configured default.
+func (s *Service) penaltyStrategy(mode string) PenaltyStrategy {
+	for _, strategy := range s.penalties {
+		if strategy.Name() == mode {
+			return strategy
+		}
+	}
+	for _, strategy := range s.penalties {
+		if strategy.Name() == s.config.PenaltyMode {
+			return strategy
+		}
+	}
+	return membersSplit{}
+}
+
+// distributePenalty moves goal.Bet, already taken out of the author's escrow,
+// with the strategy named mode and returns the mode that moved it. When the
+// strategy has nobody to pay, e.g. the author is alone in the chat, the bet
+// goes to the chat's treasury so it waits there for future members.
+func (s *Service) distributePenalty(ctx context.Context, tx repository.Store, goal *models.Goal, mode string) (string, error) {
+	strategy := s.penaltyStrategy(mode)
+	err := strategy.Distribute(ctx, tx, goal)
+	if errors.Is(err, errNoRecipients) {
+		strategy = treasuryPenalty{}
+		err = strategy.Distribute(ctx, tx, goal)
+	}
+	if err != nil {
+		return "", err
+	}
+	return strategy.Name(), nil
+}
+
+// membersSplit shares the bet evenly among every chat member except the author
+type membersSplit struct{}
+
+func (membersSplit) Name() string { return models.PenaltyMembers }
+
+func (m membersSplit) Distribute(ctx context.Context, tx repository.Store, goal *models.Goal) error {
+	recipients, err := otherMembers(ctx, tx, goal)
+	if err != nil {
+		return err
+	}
+	return payShares(ctx, tx, goal, recipients, equalWeights(len(recipients)), m.Name())
+}
+
+// votersSplit shares the bet evenly among the members who voted on the goal;
+// eligible members who did not vote get nothing. Goals nobody voted on, e.g.
+// because they expired before proof, go to every member except the author.
+type votersSplit struct{}
+
+func (votersSplit) Name() string { return models.PenaltyVoters }
+
+func (v votersSplit) Distribute(ctx context.Context, tx repository.Store, goal *models.Goal) error {
+	recipients, err := tx.GetGoalVoters(ctx, goal.ID)
+	if err != nil {
+		return err
+	}
+	if len(recipients) == 0 {
+		if recipients, err = otherMembers(ctx, tx, goal); err != nil {
+			return err
+		}
+	}
+	return payShares(ctx, tx, goal, recipients, equalWeights(len(recipients)), v.Name())
+}
+
+// weightedSplit shares the bet among members other than the author in
+// proportion to the votes each has cast in the chat, rewarding those who
+// take part in judging goals. Without any votes it splits evenly.
+type weightedSplit struct{}
+
+func (weightedSplit) Name() string { return models.PenaltyWeighted }
+
+func (w weightedSplit) Distribute(ctx context.Context, tx repository.Store, goal *models.Goal) error {
+	recipients, err := otherMembers(ctx, tx, goal)
+	if err != nil {
+		return err
+	}
+
+	votes, err := tx.CountChatVotes(ctx, goal.ChatID)
+	if err != nil {
+		return err
+	}
+
+	weights := make([]int, len(recipients))
+	total := 0
+	for i, recipient := range recipients {
+		weights[i] = votes[recipient.ID]
+		total += weights[i]
+	}
+	if total == 0 {
+		weights = equalWeights(len(recipients))
+	}
+
+	return payShares(ctx, tx, goal, recipients, weights, w.Name())
+}
+
+// treasuryPenalty sends the bet to the chat's treasury
+type treasuryPenalty struct{}
+
+func (treasuryPenalty) Name() string { return models.PenaltyTreasury }
+
+func (t treasuryPenalty) Distribute(ctx context.Context, tx repository.Store, goal *models.Goal) error {
+	if err := tx.AddTreasuryBalance(ctx, goal.ChatID, goal.Bet); err != nil {
+		return err
+	}
+	return tx.CreateTransaction(ctx, models.Transaction{
+		FromUser:       &goal.UserID,
+		Amount:         goal.Bet,
+		Reason:         PenaltyReason(t.Name()),
+		GoalID:         &goal.ID,
+		TreasuryChatID: &goal.ChatID,
+	})
+}
+
+// burnPenalty destroys the bet
+type burnPenalty struct{}
+
+func (burnPenalty) Name() string { return models.PenaltyBurn }
+
+func (b burnPenalty) Distribute(ctx context.Context, tx repository.Store, goal *models.Goal) error {
+	return tx.CreateTransaction(ctx, models.Transaction{
+		FromUser: &goal.UserID,
+		Amount:   goal.Bet,
+		Reason:   PenaltyReason(b.Name()),
+		GoalID:   &goal.ID,
+	})
+}
+
+// charityPenalty sends the bet to a designated account, such as one whose
+// owner donates the collected stars. The account must have started the bot;
+// it is never created here, so it does not get a starting balance.
+type charityPenalty struct {
+	tgID int64 // Telegram ID of the account
+}
+
+func (charityPenalty) Name() string { return models.PenaltyCharity }
+
+func (c charityPenalty) Distribute(ctx context.Context, tx repository.Store, goal *models.Goal) error {
+	account, err := tx.GetUserByTgID(ctx, c.tgID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errNoRecipients
+	}
+	if err != nil {
+		return err
+	}
+	if account.ID == goal.UserID {
+		return errNoRecipients
+	}
+	return payShares(ctx, tx, goal, []models.User{*account}, []int{1}, c.Name())
+}
+
+// otherMembers returns the chat members except the goal's author
+func otherMembers(ctx context.Context, tx repository.Store, goal *models.Goal) ([]models.User, error) {
+	members, err := tx.GetChatMembers(ctx, goal.ChatID)
+	if err != nil {
+		return nil, err
+	}
+
+	var others []models.User
+	for _, member := range members {
+		if member.ID != goal.UserID {
+			others = append(others, member)
+		}
+	}
+	return others, nil
+}
+
+func equalWeights(n int) []int {
+	weights := make([]int, n)
+	for i := range weights {
+		weights[i] = 1
+	}
+	return weights
+}
+
+// payShares credits recipients with the goal's bet split by weights
+func payShares(ctx context.Context, tx repository.Store, goal *models.Goal, recipients []models.User, weights []int, mode string) error {
+	if len(recipients) == 0 {
+		return errNoRecipients
+	}
+
+	// Rotate tie-breaking by goal so leftover stars do not always go to the
+	// same member
+	shares := splitByWeight(goal.Bet, weights, goal.ID%len(recipients))
+
+	for i, recipient := range recipients {
+		if shares[i] == 0 {
+			continue
+		}
+
+		if err := tx.UpdateUserBalance(ctx, recipient.ID, shares[i]); err != nil {
+			return err
+		}
+
+		err := tx.CreateTransaction(ctx, models.Transaction{
+			FromUser: &goal.UserID,
+			ToUser:   &recipient.ID,
+			Amount:   shares[i],
+			Reason:   PenaltyReason(mode),
+			GoalID:   &goal.ID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitByWeight divides amount in proportion to weights, which must not all
+// be zero. Stars left after rounding down go one each to the largest
+// remainders; ties are broken in index order starting at start.
+func splitByWeight(amount int, weights []int, start int) []int {
+	total := 0
+	for _, w := range weights {
+		total += w
+	}
+
+	shares := make([]int, len(weights))
+	remainders := make([]int, len(weights))
+	left := amount
+	for i, w := range weights {
+		shares[i] = amount * w / total
+		remainders[i] = amount * w % total
+		left -= shares[i]
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = (start + i) % len(weights)
+	}
+	sort.SliceStable(order, func(a, b int) bool { return remainders[order[a]] > remainders[order[b]] })
+
+	for _, i := range order[:left] {
+		shares[i]++
+	}
+	return shares
+}
@@ -1,243 +1,679 @@
 package service
 
 import (
+	"awesomeProject/internal/logging"
+	"awesomeProject/internal/metrics"
 	"awesomeProject/internal/models"
 	"awesomeProject/internal/repository"
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"sort"
 	"time"
 )
 
+// ErrGoalResolved is returned when a goal has already left the active and
+// voting states, e.g. because another vote or the scheduler finalized it.
+var ErrGoalResolved = UserErrorf("цель уже завершена")
+
+// UserError is an error meant to be shown to users. Format is the Russian
+// text, which handlers look up in the chat's language before formatting it
+// with Args.
+type UserError struct {
+	Format string
+	Args   []any
+}
+
+// UserErrorf returns a UserError for format and args
+func UserErrorf(format string, args ...any) error {
+	return &UserError{Format: format, Args: args}
+}
+
+func (e *UserError) Error() string {
+	return fmt.Sprintf(e.Format, e.Args...)
+}
+
+// IsTimeout reports whether err means storage did not answer in time, so the
+// same action can simply be retried later
+func IsTimeout(err error) bool {
+	return repository.IsTimeout(err)
+}
+
+// Rules for resolving a vote whose window expired.
+const (
+	// ResolveAbstainYes counts members who did not vote as voting yes
+	ResolveAbstainYes = "abstain_yes"
+	// ResolveCastMajority decides by a simple majority of the votes cast;
+	// a tie, including no votes at all, goes to the author
+	ResolveCastMajority = "cast_majority"
+)
+
+// Config holds tunable business rules. MinBet, MaxBet, ApprovalPercent,
+// VotingWindow, PenaltyMode, ReminderOffsets, Language, ChangeFee and
+// ChangeWindow are defaults for chats whose admins have not changed them
+// with /settings.
+type Config struct {
+	MinBet           int             // Smallest bet allowed
+	MaxBet           int             // Largest bet allowed, 0 for no limit
+	ApprovalPercent  int             // Share of eligible voters, 1-100, whose yes votes approve a goal
+	VotingWindow     time.Duration   // How long voting stays open after proof, 0 for no limit
+	VotingResolution string          // ResolveAbstainYes or ResolveCastMajority
+	PenaltyMode      string          // One of models.PenaltyModes
+	ReminderOffsets  []time.Duration // How long before a deadline to remind the author
+	Language         string          // models.LanguageRussian or models.LanguageEnglish
+	ChangeFee        int             // Percent of the bet, 0-100, charged to extend a deadline or cancel a goal
+	ChangeWindow     int             // Percent of a goal's time, 0-100, during which it may be extended or cancelled
+	CharityAccount   int64           // Telegram ID receiving models.PenaltyCharity penalties, 0 to disable that mode
+	ConversationTTL  time.Duration   // How long an unfinished dialog such as /newgoal is kept
+}
+
 type Service struct {
-	repo *repository.Repository
+	repo      repository.Store
+	config    Config
+	penalties []PenaltyStrategy
 }
 
-func NewService(repo *repository.Repository) *Service {
-	return &Service{repo: repo}
+func NewService(repo repository.Store, config Config) *Service {
+	return &Service{repo: repo, config: config, penalties: penaltyStrategies(config)}
 }
 
 // RegisterUser creates or retrieves a user
-func (s *Service) RegisterUser(tgID int64, username string, chatID int64) (*models.User, error) {
-	user, err := s.repo.GetOrCreateUser(tgID, username)
+func (s *Service) RegisterUser(ctx context.Context, tgID int64, username string, chatID int64) (*models.User, error) {
+	user, err := s.repo.GetOrCreateUser(ctx, tgID, username)
 	if err != nil {
 		return nil, err
 	}
 
 	// Add user to chat members
-	if err := s.repo.AddChatMember(chatID, user.ID); err != nil {
+	if err := s.repo.AddChatMember(ctx, chatID, user.ID); err != nil {
 		return nil, err
 	}
 
 	return user, nil
 }
 
-// CreateGoal creates a new goal for a user
-func (s *Service) CreateGoal(userID int, chatID int64, title, description string, deadline time.Time, bet int) (*models.Goal, error) {
-	// Check if user has enough balance
-	balance, err := s.repo.GetUserBalance(userID)
+// CreateGoal creates a new goal for a user and locks the bet in escrow
+func (s *Service) CreateGoal(ctx context.Context, userID int, chatID int64, title, description string, deadline time.Time, bet int) (*models.Goal, error) {
+	settings, err := s.ChatSettings(ctx, chatID)
 	if err != nil {
 		return nil, err
 	}
-
-	if balance < bet {
-		return nil, fmt.Errorf("недостаточно звезд на балансе. У вас: %d, требуется: %d", balance, bet)
+	if bet < settings.MinBet {
+		return nil, UserErrorf("минимальная ставка в этой беседе: %d звезд", settings.MinBet)
+	}
+	if settings.MaxBet > 0 && bet > settings.MaxBet {
+		return nil, UserErrorf("максимальная ставка в этой беседе: %d звезд", settings.MaxBet)
 	}
 
-	// Create goal
-	goal, err := s.repo.CreateGoal(userID, chatID, title, description, deadline, bet)
+	var goal *models.Goal
+
+	err = s.repo.WithTx(ctx, func(tx repository.Store) error {
+		// Move the bet from the available balance into escrow
+		locked, err := tx.LockStars(ctx, userID, bet)
+		if err != nil {
+			return err
+		}
+		if !locked {
+			balance, err := tx.GetUserBalance(ctx, userID)
+			if err != nil {
+				return err
+			}
+			return UserErrorf("недостаточно звезд на балансе. У вас: %d, требуется: %d", balance, bet)
+		}
+
+		// Create goal
+		goal, err = tx.CreateGoal(ctx, userID, chatID, title, description, deadline, bet)
+		if err != nil {
+			return err
+		}
+
+		return tx.CreateTransaction(ctx, models.Transaction{FromUser: &userID, Amount: bet, Reason: "escrow_lock", GoalID: &goal.ID})
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	metrics.Goals.WithLabelValues(metrics.GoalCreated).Inc()
+	metrics.StarsMoved.WithLabelValues("escrow_lock").Add(float64(bet))
 	return goal, nil
 }
 
-// SubmitProof submits proof of goal completion
-func (s *Service) SubmitProof(goalID int, proof string) error {
-	goal, err := s.repo.GetGoal(goalID)
-	if err != nil {
-		return err
-	}
+// SubmitProof stores userID's proof of goal completion in chatID and opens
+// voting
+func (s *Service) SubmitProof(ctx context.Context, goalID, userID int, chatID int64, proof models.Proof) error {
+	return s.repo.WithTx(ctx, func(tx repository.Store) error {
+		goal, err := tx.GetGoalForUpdate(ctx, goalID)
+		if err != nil {
+			return err
+		}
+		if err := CheckProof(goal, userID, chatID); err != nil {
+			return err
+		}
+
+		proof.GoalID = goalID
+		if _, err := tx.CreateProof(ctx, proof); err != nil {
+			return err
+		}
 
+		if err := tx.UpdateGoalProof(ctx, goalID, proof.Caption); err != nil {
+			return err
+		}
+
+		// Freeze who may vote and the majority needed, so members joining
+		// mid-vote neither vote nor shift the threshold
+		members, err := tx.GetChatMembers(ctx, goal.ChatID)
+		if err != nil {
+			return err
+		}
+
+		var voterIDs []int
+		for _, member := range members {
+			if member.ID != goal.UserID {
+				voterIDs = append(voterIDs, member.ID)
+			}
+		}
+
+		settings, err := s.chatSettings(ctx, tx, goal.ChatID)
+		if err != nil {
+			return err
+		}
+
+		requiredVotes := requiredVotes(len(voterIDs), settings.ApprovalPercent)
+
+		now := time.Now()
+		var endsAt *time.Time
+		if settings.VotingWindow > 0 {
+			deadline := now.Add(settings.VotingWindow)
+			endsAt = &deadline
+		}
+
+		return tx.StartVoting(ctx, goalID, now, endsAt, voterIDs, requiredVotes)
+	})
+}
+
+// CheckProof returns an error unless userID may submit proof for goal in chatID
+func CheckProof(goal *models.Goal, userID int, chatID int64) error {
+	if goal.ChatID != chatID {
+		return UserErrorf("цель относится к другой беседе")
+	}
+	if goal.UserID != userID {
+		return UserErrorf("отправить доказательство может только автор цели")
+	}
 	if goal.Status != "active" {
-		return fmt.Errorf("цель должна быть активной для отправки доказательства")
+		return UserErrorf("цель должна быть активной для отправки доказательства")
 	}
+	return nil
+}
 
-	return s.repo.UpdateGoalProof(goalID, proof)
+// requiredVotes is the number of yes votes out of voters that approves a
+// goal: approvalPercent of them, rounded up
+func requiredVotes(voters, approvalPercent int) int {
+	return (voters*approvalPercent + 99) / 100
 }
 
 // VoteOnGoal allows a user to vote on a goal
-func (s *Service) VoteOnGoal(goalID, voterID int, vote bool) error {
-	goal, err := s.repo.GetGoal(goalID)
+func (s *Service) VoteOnGoal(ctx context.Context, goalID, voterID int, vote bool) error {
+	return s.repo.WithTx(ctx, func(tx repository.Store) error {
+		// Lock the goal so the vote cannot land after it has been resolved
+		goal, err := tx.GetGoalForUpdate(ctx, goalID)
+		if err != nil {
+			return err
+		}
+
+		if goal.Status == "active" {
+			return UserErrorf("голосование доступно только для целей в статусе 'done_pending'")
+		}
+		if goal.Status != "done_pending" {
+			return ErrGoalResolved
+		}
+
+		// User can't vote for their own goal
+		if goal.UserID == voterID {
+			return UserErrorf("вы не можете голосовать за свою собственную цель")
+		}
+
+		eligible, err := tx.IsEligibleVoter(ctx, goalID, voterID)
+		if err != nil {
+			return err
+		}
+		if !eligible {
+			return UserErrorf("голосовать могут только участники, бывшие в беседе на момент отправки доказательства")
+		}
+
+		return tx.CreateVote(ctx, goalID, voterID, vote)
+	})
+}
+
+// VoteTally is the state of a goal's vote after a ballot was counted
+type VoteTally struct {
+	Goal     models.Goal
+	Status   string // "done_pending" while the vote is open, then "success" or "failed"
+	Yes      int
+	No       int
+	Required int // Yes votes that approve the goal
+
+	PenaltyMode string // Strategy that moved the bet if the goal failed
+}
+
+// FinalizeGoal finalizes a goal based on votes
+func (s *Service) FinalizeGoal(ctx context.Context, goalID int, chatID int64) (*VoteTally, error) {
+	var tally *VoteTally
+	var reason string
+
+	err := s.repo.WithTx(ctx, func(tx repository.Store) error {
+		// Lock the goal so concurrent votes are finalized one at a time
+		goal, err := tx.GetGoalForUpdate(ctx, goalID)
+		if err != nil {
+			return err
+		}
+
+		if goal.Status != "done_pending" {
+			return ErrGoalResolved
+		}
+
+		// Count votes
+		yesCount, noCount, err := tx.CountVotes(ctx, goalID)
+		if err != nil {
+			return err
+		}
+
+		// Eligible voters and majority were frozen when voting started
+		totalVoters := goal.ChatMembersCount
+		requiredVotes := goal.RequiredVotes
+
+		tally = &VoteTally{Yes: yesCount, No: noCount, Required: requiredVotes}
+
+		// Check if majority voted yes
+		if yesCount >= requiredVotes {
+			// Success - goal completed
+			if err := s.completeGoal(ctx, tx, goal); err != nil {
+				return err
+			}
+			reason = "escrow_release"
+		} else if noCount > totalVoters-requiredVotes {
+			// Failed - not enough yes votes
+			mode, err := s.failGoal(ctx, tx, goal, chatID)
+			if err != nil {
+				return err
+			}
+			reason, tally.PenaltyMode = PenaltyReason(mode), mode
+		}
+		tally.Goal, tally.Status = *goal, goal.Status
+		return nil
+	})
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if reason != "" {
+		recordResolved(&tally.Goal, reason)
 	}
 
-	if goal.Status != "done_pending" {
-		return fmt.Errorf("голосование доступно только для целей в статусе 'done_pending'")
+	return tally, nil
+}
+
+// VotingResult describes a vote that was resolved automatically
+type VotingResult struct {
+	Goal      models.Goal
+	Succeeded bool
+	Yes       int
+	No        int
+	Abstained int
+
+	PenaltyMode string // Strategy that moved the bet if the goal failed
+}
+
+// ResolveExpiredVotes decides every goal whose voting window ended before now
+// according to the configured resolution rule
+func (s *Service) ResolveExpiredVotes(ctx context.Context, now time.Time) ([]VotingResult, error) {
+	goals, err := s.repo.GetGoalsWithExpiredVoting(ctx, now)
+	if err != nil {
+		return nil, err
 	}
 
-	// User can't vote for their own goal
-	if goal.UserID == voterID {
-		return fmt.Errorf("вы не можете голосовать за свою собственную цель")
+	var results []VotingResult
+	for _, expired := range goals {
+		// Stop on shutdown; the rest are picked up by the next run
+		if ctx.Err() != nil {
+			break
+		}
+
+		var result VotingResult
+
+		err := s.repo.WithTx(ctx, func(tx repository.Store) error {
+			goal, err := tx.GetGoalForUpdate(ctx, expired.ID)
+			if err != nil {
+				return err
+			}
+			if goal.Status != "done_pending" {
+				return ErrGoalResolved
+			}
+
+			yesCount, noCount, err := tx.CountVotes(ctx, goal.ID)
+			if err != nil {
+				return err
+			}
+
+			result = VotingResult{
+				Goal:      *goal,
+				Yes:       yesCount,
+				No:        noCount,
+				Abstained: goal.ChatMembersCount - yesCount - noCount,
+			}
+
+			switch s.config.VotingResolution {
+			case ResolveCastMajority:
+				result.Succeeded = yesCount >= noCount
+			default:
+				result.Succeeded = yesCount+result.Abstained >= goal.RequiredVotes
+			}
+
+			if result.Succeeded {
+				result.Goal.Status = "success"
+				return s.completeGoal(ctx, tx, goal)
+			}
+			result.Goal.Status = "failed"
+			result.PenaltyMode, err = s.failGoal(ctx, tx, goal, goal.ChatID)
+			return err
+		})
+		if errors.Is(err, ErrGoalResolved) {
+			continue
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "Error resolving expired vote", logging.GoalID, expired.ID, "error", err)
+			continue
+		}
+
+		reason := "escrow_release"
+		if !result.Succeeded {
+			reason = PenaltyReason(result.PenaltyMode)
+		}
+		recordResolved(&result.Goal, reason)
+		results = append(results, result)
 	}
 
-	return s.repo.CreateVote(goalID, voterID, vote)
+	return results, nil
 }
 
-// FinalizeGoal finalizes a goal based on votes
-func (s *Service) FinalizeGoal(goalID int, chatID int64) (string, error) {
-	goal, err := s.repo.GetGoal(goalID)
+// completeGoal marks a goal locked by the caller's transaction as successful
+// and returns the bet to the author
+func (s *Service) completeGoal(ctx context.Context, tx repository.Store, goal *models.Goal) error {
+	if err := claimGoal(ctx, tx, goal, "success", "done_pending"); err != nil {
+		return err
+	}
+	if err := tx.ReleaseStars(ctx, goal.UserID, goal.Bet); err != nil {
+		return err
+	}
+	return tx.CreateTransaction(ctx, models.Transaction{ToUser: &goal.UserID, Amount: goal.Bet, Reason: "escrow_release", GoalID: &goal.ID})
+}
+
+// claimGoal moves a goal from one of the from statuses to status to before
+// any stars move, so a goal is resolved only once even if the scheduler and a
+// vote race each other. A goal in any other status yields ErrGoalResolved.
+// On success goal.Status is updated too.
+func claimGoal(ctx context.Context, tx repository.Store, goal *models.Goal, to string, from ...string) error {
+	claimed, err := tx.TransitionGoalStatus(ctx, goal.ID, to, from...)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return ErrGoalResolved
+	}
+	goal.Status = to
+	return nil
+}
+
+// FailGoal handles goal failure and distributes the penalty according to
+// the chat's penalty mode, which it returns
+func (s *Service) FailGoal(ctx context.Context, goalID int, chatID int64) (string, error) {
+	var goal *models.Goal
+	var mode string
+
+	err := s.repo.WithTx(ctx, func(tx repository.Store) error {
+		var err error
+		goal, err = tx.GetGoalForUpdate(ctx, goalID)
+		if err != nil {
+			return err
+		}
+		mode, err = s.failGoal(ctx, tx, goal, chatID)
+		return err
+	})
 	if err != nil {
 		return "", err
 	}
 
-	if goal.Status != "done_pending" {
-		return "", fmt.Errorf("цель должна быть в статусе 'done_pending'")
+	recordResolved(goal, PenaltyReason(mode))
+	return mode, nil
+}
+
+// recordResolved updates metrics for a goal whose resolving transaction
+// committed. The whole bet moves under reason, either escrow_release back
+// to the author or a penalty reason.
+func recordResolved(goal *models.Goal, reason string) {
+	outcome := metrics.GoalFailed
+	if reason == "escrow_release" {
+		outcome = metrics.GoalSucceeded
 	}
+	metrics.Goals.WithLabelValues(outcome).Inc()
+	metrics.StarsMoved.WithLabelValues(reason).Add(float64(goal.Bet))
+}
 
-	// Get chat members count (excluding goal creator)
-	members, err := s.repo.GetChatMembers(chatID)
-	if err != nil {
+// failGoal moves the penalty for a goal locked by the caller's transaction
+// with the chat's penalty strategy and returns the strategy's mode
+func (s *Service) failGoal(ctx context.Context, tx repository.Store, goal *models.Goal, chatID int64) (string, error) {
+	if err := claimGoal(ctx, tx, goal, "failed", "active", "done_pending"); err != nil {
 		return "", err
 	}
 
-	// Count votes
-	yesCount, noCount, err := s.repo.CountVotes(goalID)
+	settings, err := s.chatSettings(ctx, tx, chatID)
 	if err != nil {
 		return "", err
 	}
 
-	totalVoters := len(members) - 1        // excluding goal creator
-	requiredVotes := (totalVoters + 1) / 2 // majority
+	// Take the penalty out of the author's escrow
+	if err := tx.SpendLockedStars(ctx, goal.UserID, goal.Bet); err != nil {
+		return "", err
+	}
+
+	return s.distributePenalty(ctx, tx, goal, settings.PenaltyMode)
+}
 
-	var resultMessage string
+// ExpiredGoal is a goal failed because its deadline passed without proof
+type ExpiredGoal struct {
+	models.Goal
+	PenaltyMode string // Strategy that moved the bet
+}
 
-	// Check if majority voted yes
-	if yesCount >= requiredVotes {
-		// Success - goal completed
-		err = s.repo.UpdateGoalStatus(goalID, "success")
-		if err != nil {
-			return "", err
+// CheckExpiredGoals fails every active goal whose deadline is before now and
+// returns the goals that were failed by this call. Goals that were already
+// resolved elsewhere are skipped, so it is safe to run repeatedly.
+func (s *Service) CheckExpiredGoals(ctx context.Context, now time.Time) ([]ExpiredGoal, error) {
+	goals, err := s.repo.GetExpiredActiveGoals(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var failed []ExpiredGoal
+	for _, goal := range goals {
+		// Stop on shutdown; the rest are picked up by the next run
+		if ctx.Err() != nil {
+			break
+		}
+
+		mode, err := s.FailGoal(ctx, goal.ID, goal.ChatID)
+		if errors.Is(err, ErrGoalResolved) {
+			continue
 		}
-		resultMessage = fmt.Sprintf("✅ Цель выполнена! Голосов ЗА: %d, ПРОТИВ: %d", yesCount, noCount)
-	} else if noCount > totalVoters-requiredVotes {
-		// Failed - not enough yes votes
-		err = s.FailGoal(goalID, chatID)
 		if err != nil {
-			return "", err
+			slog.ErrorContext(ctx, "Error failing expired goal", logging.GoalID, goal.ID, "error", err)
+			continue
 		}
-		resultMessage = fmt.Sprintf("❌ Цель провалена! Голосов ЗА: %d, ПРОТИВ: %d. Штраф распределен между участниками.", yesCount, noCount)
-	} else {
-		resultMessage = fmt.Sprintf("⏳ Ожидаем больше голосов. ЗА: %d, ПРОТИВ: %d (требуется: %d)", yesCount, noCount, requiredVotes)
+		goal.Status = "failed"
+		failed = append(failed, ExpiredGoal{Goal: goal, PenaltyMode: mode})
 	}
 
-	return resultMessage, nil
+	return failed, nil
 }
 
-// FailGoal handles goal failure and distributes penalty
-func (s *Service) FailGoal(goalID int, chatID int64) error {
-	goal, err := s.repo.GetGoal(goalID)
-	if err != nil {
-		return err
-	}
+// Reminder is a pending notification about an approaching goal deadline
+type Reminder struct {
+	Goal     models.Goal
+	Author   models.User
+	TimeLeft time.Duration
+}
 
-	// Get all chat members except goal creator
-	members, err := s.repo.GetChatMembers(chatID)
+// DueReminders returns reminders that should be sent now. The reminder
+// offsets of each goal's chat are the durations before a deadline at which
+// the author is reminded; each goal gets at most one reminder per offset, and
+// only the closest offset is used when several have already passed (e.g. for
+// a goal created a day before its deadline). A reminder is marked as sent
+// only after everything needed to send it has loaded; goals that fail to load
+// are logged and retried on the next run.
+func (s *Service) DueReminders(ctx context.Context, now time.Time) ([]Reminder, error) {
+	goals, err := s.repo.GetActiveGoalsDueBefore(ctx, now, now.Add(MaxReminderOffset))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	var recipients []models.User
-	for _, member := range members {
-		if member.ID != goal.UserID {
-			recipients = append(recipients, member)
+	offsetsByChat := make(map[int64][]time.Duration)
+	var reminders []Reminder
+	for _, goal := range goals {
+		// Stop on shutdown; the rest are picked up by the next run
+		if ctx.Err() != nil {
+			break
 		}
-	}
-
-	if len(recipients) == 0 {
-		return fmt.Errorf("нет участников для распределения штрафа")
-	}
 
-	// Deduct penalty from goal creator
-	err = s.repo.UpdateUserBalance(goal.UserID, -goal.Bet)
-	if err != nil {
-		return err
-	}
+		sorted, ok := offsetsByChat[goal.ChatID]
+		if !ok {
+			settings, err := s.ChatSettings(ctx, goal.ChatID)
+			if err != nil {
+				slog.ErrorContext(ctx, "Error loading chat settings for reminder", logging.GoalID, goal.ID, "error", err)
+				continue
+			}
+			sorted = append([]time.Duration(nil), settings.ReminderOffsets...)
+			sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+			offsetsByChat[goal.ChatID] = sorted
+		}
 
-	// Distribute penalty among other members
-	amountPerPerson := goal.Bet / len(recipients)
-	remainder := goal.Bet % len(recipients)
+		left := goal.Deadline.Sub(now)
 
-	for i, recipient := range recipients {
-		amount := amountPerPerson
-		if i < remainder {
-			amount++ // distribute remainder
+		// Pick the smallest offset that the deadline already falls within
+		idx := sort.Search(len(sorted), func(i int) bool { return sorted[i] >= left })
+		if idx == len(sorted) {
+			continue
 		}
 
-		err = s.repo.UpdateUserBalance(recipient.ID, amount)
+		author, err := s.repo.GetUserByID(ctx, int64(goal.UserID))
 		if err != nil {
-			return err
+			slog.ErrorContext(ctx, "Error loading goal author for reminder", logging.GoalID, goal.ID, "error", err)
+			continue
 		}
 
-		// Record transaction
-		err = s.repo.CreateTransaction(goal.UserID, recipient.ID, amount, "penalty_distribution", &goalID)
+		claimed, err := s.repo.MarkReminderSent(ctx, goal.ID, sorted[idx])
 		if err != nil {
-			return err
+			slog.ErrorContext(ctx, "Error marking reminder as sent", logging.GoalID, goal.ID, "error", err)
+			continue
+		}
+		if !claimed {
+			continue
 		}
-	}
 
-	// Update goal status
-	err = s.repo.UpdateGoalStatus(goalID, "failed")
-	if err != nil {
-		return err
+		reminders = append(reminders, Reminder{Goal: goal, Author: *author, TimeLeft: left})
 	}
 
-	return nil
+	return reminders, nil
 }
 
-// CheckExpiredGoals checks for expired goals and fails them
-func (s *Service) CheckExpiredGoals() error {
-	// This would be called by a cron job or ticker
-	// Implementation depends on how you want to handle scheduled tasks
-	return nil
+// UserStats summarizes a user's stars and goals
+type UserStats struct {
+	Balance       int // Available stars
+	LockedBalance int // Stars locked in bets
+	ActiveGoals   int
 }
 
 // GetUserStats returns user statistics
-func (s *Service) GetUserStats(userID int) (string, error) {
-	user, err := s.repo.GetOrCreateUser(int64(userID), "")
+func (s *Service) GetUserStats(ctx context.Context, userID int) (*UserStats, error) {
+	user, err := s.repo.GetUserByID(ctx, int64(userID))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	goals, err := s.repo.GetUserActiveGoals(userID)
+	goals, err := s.repo.GetUserActiveGoals(ctx, userID)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	return &UserStats{Balance: user.Balance, LockedBalance: user.LockedBalance, ActiveGoals: len(goals)}, nil
+}
+
+// HistoryPageSize is the number of transactions shown per /history page
+const HistoryPageSize = 10
+
+// GetUserHistory returns the given zero-based page of the user's transactions
+// and the total number of pages
+func (s *Service) GetUserHistory(ctx context.Context, userID, page int) ([]models.HistoryEntry, int, error) {
+	total, err := s.repo.CountUserTransactions(ctx, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	pages := (total + HistoryPageSize - 1) / HistoryPageSize
+	if page < 0 || (pages > 0 && page >= pages) {
+		return nil, pages, UserErrorf("страница не найдена")
 	}
 
-	stats := fmt.Sprintf("👤 Статистика\n")
-	stats += fmt.Sprintf("⭐ Баланс: %d звезд\n", user.Balance)
-	stats += fmt.Sprintf("📋 Активных целей: %d\n", len(goals))
+	entries, err := s.repo.GetUserTransactions(ctx, userID, HistoryPageSize, page*HistoryPageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return entries, pages, nil
+}
+
+// LeaderboardSize is the number of members shown in /top
+const LeaderboardSize = 10
+
+// GetLeaderboard ranks members of a chat by the given metric
+func (s *Service) GetLeaderboard(ctx context.Context, chatID int64, metric string) ([]models.LeaderboardEntry, error) {
+	return s.repo.GetChatLeaderboard(ctx, chatID, metric, LeaderboardSize)
+}
+
+// GetConversationState returns the user's unfinished dialog in a chat, or nil
+func (s *Service) GetConversationState(ctx context.Context, chatID, userID int64) (*models.ConversationState, error) {
+	return s.repo.GetConversationState(ctx, chatID, userID, time.Now())
+}
+
+// SaveConversationState stores the user's dialog in a chat and extends its expiry
+func (s *Service) SaveConversationState(ctx context.Context, chatID, userID int64, state *models.ConversationState) error {
+	return s.repo.SaveConversationState(ctx, chatID, userID, state, time.Now().Add(s.config.ConversationTTL))
+}
+
+func (s *Service) DeleteConversationState(ctx context.Context, chatID, userID int64) error {
+	return s.repo.DeleteConversationState(ctx, chatID, userID)
+}
 
-	return stats, nil
+// PurgeExpiredConversations removes dialogs that expired before now
+func (s *Service) PurgeExpiredConversations(ctx context.Context, now time.Time) error {
+	return s.repo.DeleteExpiredConversationStates(ctx, now)
 }
 
 // Public methods to access repository
-func (s *Service) GetUserActiveGoals(userID int) ([]models.Goal, error) {
-	return s.repo.GetUserActiveGoals(userID)
+func (s *Service) GetUserActiveGoals(ctx context.Context, userID int) ([]models.Goal, error) {
+	return s.repo.GetUserActiveGoals(ctx, userID)
 }
 
-func (s *Service) GetActiveGoalsByChat(chatID int64) ([]models.Goal, error) {
-	return s.repo.GetActiveGoalsByChat(chatID)
+func (s *Service) GetActiveGoalsByChat(ctx context.Context, chatID int64) ([]models.Goal, error) {
+	return s.repo.GetActiveGoalsByChat(ctx, chatID)
 }
 
-func (s *Service) GetGoal(goalID int) (*models.Goal, error) {
-	return s.repo.GetGoal(goalID)
+func (s *Service) GetGoal(ctx context.Context, goalID int) (*models.Goal, error) {
+	return s.repo.GetGoal(ctx, goalID)
 }
 
-func (s *Service) GetOrCreateUser(tgID int64, username string) (*models.User, error) {
-	return s.repo.GetOrCreateUser(tgID, username)
+func (s *Service) GetOrCreateUser(ctx context.Context, tgID int64, username string) (*models.User, error) {
+	return s.repo.GetOrCreateUser(ctx, tgID, username)
 }
 
-func (s *Service) GetUserByID(userID int64) (*models.User, error) {
-	return s.repo.GetUserByID(userID)
+func (s *Service) GetUserByID(ctx context.Context, userID int64) (*models.User, error) {
+	return s.repo.GetUserByID(ctx, userID)
 }
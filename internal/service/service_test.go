@@ -0,0 +1,298 @@
+package service
+
+import (
+	"awesomeProject/internal/models"
+	"awesomeProject/internal/repository"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+const testChatID int64 = -1001
+
+// newTestService returns a Service on a fresh MemoryRepository where every
+// user starts with 100 stars
+func newTestService(t *testing.T) (*Service, repository.Store) {
+	t.Helper()
+
+	store := repository.NewMemoryRepository(repository.Config{StartingBalance: 100})
+	return NewService(store, Config{
+		MinBet:           1,
+		ApprovalPercent:  50,
+		VotingWindow:     48 * time.Hour,
+		VotingResolution: ResolveAbstainYes,
+		PenaltyMode:      models.PenaltyMembers,
+		Language:         models.LanguageRussian,
+		ChangeFee:        10,
+		ChangeWindow:     50,
+		ConversationTTL:  24 * time.Hour,
+	}), store
+}
+
+// register adds a member with Telegram ID tgID to the test chat
+func register(t *testing.T, s *Service, tgID int64) *models.User {
+	t.Helper()
+
+	user, err := s.RegisterUser(context.Background(), tgID, "user", testChatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// expectBalance checks a user's available and locked stars
+func expectBalance(t *testing.T, store repository.Store, user *models.User, balance, locked int) {
+	t.Helper()
+
+	fresh, err := store.GetUserByID(context.Background(), int64(user.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fresh.Balance != balance || fresh.LockedBalance != locked {
+		t.Errorf("user %d: expected %d available and %d locked stars, got %d and %d",
+			user.ID, balance, locked, fresh.Balance, fresh.LockedBalance)
+	}
+}
+
+// goalOnVote creates a goal of author with bet and submits proof for it
+func goalOnVote(t *testing.T, s *Service, author *models.User, bet int) *models.Goal {
+	t.Helper()
+
+	ctx := context.Background()
+	goal, err := s.CreateGoal(ctx, author.ID, testChatID, "Run", "10 km", time.Now().Add(7*24*time.Hour), bet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SubmitProof(ctx, goal.ID, author.ID, testChatID, models.Proof{Kind: models.ProofText, Caption: "Done"}); err != nil {
+		t.Fatal(err)
+	}
+	return goal
+}
+
+func TestCreateGoalLocksBetInEscrow(t *testing.T) {
+	s, store := newTestService(t)
+	author := register(t, s, 1)
+
+	if _, err := s.CreateGoal(context.Background(), author.ID, testChatID, "Run", "10 km", time.Now().Add(time.Hour), 30); err != nil {
+		t.Fatal(err)
+	}
+	expectBalance(t, store, author, 70, 30)
+
+	// A bet above the available balance is rejected without touching it
+	if _, err := s.CreateGoal(context.Background(), author.ID, testChatID, "Swim", "1 km", time.Now().Add(time.Hour), 71); err == nil {
+		t.Fatal("expected a bet above the available balance to be rejected")
+	}
+	expectBalance(t, store, author, 70, 30)
+}
+
+func TestApprovedGoalReleasesEscrow(t *testing.T) {
+	s, store := newTestService(t)
+	author := register(t, s, 1)
+	voter := register(t, s, 2)
+
+	goal := goalOnVote(t, s, author, 30)
+	if err := s.VoteOnGoal(context.Background(), goal.ID, voter.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.FinalizeGoal(context.Background(), goal.ID, testChatID); err != nil {
+		t.Fatal(err)
+	}
+
+	expectBalance(t, store, author, 100, 0)
+	expectBalance(t, store, voter, 100, 0)
+
+	// Finalizing again must not release the bet twice
+	if _, err := s.FinalizeGoal(context.Background(), goal.ID, testChatID); !errors.Is(err, ErrGoalResolved) {
+		t.Fatalf("expected ErrGoalResolved, got %v", err)
+	}
+	expectBalance(t, store, author, 100, 0)
+}
+
+func TestRejectedGoalSpendsEscrow(t *testing.T) {
+	s, store := newTestService(t)
+	author := register(t, s, 1)
+	voter := register(t, s, 2)
+
+	goal := goalOnVote(t, s, author, 30)
+	if err := s.VoteOnGoal(context.Background(), goal.ID, voter.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.FinalizeGoal(context.Background(), goal.ID, testChatID); err != nil {
+		t.Fatal(err)
+	}
+
+	expectBalance(t, store, author, 70, 0)
+	expectBalance(t, store, voter, 130, 0)
+}
+
+func TestAuthorCannotVoteOnOwnGoal(t *testing.T) {
+	s, _ := newTestService(t)
+	author := register(t, s, 1)
+	register(t, s, 2)
+
+	goal := goalOnVote(t, s, author, 30)
+	if err := s.VoteOnGoal(context.Background(), goal.ID, author.ID, true); err == nil {
+		t.Fatal("expected the author's vote to be rejected")
+	}
+
+	yes, no, err := s.repo.CountVotes(context.Background(), goal.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if yes != 0 || no != 0 {
+		t.Errorf("expected no votes, got %d yes and %d no", yes, no)
+	}
+}
+
+func TestVoterHasOneVote(t *testing.T) {
+	s, _ := newTestService(t)
+	author := register(t, s, 1)
+	voter := register(t, s, 2)
+	register(t, s, 3)
+	register(t, s, 4)
+
+	// A second vote replaces the first instead of counting twice
+	goal := goalOnVote(t, s, author, 30)
+	for _, vote := range []bool{true, true, false} {
+		if err := s.VoteOnGoal(context.Background(), goal.ID, voter.ID, vote); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	yes, no, err := s.repo.CountVotes(context.Background(), goal.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if yes != 0 || no != 1 {
+		t.Errorf("expected 0 yes and 1 no, got %d and %d", yes, no)
+	}
+}
+
+func TestVoteOnResolvedGoalIsRejected(t *testing.T) {
+	s, _ := newTestService(t)
+	author := register(t, s, 1)
+	voter := register(t, s, 2)
+	late := register(t, s, 3)
+
+	goal := goalOnVote(t, s, author, 30)
+	if err := s.VoteOnGoal(context.Background(), goal.ID, voter.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.FinalizeGoal(context.Background(), goal.ID, testChatID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.VoteOnGoal(context.Background(), goal.ID, late.ID, false); !errors.Is(err, ErrGoalResolved) {
+		t.Fatalf("expected ErrGoalResolved, got %v", err)
+	}
+	yes, no, err := s.repo.CountVotes(context.Background(), goal.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if yes != 1 || no != 0 {
+		t.Errorf("expected the late vote not to be stored, got %d yes and %d no", yes, no)
+	}
+}
+
+func TestSubmitProofOnlyByAuthor(t *testing.T) {
+	s, _ := newTestService(t)
+	author := register(t, s, 1)
+	other := register(t, s, 2)
+
+	goal, err := s.CreateGoal(context.Background(), author.ID, testChatID, "Run", "10 km", time.Now().Add(time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proof := models.Proof{Kind: models.ProofText, Caption: "Done"}
+	if err := s.SubmitProof(context.Background(), goal.ID, other.ID, testChatID, proof); err == nil {
+		t.Error("expected proof from another member to be rejected")
+	}
+	if err := s.SubmitProof(context.Background(), goal.ID, author.ID, testChatID-1, proof); err == nil {
+		t.Error("expected proof from another chat to be rejected")
+	}
+}
+
+func TestCharityPenaltyNeedsAnotherExistingAccount(t *testing.T) {
+	const charityTgID = 99
+
+	s, store := newTestService(t)
+	s.penalties = penaltyStrategies(Config{CharityAccount: charityTgID})
+	ctx := context.Background()
+	author := register(t, s, 1)
+
+	// Without the account the bet goes to the treasury instead of failing
+	// the goal over and over
+	goal, err := s.CreateGoal(ctx, author.ID, testChatID, "Run", "10 km", time.Now().Add(time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mode, err := distributePenaltyInTx(t, s, goal, models.PenaltyCharity)
+	if err != nil || mode != models.PenaltyTreasury {
+		t.Fatalf("expected the treasury to take the bet, got %q, %v", mode, err)
+	}
+	if _, err := store.GetUserByTgID(ctx, charityTgID); err == nil {
+		t.Error("expected the charity account not to be created")
+	}
+
+	// The account's owner failing a goal must not pay themselves
+	charity := register(t, s, charityTgID)
+	own, err := s.CreateGoal(ctx, charity.ID, testChatID, "Swim", "1 km", time.Now().Add(time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode, err := distributePenaltyInTx(t, s, own, models.PenaltyCharity); err != nil || mode != models.PenaltyTreasury {
+		t.Fatalf("expected the treasury to take the owner's bet, got %q, %v", mode, err)
+	}
+
+	// Once the account exists it receives exactly the bet
+	if mode, err := distributePenaltyInTx(t, s, goal, models.PenaltyCharity); err != nil || mode != models.PenaltyCharity {
+		t.Fatalf("expected the charity to take the bet, got %q, %v", mode, err)
+	}
+	expectBalance(t, store, charity, 100, 10)
+}
+
+// distributePenaltyInTx runs distributePenalty for goal in its own transaction
+func distributePenaltyInTx(t *testing.T, s *Service, goal *models.Goal, mode string) (string, error) {
+	t.Helper()
+
+	var moved string
+	err := s.repo.WithTx(context.Background(), func(tx repository.Store) error {
+		var err error
+		moved, err = s.distributePenalty(context.Background(), tx, goal, mode)
+		return err
+	})
+	return moved, err
+}
+
+func TestExtendingDeadlineKeepsChangeWindow(t *testing.T) {
+	s, store := newTestService(t)
+	ctx := context.Background()
+	author := register(t, s, 1)
+	register(t, s, 2)
+
+	goal, err := s.CreateGoal(ctx, author.ID, testChatID, "Run", "10 km", time.Now().Add(10*time.Hour), 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := goal.CreatedAt.Add(5 * time.Hour)
+
+	// Each extension costs 10% of the bet, and the window stays half of the
+	// time to the original deadline however far the deadline moves
+	for _, deadline := range []time.Time{time.Now().Add(1000 * time.Hour), time.Now().Add(2000 * time.Hour)} {
+		result, err := s.ExtendDeadline(ctx, goal.ID, author.ID, deadline)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		terms, err := s.GoalChangeTerms(ctx, &result.Goal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := terms.Until.Sub(want); d < -time.Second || d > time.Second {
+			t.Errorf("expected changes to be allowed until %s, got %s", want, terms.Until)
+		}
+	}
+	expectBalance(t, store, author, 64, 30)
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"awesomeProject/internal/models"
+	"awesomeProject/internal/repository"
+	"context"
+	"time"
+)
+
+// MaxReminderOffset is the earliest a chat may ask to be reminded before a
+// deadline
+const MaxReminderOffset = 7 * 24 * time.Hour
+
+// DefaultChatSettings returns the settings of a chat whose admins have not
+// changed them
+func (s *Service) DefaultChatSettings(chatID int64) models.ChatSettings {
+	return models.ChatSettings{
+		ChatID:          chatID,
+		MinBet:          s.config.MinBet,
+		MaxBet:          s.config.MaxBet,
+		VotingWindow:    s.config.VotingWindow,
+		ApprovalPercent: s.config.ApprovalPercent,
+		PenaltyMode:     s.config.PenaltyMode,
+		ReminderOffsets: append([]time.Duration(nil), s.config.ReminderOffsets...),
+		Language:        s.config.Language,
+		ChangeFee:       s.config.ChangeFee,
+		ChangeWindow:    s.config.ChangeWindow,
+	}
+}
+
+// ChatSettings returns the rules a chat plays by
+func (s *Service) ChatSettings(ctx context.Context, chatID int64) (models.ChatSettings, error) {
+	return s.chatSettings(ctx, s.repo, chatID)
+}
+
+// chatSettings reads a chat's settings through store, which may be a transaction
+func (s *Service) chatSettings(ctx context.Context, store repository.Store, chatID int64) (models.ChatSettings, error) {
+	settings, err := store.GetChatSettings(ctx, chatID)
+	if err != nil {
+		return models.ChatSettings{}, err
+	}
+	if settings == nil {
+		return s.DefaultChatSettings(chatID), nil
+	}
+	return *settings, nil
+}
+
+// UpdateChatSettings validates and saves a chat's settings. Goals already in
+// voting keep the window and quorum they started with.
+func (s *Service) UpdateChatSettings(ctx context.Context, settings models.ChatSettings) error {
+	if err := s.ValidateChatSettings(settings); err != nil {
+		return err
+	}
+	return s.repo.SaveChatSettings(ctx, settings)
+}
+
+// ValidateChatSettings reports the first setting out of range
+func (s *Service) ValidateChatSettings(settings models.ChatSettings) error {
+	if settings.MinBet < 1 {
+		return UserErrorf("минимальная ставка должна быть не меньше 1 звезды")
+	}
+	if settings.MaxBet != 0 && settings.MaxBet < settings.MinBet {
+		return UserErrorf("максимальная ставка (%d) меньше минимальной (%d)", settings.MaxBet, settings.MinBet)
+	}
+	if settings.VotingWindow < 0 {
+		return UserErrorf("срок голосования не может быть отрицательным")
+	}
+	if settings.ApprovalPercent < 1 || settings.ApprovalPercent > 100 {
+		return UserErrorf("кворум должен быть от 1 до 100%%")
+	}
+	if !contains(s.PenaltyModes(), settings.PenaltyMode) {
+		return UserErrorf("недоступный режим распределения штрафа: %s", settings.PenaltyMode)
+	}
+	for _, offset := range settings.ReminderOffsets {
+		if offset <= 0 || offset > MaxReminderOffset {
+			return UserErrorf("напоминание можно отправить не раньше чем за 7 дней до срока")
+		}
+	}
+	if settings.ChangeFee < 0 || settings.ChangeFee > 100 {
+		return UserErrorf("комиссия за изменение цели должна быть от 0 до 100%%")
+	}
+	if settings.ChangeWindow < 0 || settings.ChangeWindow > 100 {
+		return UserErrorf("срок для изменения цели должен быть от 0 до 100%%")
+	}
+	if settings.Language != models.LanguageRussian && settings.Language != models.LanguageEnglish {
+		return UserErrorf("неизвестный язык: %s", settings.Language)
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"awesomeProject/internal/metrics"
+	"awesomeProject/internal/models"
+	"awesomeProject/internal/repository"
+	"context"
+	"sort"
+	"time"
+)
+
+// TreasuryPageSize is the number of transactions shown per /treasury page
+const TreasuryPageSize = 10
+
+// seasonPrizeWeights are the shares of the season prize places, best first.
+// Members with the same number of achieved goals share a place.
+var seasonPrizeWeights = []int{3, 2, 1}
+
+// PayoutReason is the transaction reason of treasury payouts of kind
+func PayoutReason(kind string) string {
+	return "treasury_" + kind
+}
+
+// Payout describes how a chat's treasury is or would be paid out
+type Payout struct {
+	Kind            string        // One of the models.Payout* kinds
+	Total           int           // Stars paid out, the whole treasury
+	SeasonStartedAt *time.Time    // Start of the season for season prizes, nil for the first season
+	Shares          []PayoutShare // Recipients, best season results first
+}
+
+// PayoutShare is one member's part of a payout
+type PayoutShare struct {
+	User      models.User
+	Amount    int
+	Succeeded int // Goals achieved this season, set for season prizes
+}
+
+// GetTreasury returns a chat's treasury. A chat whose treasury never
+// received stars gets an empty one.
+func (s *Service) GetTreasury(ctx context.Context, chatID int64) (*models.Treasury, error) {
+	treasury, err := s.repo.GetTreasury(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	if treasury == nil {
+		treasury = &models.Treasury{ChatID: chatID}
+	}
+	return treasury, nil
+}
+
+// GetTreasuryHistory returns the given zero-based page of a chat's treasury
+// ledger and the total number of pages
+func (s *Service) GetTreasuryHistory(ctx context.Context, chatID int64, page int) ([]models.HistoryEntry, int, error) {
+	total, err := s.repo.CountTreasuryTransactions(ctx, chatID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	pages := (total + TreasuryPageSize - 1) / TreasuryPageSize
+	if page < 0 || (pages > 0 && page >= pages) {
+		return nil, pages, UserErrorf("страница не найдена")
+	}
+
+	entries, err := s.repo.GetTreasuryTransactions(ctx, chatID, TreasuryPageSize, page*TreasuryPageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return entries, pages, nil
+}
+
+// PlanPayout previews paying out a chat's whole treasury without moving stars
+func (s *Service) PlanPayout(ctx context.Context, chatID int64, kind string) (*Payout, error) {
+	treasury, err := s.repo.GetTreasury(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	return planPayout(ctx, s.repo, chatID, treasury, kind)
+}
+
+// PayOutTreasury pays out a chat's whole treasury to its members, recording
+// every share with the treasury as the sender. Paying season prizes starts a
+// new season.
+func (s *Service) PayOutTreasury(ctx context.Context, chatID int64, kind string) (*Payout, error) {
+	var payout *Payout
+	err := s.repo.WithTx(ctx, func(tx repository.Store) error {
+		treasury, err := tx.GetTreasuryForUpdate(ctx, chatID)
+		if err != nil {
+			return err
+		}
+
+		payout, err = planPayout(ctx, tx, chatID, treasury, kind)
+		if err != nil {
+			return err
+		}
+
+		for _, share := range payout.Shares {
+			if err := tx.UpdateUserBalance(ctx, share.User.ID, share.Amount); err != nil {
+				return err
+			}
+
+			err := tx.CreateTransaction(ctx, models.Transaction{
+				ToUser:         &share.User.ID,
+				Amount:         share.Amount,
+				Reason:         PayoutReason(kind),
+				TreasuryChatID: &chatID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := tx.AddTreasuryBalance(ctx, chatID, -payout.Total); err != nil {
+			return err
+		}
+		if kind == models.PayoutSeason {
+			return tx.StartTreasurySeason(ctx, chatID, time.Now())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	metrics.StarsMoved.WithLabelValues(PayoutReason(kind)).Add(float64(payout.Total))
+	return payout, nil
+}
+
+// planPayout splits a treasury read through store, which may be a
+// transaction, among the recipients of kind
+func planPayout(ctx context.Context, store repository.Store, chatID int64, treasury *models.Treasury, kind string) (*Payout, error) {
+	if treasury == nil || treasury.Balance == 0 {
+		return nil, UserErrorf("казна беседы пуста")
+	}
+
+	members, err := store.GetChatMembers(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	payout := &Payout{Kind: kind, Total: treasury.Balance}
+	var weights []int
+	switch kind {
+	case models.PayoutEqual:
+		if len(members) == 0 {
+			return nil, UserErrorf("в беседе нет участников")
+		}
+		for _, member := range members {
+			payout.Shares = append(payout.Shares, PayoutShare{User: member})
+		}
+		weights = equalWeights(len(members))
+
+	case models.PayoutSeason:
+		payout.SeasonStartedAt = treasury.SeasonStartedAt
+		var since time.Time
+		if treasury.SeasonStartedAt != nil {
+			since = *treasury.SeasonStartedAt
+		}
+
+		succeeded, err := store.CountSucceededGoals(ctx, chatID, since)
+		if err != nil {
+			return nil, err
+		}
+		payout.Shares, weights = seasonWinners(members, succeeded)
+		if len(payout.Shares) == 0 {
+			return nil, UserErrorf("в этом сезоне еще никто не выполнил ни одной цели")
+		}
+
+	default:
+		return nil, UserErrorf("неизвестный вид выплаты: %s", kind)
+	}
+
+	// Rotate tie-breaking with every ledger entry so leftover stars do not
+	// always go to the same member
+	entries, err := store.CountTreasuryTransactions(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	amounts := splitByWeight(treasury.Balance, weights, entries%len(weights))
+	shares := payout.Shares[:0]
+	for i, share := range payout.Shares {
+		if amounts[i] > 0 {
+			share.Amount = amounts[i]
+			shares = append(shares, share)
+		}
+	}
+	payout.Shares = shares
+	return payout, nil
+}
+
+// seasonWinners returns the members who take the season prize places with
+// the weights of their places, best first
+func seasonWinners(members []models.User, succeeded map[int]int) ([]PayoutShare, []int) {
+	var scores []int
+	for _, member := range members {
+		if n := succeeded[member.ID]; n > 0 && !containsInt(scores, n) {
+			scores = append(scores, n)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(scores)))
+	if len(scores) > len(seasonPrizeWeights) {
+		scores = scores[:len(seasonPrizeWeights)]
+	}
+
+	var winners []PayoutShare
+	for _, member := range members {
+		if n := succeeded[member.ID]; n > 0 && containsInt(scores, n) {
+			winners = append(winners, PayoutShare{User: member, Succeeded: n})
+		}
+	}
+	sort.SliceStable(winners, func(i, j int) bool { return winners[i].Succeeded > winners[j].Succeeded })
+
+	weights := make([]int, len(winners))
+	for i, winner := range winners {
+		for place, score := range scores {
+			if winner.Succeeded == score {
+				weights[i] = seasonPrizeWeights[place]
+			}
+		}
+	}
+	return winners, weights
+}
+
+func containsInt(list []int, n int) bool {
+	for _, item := range list {
+		if item == n {
+			return true
+		}
+	}
+	return false
+}
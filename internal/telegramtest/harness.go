@@ -0,0 +1,156 @@
+package telegramtest
+
+import (
+	"awesomeProject/internal/handlers"
+	"awesomeProject/internal/repository"
+	"awesomeProject/internal/service"
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strings"
+	"time"
+)
+
+// updateTimeout is how long Harness waits for a pushed update to be handled
+const updateTimeout = 10 * time.Second
+
+// Harness runs the real bot stack (tgbotapi client, BotHandler, Service) on
+// top of a Server and a Store. Every Send* call returns only after the bot
+// has finished handling the update, so scenarios can check results right away.
+type Harness struct {
+	Server  *Server
+	Store   repository.Store
+	Service *service.Service
+	Handler *handlers.BotHandler
+
+	bot       *tgbotapi.BotAPI
+	handled   chan int
+	done      chan struct{}
+	messageID int
+}
+
+func NewHarness(store repository.Store, serviceConfig service.Config, handlerConfig handlers.Config) (*Harness, error) {
+	server := NewServer()
+
+	bot, err := tgbotapi.NewBotAPIWithAPIEndpoint(Token, server.Endpoint())
+	if err != nil {
+		server.Close()
+		return nil, err
+	}
+
+	svc := service.NewService(store, serviceConfig)
+	h := &Harness{
+		Server:  server,
+		Store:   store,
+		Service: svc,
+		Handler: handlers.NewBotHandler(bot, svc, handlerConfig),
+		bot:     bot,
+		handled: make(chan int),
+		done:    make(chan struct{}),
+	}
+
+	u := tgbotapi.NewUpdate(0)
+	u.Timeout = 60
+	updates := bot.GetUpdatesChan(u)
+
+	go func() {
+		defer close(h.done)
+		for update := range updates {
+			h.Handler.HandleUpdate(context.Background(), update)
+			h.handled <- update.UpdateID
+		}
+	}()
+
+	return h, nil
+}
+
+// Close stops polling and shuts the Server down
+func (h *Harness) Close() {
+	h.bot.StopReceivingUpdates()
+	go func() {
+		for range h.handled {
+		}
+	}()
+	<-h.done
+	close(h.handled)
+	h.Server.Close()
+}
+
+// Send delivers an update to the bot and waits until it has been handled
+func (h *Harness) Send(update tgbotapi.Update) error {
+	id := h.Server.PushUpdate(update)
+
+	timeout := time.After(updateTimeout)
+	for {
+		select {
+		case handled := <-h.handled:
+			if handled == id {
+				return nil
+			}
+		case <-timeout:
+			return fmt.Errorf("update %d was not handled within %s", id, updateTimeout)
+		}
+	}
+}
+
+// SendMessage delivers a message from user in chatID. Text starting with "/"
+// is sent as a bot command.
+func (h *Harness) SendMessage(chatID int64, from tgbotapi.User, text string) error {
+	message := h.newMessage(chatID, from)
+	message.Text = text
+
+	if strings.HasPrefix(text, "/") {
+		command, _, _ := strings.Cut(text, " ")
+		message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(command)}}
+	}
+
+	return h.Send(tgbotapi.Update{Message: message})
+}
+
+// SendPhoto delivers a photo with a caption from user in chatID
+func (h *Harness) SendPhoto(chatID int64, from tgbotapi.User, fileID, caption string) error {
+	message := h.newMessage(chatID, from)
+	message.Caption = caption
+	message.Photo = []tgbotapi.PhotoSize{{FileID: fileID, FileUniqueID: fileID, Width: 1280, Height: 720}}
+
+	return h.Send(tgbotapi.Update{Message: message})
+}
+
+// Press delivers a tap by user on an inline button with the given callback
+// data, attached to a bot message in chatID
+func (h *Harness) Press(chatID int64, from tgbotapi.User, data string) error {
+	message := h.newMessage(chatID, BotUser)
+
+	h.messageID++
+	return h.Send(tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:      fmt.Sprintf("callback-%d", h.messageID),
+		From:    &from,
+		Message: message,
+		Data:    data,
+	}})
+}
+
+// LastText returns the last message text or caption sent to chatID, or ""
+func (h *Harness) LastText(chatID int64) string {
+	texts := h.Server.Texts(chatID)
+	if len(texts) == 0 {
+		return ""
+	}
+	return texts[len(texts)-1]
+}
+
+func (h *Harness) newMessage(chatID int64, from tgbotapi.User) *tgbotapi.Message {
+	h.messageID++
+
+	chatType := "group"
+	if chatID == from.ID {
+		chatType = "private"
+	}
+
+	return &tgbotapi.Message{
+		MessageID: h.messageID,
+		From:      &from,
+		Date:      int(time.Now().Unix()),
+		Chat:      &tgbotapi.Chat{ID: chatID, Type: chatType},
+	}
+}
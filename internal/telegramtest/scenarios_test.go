@@ -0,0 +1,811 @@
+package telegramtest
+
+import (
+	"awesomeProject/internal/config"
+	"awesomeProject/internal/handlers"
+	"awesomeProject/internal/migrate"
+	"awesomeProject/internal/models"
+	"awesomeProject/internal/repository"
+	"awesomeProject/internal/service"
+	"awesomeProject/migrations"
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	_ "github.com/lib/pq"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dbConnStr points the scenarios at a throwaway PostgreSQL database instead
+// of the in-memory store
+var dbConnStr = flag.String("db", "", "connection string of a throwaway PostgreSQL database (all data is deleted)")
+
+// TestScenarios runs every scenario against a fake Telegram Bot API server.
+// By default each scenario gets a fresh in-memory store; with -db they run
+// against PostgreSQL, which is migrated up front and wiped between scenarios.
+func TestScenarios(t *testing.T) {
+	// The scenarios' expected balances and vote counts assume the defaults
+	defaults := config.Default()
+	storeConfig := repository.Config{
+		QueryTimeout:    defaults.Database.QueryTimeout,
+		StartingBalance: defaults.Rules.StartingBalance,
+		ChangeFee:       defaults.Rules.ChangeFee,
+		ChangeWindow:    defaults.Rules.ChangeWindow,
+	}
+
+	newStore := func(t *testing.T) repository.Store {
+		return repository.NewMemoryRepository(storeConfig)
+	}
+
+	if *dbConnStr != "" {
+		db, err := sql.Open("postgres", *dbConnStr)
+		if err != nil {
+			t.Fatalf("database connection error: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		migrator, err := migrate.New(db, migrations.FS)
+		if err != nil {
+			t.Fatalf("cannot load migrations: %v", err)
+		}
+		if _, err := migrator.Up(); err != nil {
+			t.Fatalf("migration failed: %v", err)
+		}
+
+		newStore = func(t *testing.T) repository.Store {
+			if err := wipeDatabase(db); err != nil {
+				t.Fatal(err)
+			}
+			return repository.NewRepository(db, storeConfig)
+		}
+	}
+
+	serviceConfig := service.Config{
+		MinBet:           defaults.Rules.MinBet,
+		MaxBet:           defaults.Rules.MaxBet,
+		ApprovalPercent:  defaults.Rules.ApprovalPercent,
+		VotingWindow:     defaults.Rules.VotingWindow,
+		VotingResolution: defaults.Rules.VotingResolution,
+		PenaltyMode:      defaults.Rules.PenaltyMode,
+		ReminderOffsets:  defaults.Scheduler.ReminderOffsets,
+		Language:         defaults.Rules.Language,
+		ChangeFee:        defaults.Rules.ChangeFee,
+		ChangeWindow:     defaults.Rules.ChangeWindow,
+		CharityAccount:   defaults.Rules.CharityAccount,
+		ConversationTTL:  defaults.Rules.ConversationTTL,
+	}
+	handlerConfig := handlers.Config{StartingBalance: defaults.Rules.StartingBalance}
+
+	for _, scenario := range Scenarios {
+		t.Run(scenario.Name, func(t *testing.T) {
+			h, err := NewHarness(newStore(t), serviceConfig, handlerConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer h.Close()
+
+			if err := scenario.Run(h); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func wipeDatabase(db *sql.DB) error {
+	_, err := db.Exec(`
+		TRUNCATE users, goals, votes, transactions, chat_members, goal_reminders,
+			goal_proofs, goal_voters, goal_changes, conversation_states,
+			chat_settings, chat_treasuries
+		RESTART IDENTITY CASCADE
+	`)
+	return err
+}
+
+// Scenario is a scripted conversation with the bot. Run returns an error
+// describing the first expectation that did not hold.
+type Scenario struct {
+	Name string
+	Run  func(h *Harness) error
+}
+
+// Participants of the scripted group chat
+var (
+	GroupChatID int64 = -1001
+
+	Alice = tgbotapi.User{ID: 1001, FirstName: "Alice", UserName: "alice"}
+	Bob   = tgbotapi.User{ID: 1002, FirstName: "Bob", UserName: "bob"}
+	Carol = tgbotapi.User{ID: 1003, FirstName: "Carol", UserName: "carol"}
+	Dave  = tgbotapi.User{ID: 1004, FirstName: "Dave", UserName: "dave"}
+)
+
+// Scenarios covers the main goal lifecycle: creation, proof, voting,
+// finalization and penalty distribution
+var Scenarios = []Scenario{
+	{Name: "goal approved by vote", Run: goalApprovedByVote},
+	{Name: "goal rejected by vote", Run: goalRejectedByVote},
+	{Name: "late member cannot vote", Run: lateMemberCannotVote},
+	{Name: "deadline missed", Run: deadlineMissed},
+	{Name: "admin limits bets", Run: adminLimitsBets},
+	{Name: "penalty shared among voters", Run: penaltySharedAmongVoters},
+	{Name: "penalty weighted by votes", Run: penaltyWeightedByVotes},
+	{Name: "penalty sent to treasury", Run: penaltySentToTreasury},
+	{Name: "treasury paid out as season prizes", Run: treasuryPaidAsSeasonPrizes},
+	{Name: "goal edited and cancelled", Run: goalEditedAndCancelled},
+	{Name: "solo author's stars kept in treasury", Run: soloAuthorStarsKeptInTreasury},
+}
+
+func goalApprovedByVote(h *Harness) error {
+	if err := joinChat(h, Bob, Carol); err != nil {
+		return err
+	}
+
+	goal, err := createGoal(h, Alice, 30)
+	if err != nil {
+		return err
+	}
+	if err := expectBalance(h, Alice, 70, 30); err != nil {
+		return err
+	}
+
+	// Only the author may submit proof, and only in the goal's chat
+	if err := h.Press(GroupChatID, Bob, fmt.Sprintf("proof_%d", goal.ID)); err != nil {
+		return err
+	}
+	if err := expectLastCallbackAnswer(h, "только автор цели"); err != nil {
+		return err
+	}
+	if err := h.Press(Alice.ID, Alice, fmt.Sprintf("proof_%d", goal.ID)); err != nil {
+		return err
+	}
+	if err := expectLastCallbackAnswer(h, "другой беседе"); err != nil {
+		return err
+	}
+
+	// Media proofs are re-posted with the voting buttons in the caption
+	if err := h.Press(GroupChatID, Alice, fmt.Sprintf("proof_%d", goal.ID)); err != nil {
+		return err
+	}
+	if err := h.SendPhoto(GroupChatID, Alice, "photo-finish", "Финиш"); err != nil {
+		return err
+	}
+	if err := expectLastText(h, GroupChatID, "Голосуйте за выполнение"); err != nil {
+		return err
+	}
+	if err := expectGoal(h, goal.ID, "done_pending", 2, 1); err != nil {
+		return err
+	}
+
+	if err := h.Press(GroupChatID, Bob, fmt.Sprintf("vote_yes_%d", goal.ID)); err != nil {
+		return err
+	}
+	if err := expectLastText(h, GroupChatID, "Цель выполнена"); err != nil {
+		return err
+	}
+	if err := expectGoal(h, goal.ID, "success", 2, 1); err != nil {
+		return err
+	}
+
+	// A vote on a decided goal is turned away
+	if err := h.Press(GroupChatID, Carol, fmt.Sprintf("vote_no_%d", goal.ID)); err != nil {
+		return err
+	}
+	if err := expectLastCallbackAnswer(h, "цель уже завершена"); err != nil {
+		return err
+	}
+	return expectBalance(h, Alice, 100, 0)
+}
+
+func goalRejectedByVote(h *Harness) error {
+	if err := joinChat(h, Bob, Carol, Dave); err != nil {
+		return err
+	}
+
+	goal, err := createGoal(h, Alice, 30)
+	if err != nil {
+		return err
+	}
+	if err := submitTextProof(h, Alice, goal, "Сделал, честно"); err != nil {
+		return err
+	}
+
+	if err := h.Press(GroupChatID, Bob, fmt.Sprintf("vote_no_%d", goal.ID)); err != nil {
+		return err
+	}
+	if err := expectLastText(h, GroupChatID, "Ожидаем больше голосов"); err != nil {
+		return err
+	}
+
+	if err := h.Press(GroupChatID, Carol, fmt.Sprintf("vote_no_%d", goal.ID)); err != nil {
+		return err
+	}
+	if err := expectLastText(h, GroupChatID, "Цель провалена"); err != nil {
+		return err
+	}
+	if err := expectGoal(h, goal.ID, "failed", 3, 2); err != nil {
+		return err
+	}
+
+	if err := expectBalance(h, Alice, 70, 0); err != nil {
+		return err
+	}
+	for _, member := range []tgbotapi.User{Bob, Carol, Dave} {
+		if err := expectBalance(h, member, 110, 0); err != nil {
+			return err
+		}
+	}
+
+	// The bet leaves the author's history once, as the penalty shares
+	if err := h.SendMessage(GroupChatID, Alice, "/history"); err != nil {
+		return err
+	}
+	history := h.LastText(GroupChatID)
+	if strings.Count(history, "➖ 10 ⭐") != 3 || !strings.Contains(history, "🔒 30 ⭐") || strings.Contains(history, "➖ 30") {
+		return fmt.Errorf("expected the history of @%s to lock 30 stars and pay out 3 shares of 10, got %q", Alice.UserName, history)
+	}
+	return nil
+}
+
+func lateMemberCannotVote(h *Harness) error {
+	if err := joinChat(h, Bob); err != nil {
+		return err
+	}
+
+	goal, err := createGoal(h, Alice, 20)
+	if err != nil {
+		return err
+	}
+	if err := submitTextProof(h, Alice, goal, "Готово"); err != nil {
+		return err
+	}
+
+	// Dave joins after voting opened, so his vote is rejected
+	if err := joinChat(h, Dave); err != nil {
+		return err
+	}
+	if err := h.Press(GroupChatID, Dave, fmt.Sprintf("vote_no_%d", goal.ID)); err != nil {
+		return err
+	}
+	if err := expectLastCallbackAnswer(h, "голосовать могут только"); err != nil {
+		return err
+	}
+	if err := expectGoal(h, goal.ID, "done_pending", 1, 1); err != nil {
+		return err
+	}
+
+	if err := h.Press(GroupChatID, Bob, fmt.Sprintf("vote_yes_%d", goal.ID)); err != nil {
+		return err
+	}
+	return expectGoal(h, goal.ID, "success", 1, 1)
+}
+
+func deadlineMissed(h *Harness) error {
+	if err := joinChat(h, Bob, Carol); err != nil {
+		return err
+	}
+
+	goal, err := createGoal(h, Alice, 30)
+	if err != nil {
+		return err
+	}
+
+	failed, err := h.Service.CheckExpiredGoals(context.Background(), goal.Deadline.Add(time.Minute))
+	if err != nil {
+		return err
+	}
+	if len(failed) != 1 || failed[0].ID != goal.ID {
+		return fmt.Errorf("expected goal %d to expire, got %d expired goals", goal.ID, len(failed))
+	}
+
+	// A second run must not charge the author again
+	if failed, err = h.Service.CheckExpiredGoals(context.Background(), goal.Deadline.Add(time.Hour)); err != nil {
+		return err
+	}
+	if len(failed) != 0 {
+		return fmt.Errorf("expected no goals to expire on the second run, got %d", len(failed))
+	}
+
+	if err := expectGoal(h, goal.ID, "failed", 0, 0); err != nil {
+		return err
+	}
+	if err := expectBalance(h, Alice, 70, 0); err != nil {
+		return err
+	}
+	for _, member := range []tgbotapi.User{Bob, Carol} {
+		if err := expectBalance(h, member, 115, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func adminLimitsBets(h *Harness) error {
+	if err := joinChat(h, Bob); err != nil {
+		return err
+	}
+	h.Server.SetAdmin(GroupChatID, Alice.ID)
+
+	// Regular members can neither open the menu nor press its buttons
+	if err := h.SendMessage(GroupChatID, Bob, "/settings"); err != nil {
+		return err
+	}
+	if err := expectLastText(h, GroupChatID, "только администраторы"); err != nil {
+		return err
+	}
+	if err := h.Press(GroupChatID, Bob, "set_minbet_1"); err != nil {
+		return err
+	}
+	if err := expectLastCallbackAnswer(h, "только администраторы"); err != nil {
+		return err
+	}
+
+	if err := h.SendMessage(GroupChatID, Alice, "/settings"); err != nil {
+		return err
+	}
+	if err := expectLastText(h, GroupChatID, "Настройки беседы"); err != nil {
+		return err
+	}
+	for _, data := range []string{"set_minbet", "set_minbet_50", "set_maxbet_100"} {
+		if err := h.Press(GroupChatID, Alice, data); err != nil {
+			return err
+		}
+	}
+	if err := expectLastCallbackAnswer(h, "Сохранено"); err != nil {
+		return err
+	}
+
+	// Bets outside the limits are asked again without losing the dialog
+	steps := []string{"/newgoal", "Прочитать книгу", "Любую", "7", "30"}
+	for _, text := range steps {
+		if err := h.SendMessage(GroupChatID, Bob, text); err != nil {
+			return err
+		}
+	}
+	if err := expectLastText(h, GroupChatID, "от 50 до 100 звезд"); err != nil {
+		return err
+	}
+	if err := h.SendMessage(GroupChatID, Bob, "50"); err != nil {
+		return err
+	}
+	if err := expectLastText(h, GroupChatID, "Цель создана"); err != nil {
+		return err
+	}
+	return expectBalance(h, Bob, 50, 50)
+}
+
+func penaltySharedAmongVoters(h *Harness) error {
+	if err := joinChat(h, Bob, Carol, Dave); err != nil {
+		return err
+	}
+	h.Server.SetAdmin(GroupChatID, Alice.ID)
+	if err := h.Press(GroupChatID, Alice, "set_penalty_voters"); err != nil {
+		return err
+	}
+
+	goal, err := createGoal(h, Alice, 30)
+	if err != nil {
+		return err
+	}
+	if err := submitTextProof(h, Alice, goal, "Готово"); err != nil {
+		return err
+	}
+
+	// Dave may vote but does not, so he gets no share of the penalty
+	for _, voter := range []tgbotapi.User{Bob, Carol} {
+		if err := h.Press(GroupChatID, voter, fmt.Sprintf("vote_no_%d", goal.ID)); err != nil {
+			return err
+		}
+	}
+	if err := expectLastText(h, GroupChatID, "между участниками голосования"); err != nil {
+		return err
+	}
+	if err := expectGoal(h, goal.ID, "failed", 3, 2); err != nil {
+		return err
+	}
+
+	for _, voter := range []tgbotapi.User{Bob, Carol} {
+		if err := expectBalance(h, voter, 115, 0); err != nil {
+			return err
+		}
+	}
+	return expectBalance(h, Dave, 100, 0)
+}
+
+func penaltyWeightedByVotes(h *Harness) error {
+	if err := joinChat(h, Bob, Carol); err != nil {
+		return err
+	}
+	h.Server.SetAdmin(GroupChatID, Alice.ID)
+	if err := h.Press(GroupChatID, Alice, "set_penalty_weighted"); err != nil {
+		return err
+	}
+
+	// Only Bob takes part in judging the first goal
+	first, err := createGoal(h, Alice, 10)
+	if err != nil {
+		return err
+	}
+	if err := submitTextProof(h, Alice, first, "Готово"); err != nil {
+		return err
+	}
+	if err := h.Press(GroupChatID, Bob, fmt.Sprintf("vote_yes_%d", first.ID)); err != nil {
+		return err
+	}
+	if err := expectGoal(h, first.ID, "success", 2, 1); err != nil {
+		return err
+	}
+
+	second, err := createGoal(h, Alice, 30)
+	if err != nil {
+		return err
+	}
+	if _, err := h.Service.CheckExpiredGoals(context.Background(), second.Deadline.Add(time.Minute)); err != nil {
+		return err
+	}
+
+	if err := expectBalance(h, Alice, 70, 0); err != nil {
+		return err
+	}
+	if err := expectBalance(h, Bob, 130, 0); err != nil {
+		return err
+	}
+	return expectBalance(h, Carol, 100, 0)
+}
+
+func penaltySentToTreasury(h *Harness) error {
+	if err := joinChat(h, Bob); err != nil {
+		return err
+	}
+	h.Server.SetAdmin(GroupChatID, Alice.ID)
+	if err := h.Press(GroupChatID, Alice, "set_penalty_treasury"); err != nil {
+		return err
+	}
+
+	goal, err := createGoal(h, Alice, 30)
+	if err != nil {
+		return err
+	}
+	if _, err := h.Service.CheckExpiredGoals(context.Background(), goal.Deadline.Add(time.Minute)); err != nil {
+		return err
+	}
+
+	if err := expectBalance(h, Alice, 70, 0); err != nil {
+		return err
+	}
+	if err := expectBalance(h, Bob, 100, 0); err != nil {
+		return err
+	}
+
+	author, err := h.Store.GetOrCreateUser(context.Background(), Alice.ID, Alice.UserName)
+	if err != nil {
+		return err
+	}
+	history, err := h.Store.GetUserTransactions(context.Background(), author.ID, 1, 0)
+	if err != nil {
+		return err
+	}
+	if len(history) != 1 || history[0].Reason != "penalty_treasury" || history[0].TreasuryChatID == nil || *history[0].TreasuryChatID != GroupChatID {
+		return fmt.Errorf("expected the last transaction of @%s to move the bet to the treasury, got %+v", Alice.UserName, history)
+	}
+	return nil
+}
+
+func treasuryPaidAsSeasonPrizes(h *Harness) error {
+	if err := joinChat(h, Bob, Carol); err != nil {
+		return err
+	}
+	h.Server.SetAdmin(GroupChatID, Alice.ID)
+	if err := h.Press(GroupChatID, Alice, "set_penalty_treasury"); err != nil {
+		return err
+	}
+
+	// Bob is the only one to achieve a goal this season
+	achieved, err := createGoal(h, Bob, 10)
+	if err != nil {
+		return err
+	}
+	if err := submitTextProof(h, Bob, achieved, "Готово"); err != nil {
+		return err
+	}
+	for _, voter := range []tgbotapi.User{Alice, Carol} {
+		if err := h.Press(GroupChatID, voter, fmt.Sprintf("vote_yes_%d", achieved.ID)); err != nil {
+			return err
+		}
+	}
+
+	missed, err := createGoal(h, Alice, 30)
+	if err != nil {
+		return err
+	}
+	if _, err := h.Service.CheckExpiredGoals(context.Background(), missed.Deadline.Add(time.Minute)); err != nil {
+		return err
+	}
+
+	if err := h.SendMessage(GroupChatID, Carol, "/treasury"); err != nil {
+		return err
+	}
+	if err := expectLastText(h, GroupChatID, "Казна беседы: 30 ⭐"); err != nil {
+		return err
+	}
+
+	// Only admins pay out the treasury, after seeing who gets what
+	if err := h.SendMessage(GroupChatID, Carol, "/payout"); err != nil {
+		return err
+	}
+	if err := expectLastText(h, GroupChatID, "только администраторам"); err != nil {
+		return err
+	}
+	if err := h.Press(GroupChatID, Carol, "pay_season_ok"); err != nil {
+		return err
+	}
+	if err := expectLastCallbackAnswer(h, "только администраторам"); err != nil {
+		return err
+	}
+
+	if err := h.SendMessage(GroupChatID, Alice, "/payout"); err != nil {
+		return err
+	}
+	if err := h.Press(GroupChatID, Alice, "pay_season"); err != nil {
+		return err
+	}
+	if err := expectLastText(h, GroupChatID, "@bob — 30 ⭐ (1 цель)"); err != nil {
+		return err
+	}
+	if err := expectBalance(h, Bob, 100, 0); err != nil {
+		return err
+	}
+	if err := h.Press(GroupChatID, Alice, "pay_season_ok"); err != nil {
+		return err
+	}
+	if err := expectLastText(h, GroupChatID, "Казна беседы выплачена"); err != nil {
+		return err
+	}
+	if err := expectBalance(h, Bob, 130, 0); err != nil {
+		return err
+	}
+
+	// The payout empties the treasury and starts a new season
+	if err := h.Press(GroupChatID, Alice, "pay_equal"); err != nil {
+		return err
+	}
+	if err := expectLastCallbackAnswer(h, "казна беседы пуста"); err != nil {
+		return err
+	}
+	if err := h.SendMessage(GroupChatID, Carol, "/treasury"); err != nil {
+		return err
+	}
+	return expectLastText(h, GroupChatID, "Приз победителю сезона")
+}
+
+func goalEditedAndCancelled(h *Harness) error {
+	if err := joinChat(h, Bob); err != nil {
+		return err
+	}
+
+	goal, err := createGoal(h, Alice, 30)
+	if err != nil {
+		return err
+	}
+
+	// Only the author may change a goal
+	if err := h.Press(GroupChatID, Bob, fmt.Sprintf("edit_%d_title", goal.ID)); err != nil {
+		return err
+	}
+	if err := expectLastCallbackAnswer(h, "только ее автор"); err != nil {
+		return err
+	}
+
+	// Titles are edited for free
+	if err := h.Press(GroupChatID, Alice, fmt.Sprintf("edit_%d_title", goal.ID)); err != nil {
+		return err
+	}
+	if err := h.SendMessage(GroupChatID, Alice, "Прочитать две книги"); err != nil {
+		return err
+	}
+	if err := expectLastText(h, GroupChatID, "Стало: Прочитать две книги"); err != nil {
+		return err
+	}
+	if err := expectBalance(h, Alice, 70, 30); err != nil {
+		return err
+	}
+
+	// Extending the deadline costs the default 10% of the bet, shared like a penalty
+	if err := h.Press(GroupChatID, Alice, fmt.Sprintf("edit_%d_deadline", goal.ID)); err != nil {
+		return err
+	}
+	if err := h.SendMessage(GroupChatID, Alice, "14"); err != nil {
+		return err
+	}
+	if err := expectLastText(h, GroupChatID, "Комиссия 3 звезд распределена между участниками"); err != nil {
+		return err
+	}
+	if err := expectBalance(h, Alice, 67, 30); err != nil {
+		return err
+	}
+	if err := expectBalance(h, Bob, 103, 0); err != nil {
+		return err
+	}
+
+	// Cancelling returns the bet minus the fee after confirmation
+	if err := h.Press(GroupChatID, Alice, fmt.Sprintf("cancelgoal_%d", goal.ID)); err != nil {
+		return err
+	}
+	if err := expectLastText(h, GroupChatID, "Вернется: 27 звезд"); err != nil {
+		return err
+	}
+	if err := h.Press(GroupChatID, Alice, fmt.Sprintf("cancelgoal_%d_ok", goal.ID)); err != nil {
+		return err
+	}
+	if err := expectLastText(h, GroupChatID, "отменяет цель"); err != nil {
+		return err
+	}
+	if err := expectBalance(h, Alice, 94, 0); err != nil {
+		return err
+	}
+	if err := expectBalance(h, Bob, 106, 0); err != nil {
+		return err
+	}
+	if err := expectGoal(h, goal.ID, "cancelled", 0, 0); err != nil {
+		return err
+	}
+
+	changes, err := h.Store.GetGoalChanges(context.Background(), goal.ID)
+	if err != nil {
+		return err
+	}
+	var kinds []string
+	for _, change := range changes {
+		kinds = append(kinds, change.Kind)
+	}
+	if strings.Join(kinds, ",") != "title,deadline,cancel" {
+		return fmt.Errorf("expected the audit trail to record title, deadline and cancel, got %v", kinds)
+	}
+
+	// Chats can forbid extensions and cancellations altogether
+	h.Server.SetAdmin(GroupChatID, Alice.ID)
+	if err := h.Press(GroupChatID, Alice, "set_change_0"); err != nil {
+		return err
+	}
+	second, err := createGoal(h, Alice, 10)
+	if err != nil {
+		return err
+	}
+	if err := h.Press(GroupChatID, Alice, fmt.Sprintf("cancelgoal_%d", second.ID)); err != nil {
+		return err
+	}
+	if err := expectLastCallbackAnswer(h, "запрещены в этой беседе"); err != nil {
+		return err
+	}
+	return expectBalance(h, Alice, 84, 10)
+}
+
+func soloAuthorStarsKeptInTreasury(h *Harness) error {
+	// Alice is the only member, so nobody can receive her penalty or fee
+	goal, err := createGoal(h, Alice, 30)
+	if err != nil {
+		return err
+	}
+	failed, err := h.Service.CheckExpiredGoals(context.Background(), goal.Deadline.Add(time.Minute))
+	if err != nil {
+		return err
+	}
+	if len(failed) != 1 || failed[0].PenaltyMode != models.PenaltyTreasury {
+		return fmt.Errorf("expected goal %d to expire with its bet sent to the treasury, got %+v", goal.ID, failed)
+	}
+
+	second, err := createGoal(h, Alice, 30)
+	if err != nil {
+		return err
+	}
+	if err := h.Press(GroupChatID, Alice, fmt.Sprintf("cancelgoal_%d_ok", second.ID)); err != nil {
+		return err
+	}
+	if err := expectLastText(h, GroupChatID, "Комиссия 3 звезд отправлена в казну беседы"); err != nil {
+		return err
+	}
+	if err := expectBalance(h, Alice, 67, 0); err != nil {
+		return err
+	}
+
+	treasury, err := h.Store.GetTreasury(context.Background(), GroupChatID)
+	if err != nil {
+		return err
+	}
+	if treasury == nil || treasury.Balance != 33 {
+		return fmt.Errorf("expected the treasury to hold 33 stars, got %+v", treasury)
+	}
+	return nil
+}
+
+// joinChat registers users as members of the group chat
+func joinChat(h *Harness, users ...tgbotapi.User) error {
+	for _, user := range users {
+		if err := h.SendMessage(GroupChatID, user, "/start"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createGoal walks author through the /newgoal wizard with a deadline a week ahead
+func createGoal(h *Harness, author tgbotapi.User, bet int) (*models.Goal, error) {
+	steps := []string{"/newgoal", "Пробежать 10 км", "Без остановок", "7", fmt.Sprint(bet)}
+	for _, text := range steps {
+		if err := h.SendMessage(GroupChatID, author, text); err != nil {
+			return nil, err
+		}
+	}
+	if err := expectLastText(h, GroupChatID, "Цель создана"); err != nil {
+		return nil, err
+	}
+
+	user, err := h.Store.GetOrCreateUser(context.Background(), author.ID, author.UserName)
+	if err != nil {
+		return nil, err
+	}
+	goals, err := h.Store.GetUserActiveGoals(context.Background(), user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(goals) != 1 {
+		return nil, fmt.Errorf("expected @%s to have 1 active goal, got %d", author.UserName, len(goals))
+	}
+	return &goals[0], nil
+}
+
+func submitTextProof(h *Harness, author tgbotapi.User, goal *models.Goal, text string) error {
+	if err := h.Press(GroupChatID, author, fmt.Sprintf("proof_%d", goal.ID)); err != nil {
+		return err
+	}
+	if err := h.SendMessage(GroupChatID, author, text); err != nil {
+		return err
+	}
+	return expectLastText(h, GroupChatID, text)
+}
+
+func expectLastText(h *Harness, chatID int64, substr string) error {
+	if text := h.LastText(chatID); !strings.Contains(text, substr) {
+		return fmt.Errorf("expected last message in chat %d to contain %q, got %q", chatID, substr, text)
+	}
+	return nil
+}
+
+func expectLastCallbackAnswer(h *Harness, substr string) error {
+	calls := h.Server.Calls()
+	for i := len(calls) - 1; i >= 0; i-- {
+		if calls[i].Method != "answerCallbackQuery" {
+			continue
+		}
+		if text := calls[i].Params.Get("text"); !strings.Contains(text, substr) {
+			return fmt.Errorf("expected last callback answer to contain %q, got %q", substr, text)
+		}
+		return nil
+	}
+	return fmt.Errorf("expected a callback answer containing %q, got none", substr)
+}
+
+func expectBalance(h *Harness, tgUser tgbotapi.User, balance, locked int) error {
+	user, err := h.Store.GetOrCreateUser(context.Background(), tgUser.ID, tgUser.UserName)
+	if err != nil {
+		return err
+	}
+	if user.Balance != balance || user.LockedBalance != locked {
+		return fmt.Errorf("expected @%s to have %d available and %d locked stars, got %d and %d",
+			tgUser.UserName, balance, locked, user.Balance, user.LockedBalance)
+	}
+	return nil
+}
+
+func expectGoal(h *Harness, goalID int, status string, voters, requiredVotes int) error {
+	goal, err := h.Store.GetGoal(context.Background(), goalID)
+	if err != nil {
+		return err
+	}
+	if goal.Status != status || goal.ChatMembersCount != voters || goal.RequiredVotes != requiredVotes {
+		return fmt.Errorf("expected goal %d to be %s with %d voters and %d required votes, got %s with %d and %d",
+			goalID, status, voters, requiredVotes, goal.Status, goal.ChatMembersCount, goal.RequiredVotes)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+// Package telegramtest provides stand-ins for the Telegram Bot API so bot
+// handlers can be exercised without network access.
+package telegramtest
+
+import (
+	"awesomeProject/internal/handlers"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"sync"
+)
+
+// Sender records everything a handler sends instead of calling Telegram. It
+// implements handlers.Sender and is safe for concurrent use.
+type Sender struct {
+	// Err, if set, is returned from every Send and Request after recording
+	Err error
+
+	mu       sync.Mutex
+	sent     []tgbotapi.Chattable
+	requests []tgbotapi.Chattable
+	lastID   int
+}
+
+var _ handlers.Sender = (*Sender)(nil)
+
+func NewSender() *Sender {
+	return &Sender{}
+}
+
+// Send records c and returns a message with a fresh ID in c's chat
+func (s *Sender) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sent = append(s.sent, c)
+	if s.Err != nil {
+		return tgbotapi.Message{}, s.Err
+	}
+
+	s.lastID++
+	return tgbotapi.Message{
+		MessageID: s.lastID,
+		Chat:      &tgbotapi.Chat{ID: ChatID(c)},
+	}, nil
+}
+
+// Request records c and reports success
+func (s *Sender) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, c)
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	return &tgbotapi.APIResponse{Ok: true, Result: []byte("true")}, nil
+}
+
+// Sent returns everything passed to Send, oldest first
+func (s *Sender) Sent() []tgbotapi.Chattable {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]tgbotapi.Chattable(nil), s.sent...)
+}
+
+// Requests returns everything passed to Request, oldest first
+func (s *Sender) Requests() []tgbotapi.Chattable {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]tgbotapi.Chattable(nil), s.requests...)
+}
+
+// Messages returns the text messages passed to Send, oldest first
+func (s *Sender) Messages() []tgbotapi.MessageConfig {
+	var messages []tgbotapi.MessageConfig
+	for _, c := range s.Sent() {
+		if msg, ok := c.(tgbotapi.MessageConfig); ok {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+// Texts returns the text, or caption for media, of everything sent to chatID
+func (s *Sender) Texts(chatID int64) []string {
+	var texts []string
+	for _, c := range s.Sent() {
+		if ChatID(c) != chatID {
+			continue
+		}
+		if text := Text(c); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return texts
+}
+
+// Reset forgets everything recorded so far
+func (s *Sender) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sent, s.requests = nil, nil
+}
+
+// ChatID returns the chat an outgoing message is addressed to, or 0 if c is
+// not a message type the bot sends
+func ChatID(c tgbotapi.Chattable) int64 {
+	switch v := c.(type) {
+	case tgbotapi.MessageConfig:
+		return v.ChatID
+	case tgbotapi.PhotoConfig:
+		return v.ChatID
+	case tgbotapi.VideoConfig:
+		return v.ChatID
+	case tgbotapi.DocumentConfig:
+		return v.ChatID
+	case tgbotapi.VoiceConfig:
+		return v.ChatID
+	case tgbotapi.VideoNoteConfig:
+		return v.ChatID
+	case tgbotapi.EditMessageTextConfig:
+		return v.ChatID
+	case tgbotapi.EditMessageReplyMarkupConfig:
+		return v.ChatID
+	}
+	return 0
+}
+
+// Text returns the text or caption of an outgoing message, or "" if it has none
+func Text(c tgbotapi.Chattable) string {
+	switch v := c.(type) {
+	case tgbotapi.MessageConfig:
+		return v.Text
+	case tgbotapi.PhotoConfig:
+		return v.Caption
+	case tgbotapi.VideoConfig:
+		return v.Caption
+	case tgbotapi.DocumentConfig:
+		return v.Caption
+	case tgbotapi.VoiceConfig:
+		return v.Caption
+	case tgbotapi.EditMessageTextConfig:
+		return v.Text
+	}
+	return ""
+}
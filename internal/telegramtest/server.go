@@ -0,0 +1,289 @@
+package telegramtest
+
+import (
+	"encoding/json"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Token is the bot token the Server accepts
+const Token = "123456:TEST"
+
+// BotUser is the account the Server reports from getMe
+var BotUser = tgbotapi.User{ID: 123456, IsBot: true, FirstName: "GoalsBot", UserName: "goals_test_bot"}
+
+// maxPollTimeout caps how long getUpdates waits for new updates, so tests
+// shut down quickly even when the bot asks for long polling
+const maxPollTimeout = time.Second
+
+// Call is a Bot API request received by the Server
+type Call struct {
+	Method string
+	Params url.Values
+}
+
+// Text returns the text or caption of a sent message, or "" if it has none
+func (c Call) Text() string {
+	if text := c.Params.Get("text"); text != "" {
+		return text
+	}
+	return c.Params.Get("caption")
+}
+
+// ChatID returns the chat a call is addressed to, or 0 if it has none
+func (c Call) ChatID() int64 {
+	id, _ := strconv.ParseInt(c.Params.Get("chat_id"), 10, 64)
+	return id
+}
+
+// Server is an httptest stand-in for the Telegram Bot API. A real
+// *tgbotapi.BotAPI is pointed at it with tgbotapi.NewBotAPIWithAPIEndpoint
+// and Endpoint. Updates queued with PushUpdate are served from getUpdates;
+// every other call is recorded and answered like Telegram would.
+type Server struct {
+	srv *httptest.Server
+
+	mu            sync.Mutex
+	updates       []tgbotapi.Update
+	pushed        chan struct{} // closed and replaced whenever an update is queued
+	lastUpdateID  int
+	lastMessageID int
+	calls         []Call
+	files         map[string]tgbotapi.File
+	admins        map[[2]int64]struct{} // chat ID and user ID
+}
+
+func NewServer() *Server {
+	s := &Server{
+		pushed: make(chan struct{}),
+		files:  make(map[string]tgbotapi.File),
+		admins: make(map[[2]int64]struct{}),
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Endpoint is the API endpoint format to pass to tgbotapi.NewBotAPIWithAPIEndpoint
+func (s *Server) Endpoint() string {
+	return s.srv.URL + "/bot%s/%s"
+}
+
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// PushUpdate queues an update for getUpdates and returns the ID assigned to it
+func (s *Server) PushUpdate(update tgbotapi.Update) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastUpdateID++
+	update.UpdateID = s.lastUpdateID
+	s.updates = append(s.updates, update)
+
+	close(s.pushed)
+	s.pushed = make(chan struct{})
+	return update.UpdateID
+}
+
+// AddFile makes a file available to getFile
+func (s *Server) AddFile(file tgbotapi.File) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.files[file.FileID] = file
+}
+
+// SetAdmin makes getChatMember report userID as an administrator of chatID;
+// everyone else is a regular member
+func (s *Server) SetAdmin(chatID, userID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.admins[[2]int64{chatID, userID}] = struct{}{}
+}
+
+// Calls returns every recorded call other than getMe and getUpdates, oldest first
+func (s *Server) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Call(nil), s.calls...)
+}
+
+// Texts returns the text, or caption for media, of every message sent or
+// edited in chatID, oldest first
+func (s *Server) Texts(chatID int64) []string {
+	var texts []string
+	for _, call := range s.Calls() {
+		if call.ChatID() != chatID {
+			continue
+		}
+		if text := call.Text(); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return texts
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if len(parts) != 2 || parts[0] != "bot"+Token {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	method := parts[1]
+
+	if err := r.ParseMultipartForm(32 << 20); err != nil && err != http.ErrNotMultipart {
+		writeError(w, http.StatusBadRequest, "Bad Request: "+err.Error())
+		return
+	}
+
+	switch method {
+	case "getMe":
+		writeResult(w, BotUser)
+		return
+	case "getUpdates":
+		s.getUpdates(w, r)
+		return
+	}
+
+	call := Call{Method: method, Params: r.Form}
+
+	s.mu.Lock()
+	s.calls = append(s.calls, call)
+	s.mu.Unlock()
+
+	switch {
+	case method == "answerCallbackQuery":
+		writeResult(w, true)
+	case method == "getFile":
+		s.getFile(w, call)
+	case method == "getChatMember":
+		s.getChatMember(w, call)
+	case strings.HasPrefix(method, "send"), strings.HasPrefix(method, "editMessage"):
+		s.sendMessage(w, call)
+	default:
+		writeError(w, http.StatusNotFound, "Not Found: method not found")
+	}
+}
+
+// getUpdates answers a long-poll request. Updates before offset are
+// confirmed by the bot and dropped.
+func (s *Server) getUpdates(w http.ResponseWriter, r *http.Request) {
+	offset, _ := strconv.Atoi(r.Form.Get("offset"))
+	timeout, _ := strconv.Atoi(r.Form.Get("timeout"))
+
+	wait := time.Duration(timeout) * time.Second
+	if wait > maxPollTimeout {
+		wait = maxPollTimeout
+	}
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+
+	for {
+		s.mu.Lock()
+		pending := s.updates[:0]
+		for _, update := range s.updates {
+			if update.UpdateID >= offset {
+				pending = append(pending, update)
+			}
+		}
+		s.updates = pending
+		batch := append([]tgbotapi.Update{}, pending...)
+		pushed := s.pushed
+		s.mu.Unlock()
+
+		if len(batch) > 0 {
+			writeResult(w, batch)
+			return
+		}
+
+		select {
+		case <-pushed:
+		case <-deadline.C:
+			writeResult(w, batch)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *Server) getFile(w http.ResponseWriter, call Call) {
+	s.mu.Lock()
+	file, ok := s.files[call.Params.Get("file_id")]
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Bad Request: invalid file_id")
+		return
+	}
+	writeResult(w, file)
+}
+
+func (s *Server) getChatMember(w http.ResponseWriter, call Call) {
+	userID, _ := strconv.ParseInt(call.Params.Get("user_id"), 10, 64)
+
+	s.mu.Lock()
+	_, admin := s.admins[[2]int64{call.ChatID(), userID}]
+	s.mu.Unlock()
+
+	status := "member"
+	if admin {
+		status = "administrator"
+	}
+	writeResult(w, tgbotapi.ChatMember{User: &tgbotapi.User{ID: userID}, Status: status})
+}
+
+// sendMessage answers send* and editMessage* calls with the resulting message
+func (s *Server) sendMessage(w http.ResponseWriter, call Call) {
+	chatID := call.ChatID()
+	if chatID == 0 {
+		writeError(w, http.StatusBadRequest, "Bad Request: chat_id is empty")
+		return
+	}
+
+	messageID, _ := strconv.Atoi(call.Params.Get("message_id"))
+	if messageID == 0 {
+		s.mu.Lock()
+		s.lastMessageID++
+		messageID = s.lastMessageID
+		s.mu.Unlock()
+	}
+
+	from := BotUser
+	writeResult(w, tgbotapi.Message{
+		MessageID: messageID,
+		From:      &from,
+		Date:      int(time.Now().Unix()),
+		Chat:      &tgbotapi.Chat{ID: chatID},
+		Text:      call.Params.Get("text"),
+		Caption:   call.Params.Get("caption"),
+	})
+}
+
+func writeResult(w http.ResponseWriter, result any) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, tgbotapi.APIResponse{Ok: true, Result: data})
+}
+
+func writeError(w http.ResponseWriter, code int, description string) {
+	writeJSON(w, code, tgbotapi.APIResponse{Ok: false, ErrorCode: code, Description: description})
+}
+
+func writeJSON(w http.ResponseWriter, code int, resp tgbotapi.APIResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,96 @@
+package webhook
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log/slog"
+	"net/http"
+	"regexp"
+)
+
+// SecretHeader carries the secret token Telegram was given in setWebhook
+const SecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// maxUpdateSize bounds the request body; real updates are a few kilobytes
+const maxUpdateSize = 1 << 20
+
+// validSecret matches the characters Telegram allows in a secret token
+var validSecret = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+// Dispatcher queues a decoded update for processing. It reports false if
+// updates are no longer accepted.
+type Dispatcher interface {
+	Dispatch(update tgbotapi.Update) bool
+}
+
+// Handler receives updates pushed by Telegram and hands them to a Dispatcher.
+// Requests without the expected secret token are rejected, so only Telegram
+// can inject updates even if the URL leaks.
+type Handler struct {
+	secret     string
+	dispatcher Dispatcher
+}
+
+func NewHandler(secret string, dispatcher Dispatcher) *Handler {
+	return &Handler{secret: secret, dispatcher: dispatcher}
+}
+
+// ServeHTTP answers 200 once the update is queued. Dispatch blocks while the
+// queue is full, which holds the response and makes Telegram slow down.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(SecretHeader)), []byte(h.secret)) != 1 {
+		slog.WarnContext(r.Context(), "Rejected webhook request: bad secret token", "remote_addr", r.RemoteAddr)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var update tgbotapi.Update
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxUpdateSize)).Decode(&update); err != nil {
+		slog.WarnContext(r.Context(), "Error decoding webhook update", "error", err)
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	// Telegram retries updates that were not answered with 2xx
+	if !h.dispatcher.Dispatch(update) {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// ValidateSecret checks that secret can be used as a Telegram secret token
+func ValidateSecret(secret string) error {
+	if !validSecret.MatchString(secret) {
+		return fmt.Errorf("secret token must be 1-256 characters of A-Z, a-z, 0-9, _ and -")
+	}
+	return nil
+}
+
+// Register points Telegram at url, which config validation has already
+// checked to be https. Updates are then sent with secret in SecretHeader;
+// only allowedUpdates types are delivered.
+func Register(bot *tgbotapi.BotAPI, url, secret string, allowedUpdates []string) error {
+	params := tgbotapi.Params{"url": url, "secret_token": secret}
+	if err := params.AddInterface("allowed_updates", allowedUpdates); err != nil {
+		return err
+	}
+
+	_, err := bot.MakeRequest("setWebhook", params)
+	return err
+}
+
+// Unregister removes the webhook so updates can be fetched with getUpdates
+func Unregister(bot *tgbotapi.BotAPI) error {
+	_, err := bot.Request(tgbotapi.DeleteWebhookConfig{})
+	return err
+}
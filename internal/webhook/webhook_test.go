@@ -0,0 +1,124 @@
+package webhook
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testSecret = "s3cret_token"
+
+// fakeDispatcher records the updates it is given
+type fakeDispatcher struct {
+	closed  bool
+	updates []tgbotapi.Update
+}
+
+func (d *fakeDispatcher) Dispatch(update tgbotapi.Update) bool {
+	if d.closed {
+		return false
+	}
+	d.updates = append(d.updates, update)
+	return true
+}
+
+// serve sends one request through a Handler and returns the response
+func serve(dispatcher *fakeDispatcher, method, secret, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/telegram", strings.NewReader(body))
+	if secret != "" {
+		req.Header.Set(SecretHeader, secret)
+	}
+	rec := httptest.NewRecorder()
+	NewHandler(testSecret, dispatcher).ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandlerDispatchesValidUpdate(t *testing.T) {
+	dispatcher := &fakeDispatcher{}
+	rec := serve(dispatcher, http.MethodPost, testSecret,
+		`{"update_id": 42, "message": {"message_id": 7, "text": "/start", "chat": {"id": -100}}}`)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if len(dispatcher.updates) != 1 {
+		t.Fatalf("expected one dispatched update, got %d", len(dispatcher.updates))
+	}
+	update := dispatcher.updates[0]
+	if update.UpdateID != 42 || update.Message == nil || update.Message.Text != "/start" || update.Message.Chat.ID != -100 {
+		t.Errorf("unexpected update %+v", update)
+	}
+}
+
+func TestHandlerRejectsBadRequests(t *testing.T) {
+	valid := `{"update_id": 1}`
+	tests := []struct {
+		name   string
+		method string
+		secret string
+		body   string
+		code   int
+	}{
+		{"missing secret", http.MethodPost, "", valid, http.StatusUnauthorized},
+		{"wrong secret", http.MethodPost, "not_the_secret", valid, http.StatusUnauthorized},
+		{"secret prefix", http.MethodPost, testSecret[:4], valid, http.StatusUnauthorized},
+		{"GET", http.MethodGet, testSecret, "", http.StatusMethodNotAllowed},
+		{"PUT", http.MethodPut, testSecret, valid, http.StatusMethodNotAllowed},
+		{"malformed JSON", http.MethodPost, testSecret, `{"update_id":`, http.StatusBadRequest},
+		{"oversized body", http.MethodPost, testSecret,
+			`{"update_id": 1, "message": {"text": "` + strings.Repeat("x", maxUpdateSize) + `"}}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := &fakeDispatcher{}
+			rec := serve(dispatcher, tt.method, tt.secret, tt.body)
+
+			if rec.Code != tt.code {
+				t.Errorf("expected %d, got %d", tt.code, rec.Code)
+			}
+			if len(dispatcher.updates) != 0 {
+				t.Errorf("expected nothing to be dispatched, got %d updates", len(dispatcher.updates))
+			}
+		})
+	}
+}
+
+func TestHandlerAdvertisesAllowedMethod(t *testing.T) {
+	rec := serve(&fakeDispatcher{}, http.MethodGet, testSecret, "")
+	if allow := rec.Header().Get("Allow"); allow != http.MethodPost {
+		t.Errorf("expected Allow: POST, got %q", allow)
+	}
+}
+
+func TestHandlerReportsShutdown(t *testing.T) {
+	rec := serve(&fakeDispatcher{closed: true}, http.MethodPost, testSecret, `{"update_id": 1}`)
+
+	// Telegram redelivers the update once the bot is back
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d", rec.Code)
+	}
+}
+
+func TestValidateSecret(t *testing.T) {
+	tests := []struct {
+		secret string
+		valid  bool
+	}{
+		{testSecret, true},
+		{"A-z_0-9", true},
+		{strings.Repeat("a", 256), true},
+		{"", false},
+		{strings.Repeat("a", 257), false},
+		{"has space", false},
+		{"colon:token", false},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateSecret(tt.secret); (err == nil) != tt.valid {
+			t.Errorf("ValidateSecret(%q) = %v, expected valid: %v", tt.secret, err, tt.valid)
+		}
+	}
+}
@@ -1,77 +1,422 @@
 package main
 
 import (
+	"awesomeProject/internal/config"
+	"awesomeProject/internal/dispatcher"
 	"awesomeProject/internal/handlers"
+	"awesomeProject/internal/logging"
+	"awesomeProject/internal/metrics"
+	"awesomeProject/internal/migrate"
 	"awesomeProject/internal/repository"
+	"awesomeProject/internal/scheduler"
 	"awesomeProject/internal/service"
+	"awesomeProject/internal/webhook"
+	"awesomeProject/migrations"
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
-	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
 )
 
 func main() {
 	// Load environment variables
-	err := godotenv.Load()
+	envErr := godotenv.Load()
+
+	// Defaults, overridden by the CONFIG_FILE file and then the environment
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"))
 	if err != nil {
-		log.Println("Warning: .env file not found, using system environment variables")
+		fmt.Fprintf(os.Stderr, "❌ Invalid configuration:\n%v\n", err)
+		os.Exit(1)
 	}
 
-	// Get Telegram token
-	token := os.Getenv("TELEGRAM_TOKEN")
-	if token == "" {
-		log.Fatal("❌ TELEGRAM_TOKEN not set")
-	}
+	// Everything else is logged with slog, including the log package
+	slog.SetDefault(newLogger(cfg.Log))
 
-	// Get database connection string
-	dbConnStr := os.Getenv("DATABASE_URL")
-	if dbConnStr == "" {
-		dbConnStr = "host=localhost port=5432 user=postgres password=123 dbname=goalsbot sslmode=disable"
-		log.Println("⚠️  Using default database connection string")
+	if envErr != nil {
+		slog.Warn("⚠️  .env file not found, using system environment variables")
+	}
+	if cfg.Database.URL == config.DefaultDatabaseURL {
+		slog.Warn("⚠️  Using default database connection string")
 	}
 
 	// Connect to database
-	db, err := sql.Open("postgres", dbConnStr)
+	db, err := sql.Open("postgres", cfg.Database.URL)
 	if err != nil {
-		log.Fatalf("❌ Database connection error: %v", err)
+		fatal("❌ Database connection error", "error", err)
 	}
 	defer db.Close()
 
 	// Test database connection
 	if err = db.Ping(); err != nil {
-		log.Fatalf("❌ Cannot ping database: %v", err)
+		fatal("❌ Cannot ping database", "error", err)
+	}
+	slog.Info("✅ Connected to database")
+
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		fatal("❌ Cannot load migrations", "error", err)
+	}
+
+	// `goalsbot migrate ...` manages the schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(migrator, os.Args[2:])
+		return
 	}
-	log.Println("✅ Connected to database")
+
+	// Bring the schema up to date, or refuse to run against a schema this
+	// build does not match
+	migrateOnStart(migrator, cfg.Database.AutoMigrate)
+
+	if cfg.Telegram.Token == "" {
+		fatal("❌ TELEGRAM_TOKEN not set")
+	}
+
+	// Expose Prometheus metrics
+	metricsServer := startMetrics(cfg.Metrics.Listen)
+	defer metricsServer.Close()
 
 	// Initialize repository and service
-	repo := repository.NewRepository(db)
-	svc := service.NewService(repo)
+	repo := repository.NewRepository(db, repository.Config{
+		QueryTimeout:    cfg.Database.QueryTimeout,
+		StartingBalance: cfg.Rules.StartingBalance,
+		ChangeFee:       cfg.Rules.ChangeFee,
+		ChangeWindow:    cfg.Rules.ChangeWindow,
+	})
+	svc := service.NewService(repo, serviceConfig(cfg))
 
 	// Initialize bot
-	bot, err := tgbotapi.NewBotAPI(token)
+	bot, err := tgbotapi.NewBotAPI(cfg.Telegram.Token)
 	if err != nil {
-		log.Fatalf("❌ Bot initialization error: %v", err)
+		fatal("❌ Bot initialization error", "error", err)
 	}
 
 	bot.Debug = false
-	log.Printf("✅ Bot authorized as @%s", bot.Self.UserName)
+	slog.Info("✅ Bot authorized", "username", bot.Self.UserName)
 
 	// Initialize handler
-	handler := handlers.NewBotHandler(bot, svc)
+	handler := handlers.NewBotHandler(bot, svc, handlers.Config{StartingBalance: cfg.Rules.StartingBalance})
+
+	// Root context of all work. It is cancelled only if shutdown takes longer
+	// than the shutdown timeout, to abort whatever is still running.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Start background jobs (deadline enforcement and reminders)
+	sched := scheduler.NewScheduler(svc, handler, scheduler.SystemClock{}, schedulerConfig(cfg.Scheduler))
+	sched.Start(ctx)
+
+	// Process updates in parallel across chats, in order within a chat
+	disp := dispatcher.NewDispatcher(ctx, handler, cfg.Telegram.Workers, cfg.Telegram.QueueSize)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	allowedUpdates := []string{"message", "callback_query"}
+
+	var stopReceiving func()
+	var receiving <-chan struct{}
+	if cfg.Telegram.UpdateMode == config.ModeWebhook {
+		stopReceiving, receiving = startWebhook(bot, disp, cfg.Telegram.Webhook, allowedUpdates)
+	} else {
+		stopReceiving, receiving = startPolling(bot, disp, cfg.Telegram.PollTimeout, allowedUpdates)
+	}
+
+	select {
+	case <-signals:
+		slog.Info("🛑 Shutting down, finishing queued updates...")
+	case <-receiving:
+		slog.Info("🛑 Stopped receiving updates, finishing queued updates...")
+	}
+
+	// Stop taking new updates, then let queued updates and the current
+	// scheduler tick finish
+	stopReceiving()
+	shutdown(cancel, cfg.ShutdownTimeout,
+		func() {
+			<-receiving
+			disp.Close()
+		},
+		sched.Stop,
+	)
+	slog.Info("👋 Bot stopped")
+}
+
+// startPolling fetches updates with long polling and dispatches them. The
+// returned channel is closed once polling has stopped after stop is called.
+func startPolling(bot *tgbotapi.BotAPI, disp *dispatcher.Dispatcher, timeout time.Duration, allowedUpdates []string) (stop func(), done <-chan struct{}) {
+	// getUpdates is refused while a webhook is set
+	if err := webhook.Unregister(bot); err != nil {
+		fatal("❌ Cannot remove webhook", "error", err)
+	}
 
-	// Start receiving updates
 	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
-	u.AllowedUpdates = []string{"message", "callback_query"}
+	u.Timeout = int(timeout / time.Second)
+	u.AllowedUpdates = allowedUpdates
 
 	updates := bot.GetUpdatesChan(u)
 
-	log.Println("🚀 Bot is running...")
+	// The channel is closed after the poll in progress returns, so updates
+	// Telegram already handed out are still dispatched
+	polled := make(chan struct{})
+	go func() {
+		defer close(polled)
+		for update := range updates {
+			disp.Dispatch(update)
+		}
+	}()
+
+	slog.Info("🚀 Bot is running (long polling)...")
+	return bot.StopReceivingUpdates, polled
+}
+
+// startWebhook serves updates pushed by Telegram. The returned channel is
+// closed once the server has stopped and finished in-flight requests, either
+// after stop is called or because it failed.
+func startWebhook(bot *tgbotapi.BotAPI, disp *dispatcher.Dispatcher, cfg config.Webhook, allowedUpdates []string) (stop func(), done <-chan struct{}) {
+	mux := http.NewServeMux()
+	mux.Handle(cfg.Path, webhook.NewHandler(cfg.Secret, disp))
+	srv := &http.Server{Addr: cfg.Listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	if err := webhook.Register(bot, cfg.URL, cfg.Secret, allowedUpdates); err != nil {
+		fatal("❌ Cannot set webhook", "error", err)
+	}
+
+	stopped := make(chan struct{})
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+
+		select {
+		case <-stopped:
+		case err := <-serveErr:
+			slog.Error("❌ Webhook server error", "error", err)
+			return
+		}
+
+		// Wait for in-flight requests so their updates are queued
+		if err := srv.Shutdown(context.Background()); err != nil {
+			slog.Error("Error stopping webhook server", "error", err)
+		}
+	}()
+
+	slog.Info("🚀 Bot is running (webhook)...", "listen", cfg.Listen, "path", cfg.Path)
+	return func() { close(stopped) }, served
+}
+
+// startMetrics serves /metrics on listen. A failing server is logged but
+// does not stop the bot.
+func startMetrics(listen string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	srv := &http.Server{Addr: listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("❌ Metrics server error", "error", err)
+		}
+	}()
+
+	slog.Info("📈 Metrics available", "listen", listen, "path", "/metrics")
+	return srv
+}
+
+// shutdownAbortGrace is how long shutdown waits for work to react to the
+// root context being cancelled before giving up on it
+const shutdownAbortGrace = 5 * time.Second
+
+// shutdown runs the steps concurrently and waits for them. If they take longer
+// than timeout, cancel is called so in-flight queries are aborted and their
+// transactions rolled back.
+func shutdown(cancel context.CancelFunc, timeout time.Duration, steps ...func()) {
+	var wg sync.WaitGroup
+	for _, step := range steps {
+		wg.Add(1)
+		go func(step func()) {
+			defer wg.Done()
+			step()
+		}(step)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return
+	case <-time.After(timeout):
+		slog.Warn("⚠️  Shutdown did not finish in time, aborting in-flight work", "timeout", timeout)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(shutdownAbortGrace):
+		slog.Warn("⚠️  Some work is still running, exiting anyway")
+	}
+}
+
+// newLogger builds the logger from the log settings
+func newLogger(cfg config.Log) *slog.Logger {
+	logger, err := logging.New(os.Stderr, cfg.Level, cfg.Format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Invalid logging configuration: %v\n", err)
+		os.Exit(1)
+	}
+	return logger
+}
+
+// fatal logs msg with args as an error and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// serviceConfig selects the business rules the service enforces
+func serviceConfig(cfg config.Config) service.Config {
+	rules := cfg.Rules
+	return service.Config{
+		MinBet:           rules.MinBet,
+		MaxBet:           rules.MaxBet,
+		ApprovalPercent:  rules.ApprovalPercent,
+		VotingWindow:     rules.VotingWindow,
+		VotingResolution: rules.VotingResolution,
+		PenaltyMode:      rules.PenaltyMode,
+		ReminderOffsets:  cfg.Scheduler.ReminderOffsets,
+		Language:         rules.Language,
+		ChangeFee:        rules.ChangeFee,
+		ChangeWindow:     rules.ChangeWindow,
+		CharityAccount:   rules.CharityAccount,
+		ConversationTTL:  rules.ConversationTTL,
+	}
+}
+
+// schedulerConfig selects how often jobs run and where reminders go
+func schedulerConfig(cfg config.Scheduler) scheduler.Config {
+	return scheduler.Config{
+		Interval:     cfg.Interval,
+		RemindInChat: cfg.RemindInChat(),
+		RemindAuthor: cfg.RemindAuthor(),
+	}
+}
+
+// migrateOnStart applies pending migrations if auto is set; otherwise the bot
+// refuses to start until they are applied by hand
+func migrateOnStart(migrator *migrate.Migrator, auto bool) {
+	if !auto {
+		pending, err := migrator.Check()
+		if err != nil {
+			fatal("❌ Schema check failed", "error", err)
+		}
+		if len(pending) > 0 {
+			fatal("❌ Pending migrations, run `migrate up` first", "pending", len(pending))
+		}
+		return
+	}
+
+	applied, err := migrator.Up()
+	for _, m := range applied {
+		slog.Info("✅ Applied migration", "version", m.Version, "name", m.Name)
+	}
+	if err != nil {
+		fatal("❌ Migration failed", "error", err)
+	}
+	slog.Info("✅ Database schema is up to date", "version", migrator.Latest())
+}
+
+// runMigrate handles `migrate up`, `migrate down [steps]`, `migrate status`
+// and `migrate baseline <version>`
+func runMigrate(migrator *migrate.Migrator, args []string) {
+	if len(args) == 0 {
+		fatal("❌ Usage: migrate up | down [steps] | status | baseline <version>")
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		for _, m := range applied {
+			slog.Info("✅ Applied migration", "version", m.Version, "name", m.Name)
+		}
+		if err != nil {
+			fatal("❌ Migration failed", "error", err)
+		}
+		if len(applied) == 0 {
+			slog.Info("Nothing to apply")
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				fatal("❌ Invalid number of steps", "value", args[1])
+			}
+			steps = n
+		}
+
+		reverted, err := migrator.Down(steps)
+		for _, m := range reverted {
+			slog.Info("✅ Reverted migration", "version", m.Version, "name", m.Name)
+		}
+		if err != nil {
+			fatal("❌ Migration failed", "error", err)
+		}
+		if len(reverted) == 0 {
+			slog.Info("Nothing to revert")
+		}
+
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			fatal("❌ Cannot read schema status", "error", err)
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%02d_%s\t%s\n", s.Version, s.Name, applied)
+		}
+		if _, err := migrator.Check(); err != nil {
+			if errors.Is(err, migrate.ErrUntracked) {
+				fmt.Println("⚠️  " + err.Error())
+			} else {
+				fatal("❌ Schema check failed", "error", err)
+			}
+		}
+
+	case "baseline":
+		if len(args) < 2 {
+			fatal("❌ Usage: migrate baseline <version>")
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil || version <= 0 {
+			fatal("❌ Invalid version", "value", args[1])
+		}
+		if err := migrator.Baseline(version); err != nil {
+			fatal("❌ Baseline failed", "error", err)
+		}
+		slog.Info("✅ Recorded migrations as applied", "version", version)
 
-	// Handle updates
-	for update := range updates {
-		handler.HandleUpdate(update)
+	default:
+		fatal("❌ Unknown migrate command", "command", args[0])
 	}
 }
@@ -0,0 +1,5 @@
+DROP TABLE chat_members;
+DROP TABLE transactions;
+DROP TABLE votes;
+DROP TABLE goals;
+DROP TABLE users;
@@ -0,0 +1,4 @@
+-- Return bets held in escrow to the available balance
+UPDATE users SET balance = balance + locked_balance;
+
+ALTER TABLE users DROP COLUMN locked_balance;
@@ -0,0 +1,13 @@
+ALTER TABLE users ADD COLUMN locked_balance INT NOT NULL DEFAULT 0;
+
+-- Move bets of goals that are still open into escrow
+UPDATE users u
+SET balance = u.balance - g.total,
+    locked_balance = g.total
+FROM (
+    SELECT user_id, SUM(bet) AS total
+    FROM goals
+    WHERE status IN ('active', 'done_pending')
+    GROUP BY user_id
+) g
+WHERE u.id = g.user_id;
@@ -0,0 +1,8 @@
+CREATE TABLE goal_reminders(
+    id SERIAL PRIMARY KEY,
+    goal_id INT NOT NULL,
+    offset_minutes INT NOT NULL,
+    sent_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (goal_id) REFERENCES goals(id) ON DELETE CASCADE,
+    UNIQUE(goal_id, offset_minutes)
+);
@@ -0,0 +1,2 @@
+-- Text proofs are still kept in goals.proof_message
+DROP TABLE goal_proofs;
@@ -0,0 +1,13 @@
+CREATE TABLE goal_proofs(
+    id SERIAL PRIMARY KEY,
+    goal_id INT NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    file_id TEXT,
+    caption TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (goal_id) REFERENCES goals(id) ON DELETE CASCADE
+);
+
+-- Keep text proofs submitted before media support
+INSERT INTO goal_proofs (goal_id, kind, caption)
+SELECT id, 'text', proof_message FROM goals WHERE proof_message IS NOT NULL;
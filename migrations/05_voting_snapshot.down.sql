@@ -0,0 +1,5 @@
+DROP TABLE goal_voters;
+
+ALTER TABLE goals DROP COLUMN required_votes;
+ALTER TABLE goals DROP COLUMN chat_members_count;
+ALTER TABLE goals DROP COLUMN voting_started_at;
@@ -0,0 +1,25 @@
+ALTER TABLE goals ADD COLUMN voting_started_at TIMESTAMP;
+ALTER TABLE goals ADD COLUMN chat_members_count INT NOT NULL DEFAULT 0;
+ALTER TABLE goals ADD COLUMN required_votes INT NOT NULL DEFAULT 0;
+
+CREATE TABLE goal_voters(
+    goal_id INT NOT NULL,
+    user_id INT NOT NULL,
+    FOREIGN KEY (goal_id) REFERENCES goals(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (goal_id, user_id)
+);
+
+-- Snapshot voters for goals that are already being voted on
+INSERT INTO goal_voters (goal_id, user_id)
+SELECT g.id, cm.user_id
+FROM goals g
+INNER JOIN chat_members cm ON cm.chat_id = g.chat_id
+WHERE g.status = 'done_pending' AND cm.user_id <> g.user_id;
+
+UPDATE goals g
+SET voting_started_at = CURRENT_TIMESTAMP,
+    chat_members_count = v.total,
+    required_votes = (v.total + 1) / 2
+FROM (SELECT goal_id, COUNT(*) AS total FROM goal_voters GROUP BY goal_id) v
+WHERE g.id = v.goal_id;
@@ -0,0 +1 @@
+ALTER TABLE goals DROP COLUMN voting_ends_at;
@@ -0,0 +1 @@
+ALTER TABLE goals ADD COLUMN voting_ends_at TIMESTAMP;
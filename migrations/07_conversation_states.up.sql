@@ -0,0 +1,7 @@
+CREATE TABLE conversation_states(
+    user_id BIGINT PRIMARY KEY,
+    state JSONB NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX conversation_states_expires_at_idx ON conversation_states(expires_at);
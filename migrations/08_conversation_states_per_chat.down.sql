@@ -0,0 +1,6 @@
+-- States of the same user in different chats cannot be merged back
+DELETE FROM conversation_states;
+
+ALTER TABLE conversation_states DROP CONSTRAINT conversation_states_pkey;
+ALTER TABLE conversation_states DROP COLUMN chat_id;
+ALTER TABLE conversation_states ADD PRIMARY KEY (user_id);
@@ -0,0 +1,7 @@
+-- Conversations are now scoped to a chat; states saved without one cannot be
+-- attributed and are short-lived anyway
+DELETE FROM conversation_states;
+
+ALTER TABLE conversation_states DROP CONSTRAINT conversation_states_pkey;
+ALTER TABLE conversation_states ADD COLUMN chat_id BIGINT NOT NULL;
+ALTER TABLE conversation_states ADD PRIMARY KEY (chat_id, user_id);
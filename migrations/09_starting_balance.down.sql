@@ -0,0 +1 @@
+ALTER TABLE users ALTER COLUMN balance SET DEFAULT 100;
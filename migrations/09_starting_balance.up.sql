@@ -0,0 +1 @@
+ALTER TABLE users ALTER COLUMN balance DROP DEFAULT;
@@ -0,0 +1,11 @@
+CREATE TABLE chat_settings(
+    chat_id BIGINT PRIMARY KEY,
+    min_bet INT NOT NULL,
+    max_bet INT NOT NULL,
+    voting_window_seconds BIGINT NOT NULL,
+    approval_percent INT NOT NULL CHECK (approval_percent BETWEEN 1 AND 100),
+    penalty_mode VARCHAR(32) NOT NULL,
+    reminder_offsets_seconds BIGINT[] NOT NULL,
+    language VARCHAR(8) NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,16 @@
+-- Lossy: the schema before this migration has no treasuries, so the stars
+-- in chat_treasuries are dropped with the table. Penalties already paid to a
+-- treasury, burned or sent to the charity account stay recorded as ordinary
+-- penalty distributions from the author.
+
+-- Chats on a mode that did not exist yet fall back to the even split
+UPDATE chat_settings SET penalty_mode = 'members'
+WHERE penalty_mode NOT IN ('members', 'voters');
+
+UPDATE transactions SET reason = 'penalty_distribution'
+WHERE reason IN ('penalty_members', 'penalty_voters', 'penalty_weighted',
+                 'penalty_treasury', 'penalty_burn', 'penalty_charity');
+
+ALTER TABLE transactions DROP COLUMN treasury_chat_id;
+
+DROP TABLE chat_treasuries;
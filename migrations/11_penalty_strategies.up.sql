@@ -0,0 +1,12 @@
+CREATE TABLE chat_treasuries(
+    chat_id BIGINT PRIMARY KEY,
+    balance INT NOT NULL DEFAULT 0 CHECK (balance >= 0),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Set when a chat's treasury is the other side of the transaction; the
+-- user column left NULL then refers to the treasury instead of escrow
+ALTER TABLE transactions ADD COLUMN treasury_chat_id BIGINT;
+
+-- The old even split is now the members strategy
+UPDATE transactions SET reason = 'penalty_members' WHERE reason = 'penalty_distribution';
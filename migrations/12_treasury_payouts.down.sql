@@ -0,0 +1,3 @@
+DROP INDEX transactions_treasury_chat_id_idx;
+
+ALTER TABLE chat_treasuries DROP COLUMN season_started_at;
@@ -0,0 +1,6 @@
+-- NULL until the first season prizes are paid out; the first season covers
+-- every goal the chat has had
+ALTER TABLE chat_treasuries ADD COLUMN season_started_at TIMESTAMP;
+
+CREATE INDEX transactions_treasury_chat_id_idx ON transactions(treasury_chat_id, created_at DESC)
+    WHERE treasury_chat_id IS NOT NULL;
@@ -0,0 +1,5 @@
+DROP TABLE goal_changes;
+
+ALTER TABLE chat_settings
+    DROP COLUMN change_window,
+    DROP COLUMN change_fee;
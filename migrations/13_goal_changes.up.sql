@@ -0,0 +1,20 @@
+-- NULL for chats saved before these rules existed; they follow the bot's
+-- configured defaults until their admins save the settings again
+ALTER TABLE chat_settings
+    ADD COLUMN change_fee INT CHECK (change_fee BETWEEN 0 AND 100),
+    ADD COLUMN change_window INT CHECK (change_window BETWEEN 0 AND 100);
+
+CREATE TABLE goal_changes(
+    id SERIAL PRIMARY KEY,
+    goal_id INT NOT NULL,
+    user_id INT NOT NULL,
+    kind VARCHAR(32) NOT NULL,
+    old_value TEXT NOT NULL,
+    new_value TEXT NOT NULL,
+    fee INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (goal_id) REFERENCES goals(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX goal_changes_goal_id_idx ON goal_changes(goal_id, created_at);
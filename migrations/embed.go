@@ -0,0 +1,9 @@
+// Package migrations embeds the SQL schema migrations into the binary.
+// Files are named NN_name.up.sql and NN_name.down.sql, where NN is the
+// version they bring the schema to.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS